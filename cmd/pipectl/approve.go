@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+// newApproveCmd is `pipectl approve <execution>`.
+func newApproveCmd() *cobra.Command {
+	return newDecisionCmd("approve", "Approve the pending escalation of a paused execution and resume it")
+}
+
+// newRejectCmd is `pipectl reject <execution>`.
+func newRejectCmd() *cobra.Command {
+	return newDecisionCmd("reject", "Reject the pending escalation of a paused execution and fail it")
+}
+
+func newDecisionCmd(decision, short string) *cobra.Command {
+	var server, by, reason string
+
+	cmd := &cobra.Command{
+		Use:     decision + " <execution>",
+		Short:   short,
+		Args:    cobra.ExactArgs(1),
+		Example: fmt.Sprintf("  pipectl %s 3f2c9a1e --reason \"checked the output\"", decision),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := postDecision(server, args[0], decision, by, reason)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("approval %s for execution %s: %s by %s\n", a.ID, a.ExecutionID, a.State, a.DecidedBy)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&server, "server", "http://localhost:8080", "PIPE server address")
+	cmd.Flags().StringVar(&by, "by", os.Getenv("USER"), "Reviewer recorded with the decision")
+	cmd.Flags().StringVar(&reason, "reason", "", "Reason recorded with the decision")
+	return cmd
+}
+
+func postDecision(server, executionID, decision, by, reason string) (*models.ApprovalRequest, error) {
+	body, err := json.Marshal(map[string]string{"by": by, "reason": reason})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Post(server+"/api/v1/executions/"+url.PathEscape(executionID)+"/"+decision, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var out struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return nil, fmt.Errorf("server returned %s: %s", resp.Status, out.Error)
+	}
+	var approval models.ApprovalRequest
+	if err := json.NewDecoder(resp.Body).Decode(&approval); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &approval, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+// newDescribeCmd is `pipectl describe`.
+func newDescribeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "describe",
+		Short: "Show the details of a resource",
+	}
+	cmd.AddCommand(newDescribeExecutionCmd())
+	return cmd
+}
+
+// newDescribeExecutionCmd is `pipectl describe execution <id>`.
+func newDescribeExecutionCmd() *cobra.Command {
+	var server string
+
+	cmd := &cobra.Command{
+		Use:     "execution <id>",
+		Aliases: []string{"exec"},
+		Short:   "Show an execution with its guardrail verdicts and logs",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			exec, err := fetchExecution(server, args[0])
+			if err != nil {
+				return err
+			}
+			var logs struct {
+				Logs []models.ExecutionLog `json:"logs"`
+			}
+			if err := getJSON(server+"/api/v1/executions/"+url.PathEscape(args[0])+"/logs", &logs); err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(w, "ID:\t%s\n", exec.ID)
+			fmt.Fprintf(w, "Namespace:\t%s\n", exec.Namespace)
+			fmt.Fprintf(w, "Agent:\t%s\n", exec.AgentName)
+			if exec.PipelineName != "" {
+				fmt.Fprintf(w, "Pipeline:\t%s\n", exec.PipelineName)
+			}
+			fmt.Fprintf(w, "State:\t%s\n", exec.State)
+			fmt.Fprintf(w, "Step:\t%d/%d\n", exec.CurrentStep, exec.TotalSteps)
+			fmt.Fprintf(w, "Retries:\t%d/%d\n", exec.RetryCount, exec.MaxRetries)
+			fmt.Fprintf(w, "Tokens:\t%d\n", exec.TokensUsed)
+			if exec.Error != "" {
+				fmt.Fprintf(w, "Error:\t%s\n", exec.Error)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Println("\nGuardrail verdicts:")
+			w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "  STEP\tPHASE\tGUARDRAIL\tRESULT\tLATENCY\tMESSAGE")
+			for _, v := range exec.Verdicts {
+				result := "pass"
+				if !v.Passed {
+					result = v.Action
+				}
+				if v.Shadow {
+					result += " (shadow)"
+				}
+				fmt.Fprintf(w, "  %d\t%s\t%s\t%s\t%.1fms\t%s\n", v.Step, v.Phase, v.GuardrailID, result, v.LatencyMs, v.Message)
+			}
+			if len(exec.Verdicts) == 0 {
+				fmt.Fprintln(w, "  (none)\t\t\t\t\t")
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Println("\nLogs:")
+			for _, l := range logs.Logs {
+				fmt.Printf("  %s  %-5s  step %d  %s\n", l.Timestamp.Format("2006-01-02 15:04:05"), l.Level, l.Step, l.Message)
+			}
+			if len(logs.Logs) == 0 {
+				fmt.Println("  (none)")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&server, "server", "http://localhost:8080", "PIPE server address")
+	return cmd
+}
+
+func fetchExecution(server, id string) (*models.ExecutionRecord, error) {
+	var exec models.ExecutionRecord
+	if err := getJSON(server+"/api/v1/executions/"+url.PathEscape(id), &exec); err != nil {
+		return nil, err
+	}
+	return &exec, nil
+}
+
+// getJSON decodes the JSON body of a GET into out, turning a non-200 reply
+// into an error carrying the server's {"error": ...} message.
+func getJSON(u string, out interface{}) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("server returned %s: %s", resp.Status, body.Error)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+// newGetEventsCmd is `pipectl get events`.
+func newGetEventsCmd() *cobra.Command {
+	var server, forObject, namespace, eventType, since string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:     "events",
+		Aliases: []string{"event", "ev"},
+		Short:   "List events, optionally for one object",
+		Example: "  pipectl get events --for agent/foo\n  pipectl get events --for execution/<id> --type Warning",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params := url.Values{}
+			params.Set("limit", strconv.Itoa(limit))
+			if forObject != "" {
+				obj, err := parseObjectRef(forObject)
+				if err != nil {
+					return err
+				}
+				params.Set("kind", string(obj.Kind))
+				params.Set("name", obj.Name)
+			}
+			if namespace != "" {
+				params.Set("namespace", namespace)
+			}
+			if eventType != "" {
+				params.Set("type", eventType)
+			}
+			if since != "" {
+				params.Set("since", since)
+			}
+
+			events, err := fetchEvents(server, params)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "LAST SEEN\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+			now := time.Now()
+			for _, e := range events {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n",
+					age(now, e.LastSeen), e.Type, e.Reason, strings.ToLower(e.InvolvedObject.String()), e.Count, e.Message)
+			}
+			if len(events) == 0 {
+				fmt.Fprintln(w, "(none)\t\t\t\t\t")
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&server, "server", "http://localhost:8080", "PIPE server address")
+	cmd.Flags().StringVar(&forObject, "for", "", "Only events about this object, e.g. agent/foo or execution/<id>")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Only this namespace")
+	cmd.Flags().StringVar(&eventType, "type", "", "Only Normal or Warning events")
+	cmd.Flags().StringVar(&since, "since", "", "Only events seen within this duration, e.g. 1h")
+	cmd.Flags().IntVar(&limit, "limit", 100, "Maximum number of events")
+	return cmd
+}
+
+// parseObjectRef parses kind/name with a case-insensitive kind.
+func parseObjectRef(s string) (models.ObjectReference, error) {
+	kind, name, ok := strings.Cut(s, "/")
+	if !ok || kind == "" || name == "" {
+		return models.ObjectReference{}, fmt.Errorf("--for must be kind/name, e.g. agent/foo")
+	}
+	k, err := models.ParseResourceKind(strings.ToUpper(kind[:1]) + strings.ToLower(kind[1:]))
+	if err != nil {
+		return models.ObjectReference{}, err
+	}
+	return models.ObjectReference{Kind: k, Name: name}, nil
+}
+
+func fetchEvents(server string, params url.Values) ([]*models.Event, error) {
+	var body struct {
+		Events []*models.Event `json:"events"`
+	}
+	if err := getJSON(server+"/api/v1/events?"+params.Encode(), &body); err != nil {
+		return nil, err
+	}
+	return body.Events, nil
+}
+
+// age formats how long ago t was, kubectl style: 45s, 12m, 3h, 2d.
+func age(now, t time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import "github.com/spf13/cobra"
+
+// newGetCmd is `pipectl get`.
+func newGetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "List objects of a kind",
+	}
+	cmd.AddCommand(newGetEventsCmd())
+	return cmd
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Promptonauts/pipe/pkg/guardrails"
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/Promptonauts/pipe/pkg/schema"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func newGuardrailCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "guardrail",
+		Short: "Test, train and tune guardrails",
+	}
+	cmd.AddCommand(newGuardrailTestCmd())
+	cmd.AddCommand(newGuardrailTrainCmd())
+	cmd.AddCommand(newGuardrailShadowCmd())
+	return cmd
+}
+
+func newGuardrailTestCmd() *cobra.Command {
+	var file, casesFile, output string
+
+	cmd := &cobra.Command{
+		Use:   "test -f guardrail.yaml --cases cases.yaml",
+		Short: "Run a guardrail against a table of cases",
+		Long: `Builds the guardrail through the same factory the server uses and runs it
+against each case, comparing the verdict with the expected one. Exits
+non-zero when any case fails.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := readGuardrailResource(file)
+			if err != nil {
+				return err
+			}
+			cases, err := readGuardrailCases(casesFile)
+			if err != nil {
+				return err
+			}
+
+			g, err := guardrails.NewFactory(nil).Build(res)
+			if err != nil {
+				return err
+			}
+			if c, ok := g.(io.Closer); ok {
+				defer c.Close()
+			}
+
+			report := guardrails.RunCases(context.Background(), g, cases, observability.NewLogger("pipectl"))
+			switch output {
+			case "json":
+				err = report.WriteJSON(os.Stdout)
+			case "text", "":
+				err = report.WriteText(os.Stdout)
+			default:
+				return fmt.Errorf("unknown output format %q", output)
+			}
+			if err != nil {
+				return err
+			}
+			if !report.OK() {
+				return fmt.Errorf("%d of %d cases failed", report.Failed, report.Total)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Guardrail resource file")
+	cmd.Flags().StringVar(&casesFile, "cases", "", "YAML file with test cases")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Report format: text or json")
+	cmd.MarkFlagRequired("file")
+	cmd.MarkFlagRequired("cases")
+	return cmd
+}
+
+func newGuardrailTrainCmd() *cobra.Command {
+	var data, out string
+	var alpha float64
+
+	cmd := &cobra.Command{
+		Use:   "train --data examples.tsv -o model.json",
+		Short: "Train a classifier model for the classifier guardrail",
+		Long: `Reads labelled examples, one per line as "label<TAB>text" or as a JSON
+object with text and label, and writes a naive Bayes model that a
+classifier guardrail can load through config.model.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(data)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			examples, err := guardrails.ReadTrainingExamples(f)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", data, err)
+			}
+			model, err := guardrails.TrainClassifier(examples, alpha)
+			if err != nil {
+				return err
+			}
+
+			counts := make(map[string]int)
+			correct := 0
+			for _, ex := range examples {
+				counts[ex.Label]++
+				if label, _, ok := model.Top(ex.Text); ok && label == ex.Label {
+					correct++
+				}
+			}
+			for _, label := range model.Labels {
+				fmt.Fprintf(os.Stderr, "%-20s %d examples\n", label, counts[label])
+			}
+			fmt.Fprintf(os.Stderr, "training accuracy: %.1f%% (%d/%d)\n", 100*float64(correct)/float64(len(examples)), correct, len(examples))
+
+			w, err := os.Create(out)
+			if err != nil {
+				return err
+			}
+			if err := model.Save(w); err != nil {
+				w.Close()
+				return err
+			}
+			return w.Close()
+		},
+	}
+	cmd.Flags().StringVar(&data, "data", "", "Labelled training examples")
+	cmd.Flags().StringVarP(&out, "output", "o", "model.json", "Where to write the model")
+	cmd.Flags().Float64Var(&alpha, "alpha", 1, "Additive smoothing")
+	cmd.MarkFlagRequired("data")
+	return cmd
+}
+
+func readGuardrailResource(path string) (*models.GenericResource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var res models.GenericResource
+	if err := yaml.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if res.Kind != models.KindGuardrail {
+		return nil, fmt.Errorf("%s: kind is %q, expected Guardrail", path, res.Kind)
+	}
+	if result := schema.ValidationResource(&res); !result.Valid {
+		for _, e := range result.Errors {
+			fmt.Fprintf(os.Stderr, "  %s\n", e.Error())
+		}
+		return nil, fmt.Errorf("%s: invalid guardrail resource", path)
+	}
+	return &res, nil
+}
+
+// readGuardrailCases accepts either a bare list of cases or a document with
+// a top-level "cases" key.
+func readGuardrailCases(path string) ([]guardrails.TestCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Cases []guardrails.TestCase `yaml:"cases"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		var list []guardrails.TestCase
+		if err2 := yaml.Unmarshal(data, &list); err2 != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		doc.Cases = list
+	}
+	if len(doc.Cases) == 0 {
+		return nil, fmt.Errorf("%s: no cases", path)
+	}
+	return doc.Cases, nil
+}
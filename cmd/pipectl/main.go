@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	root := &cobra.Command{
+		Use:          "pipectl",
+		Short:        "Command line client for the PIPE server",
+		SilenceUsage: true,
+	}
+	root.AddCommand(
+		newApproveCmd(),
+		newRejectCmd(),
+		newDescribeCmd(),
+		newGetCmd(),
+		newGuardrailCmd(),
+		newTopCmd(),
+		newTraceCmd(),
+		newUsageCmd(),
+	)
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+// newGuardrailShadowCmd is `pipectl guardrail shadow`.
+func newGuardrailShadowCmd() *cobra.Command {
+	var server, since string
+	var samples bool
+
+	cmd := &cobra.Command{
+		Use:   "shadow",
+		Short: "Show what shadow-mode guardrails would have done if enforced",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stats, err := fetchShadowReport(server, url.Values{"since": {since}})
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "GUARDRAIL\tCHECKS\tVIOLATIONS\tRATE\tWOULD BLOCK\tWOULD ESCALATE\tEXECUTIONS\tOVERLAP")
+			for _, s := range stats {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%d\t%d\t%d/%d\t%d\n",
+					s.GuardrailID, s.Checks, s.Violations, 100*s.ViolationRate, s.WouldBlock, s.WouldEscalate,
+					s.ViolatingExecutions, s.Executions, s.OverlapWithEnforced)
+			}
+			if len(stats) == 0 {
+				fmt.Fprintln(w, "(none)\t\t\t\t\t\t\t")
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if !samples {
+				return nil
+			}
+			for _, s := range stats {
+				if len(s.Samples) == 0 {
+					continue
+				}
+				fmt.Printf("\n%s:\n", s.GuardrailID)
+				for _, sample := range s.Samples {
+					fmt.Printf("  %s step %d %s: %s\n", sample.ExecutionID, sample.Step, sample.Phase, sample.Message)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&server, "server", "http://localhost:8080", "PIPE server address")
+	cmd.Flags().StringVar(&since, "since", "7d", "How far back to look")
+	cmd.Flags().BoolVar(&samples, "samples", false, "Also print the latest violations of each guardrail")
+	return cmd
+}
+
+func fetchShadowReport(server string, params url.Values) ([]models.ShadowStats, error) {
+	var body struct {
+		Guardrails []models.ShadowStats `json:"guardrails"`
+	}
+	if err := getJSON(server+"/api/v1/guardrails/shadow?"+params.Encode(), &body); err != nil {
+		return nil, err
+	}
+	return body.Guardrails, nil
+}
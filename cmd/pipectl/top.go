@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+func newTopCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "top",
+		Short: "Show the busiest resources",
+	}
+	cmd.AddCommand(newTopGuardrailsCmd())
+	return cmd
+}
+
+func newTopGuardrailsCmd() *cobra.Command {
+	var server, since, namespace string
+	var limit int
+	var shadow bool
+
+	cmd := &cobra.Command{
+		Use:   "guardrails",
+		Short: "Show the guardrails and agents with the most violations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params := url.Values{}
+			params.Set("since", since)
+			params.Set("limit", strconv.Itoa(limit))
+			if namespace != "" {
+				params.Set("namespace", namespace)
+			}
+			if shadow {
+				params.Set("shadow", "true")
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, view := range []struct {
+				title   string
+				groupBy string
+			}{
+				{"GUARDRAIL", "guardrail"},
+				{"AGENT", "namespace,agent"},
+			} {
+				params.Set("groupBy", view.groupBy)
+				stats, err := fetchViolations(server, params)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%s\tVIOLATIONS\tEXECUTIONS\n", view.title)
+				for _, s := range stats {
+					name := s.GuardrailID
+					if view.groupBy != "guardrail" {
+						name = s.Namespace + "/" + s.AgentName
+					}
+					fmt.Fprintf(w, "%s\t%d\t%d\n", name, s.Count, s.Executions)
+				}
+				if len(stats) == 0 {
+					fmt.Fprintln(w, "(none)\t\t")
+				}
+				fmt.Fprintln(w, "\t\t")
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&server, "server", "http://localhost:8080", "PIPE server address")
+	cmd.Flags().StringVar(&since, "since", "24h", "How far back to look")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Only this namespace")
+	cmd.Flags().IntVar(&limit, "limit", 10, "Rows per table")
+	cmd.Flags().BoolVar(&shadow, "shadow", false, "Include shadow-mode violations")
+	return cmd
+}
+
+func fetchViolations(server string, params url.Values) ([]models.ViolationStat, error) {
+	var body struct {
+		Violations []models.ViolationStat `json:"violations"`
+	}
+	if err := getJSON(server+"/api/v1/guardrails/violations?"+params.Encode(), &body); err != nil {
+		return nil, err
+	}
+	return body.Violations, nil
+}
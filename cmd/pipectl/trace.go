@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/spf13/cobra"
+)
+
+func newTraceCmd() *cobra.Command {
+	var server, output string
+	var width int
+
+	cmd := &cobra.Command{
+		Use:   "trace <execution>",
+		Short: "Show where an execution spent its time",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trace, raw, err := fetchTrace(server, args[0])
+			if err != nil {
+				return err
+			}
+			switch output {
+			case "text":
+				observability.RenderWaterfall(os.Stdout, trace, width)
+				return nil
+			case "json":
+				_, err := os.Stdout.Write(raw)
+				return err
+			default:
+				return fmt.Errorf("unknown output format %q", output)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&server, "server", "http://localhost:8080", "PIPE server address")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format: text or json")
+	cmd.Flags().IntVar(&width, "width", 60, "Width of the timeline in characters")
+	return cmd
+}
+
+func fetchTrace(server, executionID string) (*models.ExecutionTrace, []byte, error) {
+	var raw json.RawMessage
+	if err := getJSON(server+"/api/v1/executions/"+url.PathEscape(executionID)+"/trace", &raw); err != nil {
+		return nil, nil, err
+	}
+	var trace models.ExecutionTrace
+	if err := json.Unmarshal(raw, &trace); err != nil {
+		return nil, nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &trace, append(raw, '\n'), nil
+}
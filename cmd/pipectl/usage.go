@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+func newUsageCmd() *cobra.Command {
+	var server, since, groupBy, namespace, agent, pipeline string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:     "usage",
+		Short:   "Show token usage and cost",
+		Example: "  pipectl usage --since 7d --group-by agent\n  pipectl usage --since 30d --group-by namespace,model",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params := url.Values{}
+			params.Set("since", since)
+			params.Set("groupBy", groupBy)
+			params.Set("limit", strconv.Itoa(limit))
+			if namespace != "" {
+				params.Set("namespace", namespace)
+			}
+			if agent != "" {
+				params.Set("agent", agent)
+			}
+			if pipeline != "" {
+				params.Set("pipeline", pipeline)
+			}
+
+			stats, total, err := fetchUsage(server, params)
+			if err != nil {
+				return err
+			}
+
+			groups := strings.Split(groupBy, ",")
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, g := range groups {
+				fmt.Fprintf(w, "%s\t", strings.ToUpper(g))
+			}
+			fmt.Fprintln(w, "CALLS\tEXECUTIONS\tPROMPT\tCOMPLETION\tTOTAL\tCOST\t")
+			for _, s := range stats {
+				for _, g := range groups {
+					fmt.Fprintf(w, "%s\t", usageGroupValue(s, g))
+				}
+				fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%s\t\n", s.Calls, s.Executions, s.PromptTokens, s.CompletionTokens, s.TotalTokens, formatCost(s.Cost, s.UnpricedCalls))
+			}
+			if len(stats) == 0 {
+				fmt.Fprintln(w, "(none)\t")
+			} else {
+				fmt.Fprintf(w, "TOTAL\t%s%d\t\t%d\t%d\t%d\t%s\t\n", strings.Repeat("\t", len(groups)-1),
+					total.Calls, total.PromptTokens, total.CompletionTokens, total.TotalTokens, formatCost(total.Cost, total.UnpricedCalls))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if total.UnpricedCalls > 0 {
+				fmt.Printf("* excludes %d calls to models without a price\n", total.UnpricedCalls)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&server, "server", "http://localhost:8080", "PIPE server address")
+	cmd.Flags().StringVar(&since, "since", "24h", "How far back to look, e.g. 7d or 12h")
+	cmd.Flags().StringVar(&groupBy, "group-by", "agent", "Comma list of execution, agent, pipeline, namespace, provider, model")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Only this namespace")
+	cmd.Flags().StringVar(&agent, "agent", "", "Only this agent")
+	cmd.Flags().StringVar(&pipeline, "pipeline", "", "Only this pipeline")
+	cmd.Flags().IntVar(&limit, "limit", 50, "Maximum number of rows")
+	return cmd
+}
+
+func usageGroupValue(s models.UsageStat, group string) string {
+	switch group {
+	case "execution":
+		return s.ExecutionID
+	case "agent":
+		return s.AgentName
+	case "pipeline":
+		return s.PipelineName
+	case "namespace":
+		return s.Namespace
+	case "provider":
+		return s.Provider
+	case "model":
+		return s.Model
+	}
+	return ""
+}
+
+// formatCost marks costs that leave out calls to unpriced models.
+func formatCost(cost float64, unpriced int64) string {
+	s := fmt.Sprintf("$%.4f", cost)
+	if unpriced > 0 {
+		s += "*"
+	}
+	return s
+}
+
+func fetchUsage(server string, params url.Values) ([]models.UsageStat, models.UsageStat, error) {
+	var body struct {
+		Usage []models.UsageStat `json:"usage"`
+		Total models.UsageStat   `json:"total"`
+	}
+	if err := getJSON(server+"/api/v1/usage?"+params.Encode(), &body); err != nil {
+		return nil, models.UsageStat{}, err
+	}
+	return body.Usage, body.Total, nil
+}
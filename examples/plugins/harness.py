@@ -0,0 +1,76 @@
+#!/usr/bin/env python3
+"""Offline test harness for PIPE guardrail plugins.
+
+Starts a stdio plugin, checks its health, runs every case from a JSON file
+and compares the verdicts. Exits non-zero when any case fails.
+
+  python3 harness.py --cases cases.json -- python3 keyword_detector.py
+"""
+import argparse
+import json
+import subprocess
+import sys
+
+
+class Plugin:
+    def __init__(self, argv):
+        self.proc = subprocess.Popen(argv, stdin=subprocess.PIPE, stdout=subprocess.PIPE, text=True)
+        self.next_id = 0
+
+    def call(self, method, params=None):
+        self.next_id += 1
+        req = {"jsonrpc": "2.0", "id": self.next_id, "method": method, "params": params or {}}
+        self.proc.stdin.write(json.dumps(req) + "\n")
+        self.proc.stdin.flush()
+        while True:
+            line = self.proc.stdout.readline()
+            if not line:
+                raise RuntimeError("plugin exited with code %s" % self.proc.poll())
+            resp = json.loads(line)
+            if resp.get("id") != self.next_id:
+                continue
+            if resp.get("error"):
+                raise RuntimeError(resp["error"].get("message"))
+            return resp["result"]
+
+    def close(self):
+        self.proc.stdin.close()
+        self.proc.wait(timeout=5)
+
+
+def main():
+    parser = argparse.ArgumentParser()
+    parser.add_argument("--cases", required=True)
+    parser.add_argument("command", nargs=argparse.REMAINDER)
+    args = parser.parse_args()
+    argv = args.command[1:] if args.command[:1] == ["--"] else args.command
+    if not argv:
+        parser.error("plugin command is required after --")
+
+    with open(args.cases) as f:
+        cases = json.load(f)
+
+    plugin = Plugin(argv)
+    failed = 0
+    try:
+        health = plugin.call("health")
+        if health.get("status") != "ok":
+            print("FAIL health: %s" % health)
+            return 1
+        for case in cases:
+            params = {"phase": case.get("phase", "pre"), "prompt": case.get("prompt", ""), "output": case.get("output", "")}
+            result = plugin.call("check", params)
+            ok = result.get("passed") == case["expectPassed"]
+            if "expectAction" in case and not result.get("passed"):
+                ok = ok and result.get("action") == case["expectAction"]
+            failed += not ok
+            print("%s %s: %s" % ("PASS" if ok else "FAIL", case["name"], result.get("message")))
+    finally:
+        plugin.close()
+
+    print("%d/%d cases passed" % (len(cases) - failed, len(cases)))
+    return 1 if failed else 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -0,0 +1,110 @@
+#!/usr/bin/env python3
+"""Reference PIPE guardrail plugin.
+
+Speaks JSON-RPC 2.0 over newline-delimited stdio by default, or serves
+POST /check and GET /health with --http HOST:PORT. Only the standard
+library is used so it runs anywhere Python 3 does.
+
+Methods:
+  health -> {"status": "ok"}
+  check  -> {"passed": bool, "message": str, "action": str, "score": float}
+"""
+import argparse
+import json
+import os
+import sys
+from http.server import BaseHTTPRequestHandler, HTTPServer
+
+DEFAULT_KEYWORDS = ["password", "api key", "secret token", "credit card number"]
+
+
+def load_keywords():
+    raw = os.environ.get("KEYWORDS", "")
+    if raw:
+        return [k.strip().lower() for k in raw.split(",") if k.strip()]
+    return DEFAULT_KEYWORDS
+
+
+KEYWORDS = load_keywords()
+
+
+def check(params):
+    text = (params.get("prompt", "") + "\n" + params.get("output", "")).lower()
+    hits = [k for k in KEYWORDS if k in text]
+    if hits:
+        return {
+            "passed": False,
+            "message": "sensitive keywords: " + ", ".join(hits),
+            "action": "block",
+            "score": float(len(hits)),
+        }
+    return {"passed": True, "message": "no sensitive keywords", "action": "", "score": 0.0}
+
+
+def handle(method, params):
+    if method == "health":
+        return {"status": "ok"}
+    if method == "check":
+        return check(params or {})
+    raise KeyError(method)
+
+
+def serve_stdio():
+    for line in sys.stdin:
+        line = line.strip()
+        if not line:
+            continue
+        try:
+            req = json.loads(line)
+        except ValueError:
+            continue
+        resp = {"jsonrpc": "2.0", "id": req.get("id")}
+        try:
+            resp["result"] = handle(req.get("method"), req.get("params"))
+        except KeyError:
+            resp["error"] = {"code": -32601, "message": "method not found"}
+        except Exception as exc:  # report, keep serving
+            resp["error"] = {"code": -32000, "message": str(exc)}
+        sys.stdout.write(json.dumps(resp) + "\n")
+        sys.stdout.flush()
+
+
+class Handler(BaseHTTPRequestHandler):
+    def _reply(self, status, body):
+        data = json.dumps(body).encode()
+        self.send_response(status)
+        self.send_header("Content-Type", "application/json")
+        self.send_header("Content-Length", str(len(data)))
+        self.end_headers()
+        self.wfile.write(data)
+
+    def do_GET(self):
+        if self.path == "/health":
+            self._reply(200, handle("health", None))
+        else:
+            self._reply(404, {"error": "not found"})
+
+    def do_POST(self):
+        if self.path != "/check":
+            self._reply(404, {"error": "not found"})
+            return
+        length = int(self.headers.get("Content-Length", 0))
+        self._reply(200, handle("check", json.loads(self.rfile.read(length) or b"{}")))
+
+    def log_message(self, fmt, *args):
+        sys.stderr.write(fmt % args + "\n")
+
+
+def main():
+    parser = argparse.ArgumentParser()
+    parser.add_argument("--http", help="serve HTTP on HOST:PORT instead of stdio")
+    args = parser.parse_args()
+    if args.http:
+        host, port = args.http.rsplit(":", 1)
+        HTTPServer((host, int(port)), Handler).serve_forever()
+    else:
+        serve_stdio()
+
+
+if __name__ == "__main__":
+    main()
@@ -1,24 +1,50 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/Promptonauts/pipe/pkg/api"
+	"github.com/Promptonauts/pipe/pkg/approval"
 	"github.com/Promptonauts/pipe/pkg/controlplane"
+	"github.com/Promptonauts/pipe/pkg/events"
 	"github.com/Promptonauts/pipe/pkg/executor"
 	"github.com/Promptonauts/pipe/pkg/guardrails"
+	"github.com/Promptonauts/pipe/pkg/models"
 	"github.com/Promptonauts/pipe/pkg/observability"
 	"github.com/Promptonauts/pipe/pkg/scheduler"
+	"github.com/Promptonauts/pipe/pkg/slo"
 	"github.com/Promptonauts/pipe/pkg/store"
+	"github.com/Promptonauts/pipe/pkg/usage"
 )
 
 func main() {
+	logCfg, err := observability.LogConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid logging configuration: %v", err)
+	}
+	closeLogs, err := observability.ConfigureLogging(logCfg)
+	if err != nil {
+		log.Fatalf("failed to configure logging: %v", err)
+	}
+	defer closeLogs()
+
 	logger := observability.NewLogger("pipe-server")
 	metrics := observability.NewMetricsRegistry()
 
+	traceCfg, err := observability.TraceConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid tracing configuration: %v", err)
+	}
+	tracer := observability.NewTracer(logger)
+	if err := observability.ConfigureTracing(tracer, traceCfg, logger); err != nil {
+		log.Fatalf("failed to configure tracing: %v", err)
+	}
+
 	db, err := store.NewSQLiteStore("pipe.db")
 	if err != nil {
 		log.Fatalf("failed to initialize store: %v", err)
@@ -29,7 +55,37 @@ func main() {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
 
+	stopMetrics := make(chan struct{})
+	go metrics.PruneDeleted(db, stopMetrics)
+	go metrics.RecordLatencies(db.WatchExecutions())
+	go slo.ObserveExecutions(metrics, db.WatchExecutions())
+
+	// Keep execution spans locally too, for GET /executions/:id/trace.
+	spans := observability.NewStoreExporter(db, logger)
+	tracer.RegisterProcessor(observability.NewBatchProcessor(spans, logger, observability.BatchOptions{}))
+	spans.StartPruning(7*24*time.Hour, time.Hour, stopMetrics)
+
+	var prices models.PriceTable
+	if path := os.Getenv("PIPE_PRICE_FILE"); path != "" {
+		if prices, err = usage.LoadPriceTable(path); err != nil {
+			log.Fatalf("failed to load price table: %v", err)
+		}
+	}
+	meter := usage.NewMeter(db, prices, metrics, logger)
+
 	guardrailEngine := guardrails.NewEngine(metrics, logger)
+	guardrailEngine.SetTracer(tracer)
+	guardrailEngine.SetStore(db)
+	guardrailEngine.SetMeter(meter)
+	stopGuardrails := make(chan struct{})
+	go guardrailEngine.ReleaseFinished(db, stopGuardrails)
+	go guardrailEngine.Run(db, stopGuardrails)
+	recorder := events.NewRecorder(db, logger)
+	guardrailEngine.SetEvents(recorder.WithSource("guardrails"))
+	go recorder.WithSource("executor").RecordTransitions(db.WatchExecutions())
+	approvals := approval.NewManager(db, logger, approval.Config{})
+	approvals.Events = recorder.WithSource("approval")
+	guardrailEngine.SetApprovals(approvals)
 	execEngine := executor.NewEngine(db, guardrailEngine, metrics, logger)
 	sched := scheduler.NewScheduler(execEngine, logger, metrics, scheduler.Config{
 		MaxConcurrency:    10,
@@ -38,13 +94,31 @@ func main() {
 		OverloadThreshold: 800,
 	})
 
+	// An approved execution is back in Pending; queue it again so it
+	// resumes from its checkpoint.
+	approvals.OnResume = func(exec *models.ExecutionRecord) {
+		sched.Submit(exec)
+	}
+
 	reconciler := controlplane.NewReconciler(db, execEngine, sched, logger, metrics)
 	controller := controlplane.NewController(reconciler, db, logger)
+	sloEval := slo.NewEvaluator(db, metrics, recorder.WithSource("slo"), logger, slo.Config{
+		Webhook: os.Getenv("PIPE_SLO_WEBHOOK"),
+	})
 
 	go controller.Run()
 	go sched.Start()
+	go approvals.Run()
+	go sloEval.Run()
+	stopEvents := make(chan struct{})
+	recorder.StartPruning(24*time.Hour, 10*time.Minute, stopEvents)
 
-	srv := api.NewServer(db, controller, sched, metrics, logger)
+	srv := api.NewServer(db, metrics, logger)
+	srv.Approvals = approvals
+	srv.Guardrails = guardrailEngine
+	srv.SLOs = sloEval
+	srv.Tracer = tracer
+	srv.AdminToken = os.Getenv("PIPE_ADMIN_TOKEN")
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -52,13 +126,29 @@ func main() {
 	go func() {
 		<-sigCh
 		logger.Info("shutting down...")
-		sched.Stop()
-		controller.Stop()
-		os.Exit(0)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Warn("failed to finish in-flight requests", "error", err)
+		}
 	}()
 
 	logger.Info("PIPE server starting on :8080")
 	if err := srv.Run(":8080"); err != nil {
 		log.Fatalf("server failed: %v", err)
 	}
+
+	// Stop the workers before the deferred store and log file closes run.
+	sched.Stop()
+	approvals.Stop()
+	sloEval.Stop()
+	close(stopEvents)
+	close(stopGuardrails)
+	close(stopMetrics)
+	controller.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		logger.Warn("failed to flush spans", "error", err)
+	}
 }
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Promptonauts/pipe/pkg/approval"
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// handleListApprovals serves GET /api/v1/approvals, optionally filtered by
+// ?execution= and ?state= (Pending, Approved or Rejected).
+func handleListApprovals(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := models.ApprovalState(c.Query("state"))
+		switch state {
+		case "", models.ApprovalPending, models.ApprovalApproved, models.ApprovalRejected:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "state must be Pending, Approved or Rejected"})
+			return
+		}
+		approvals, err := db.ListApprovals(c.Query("execution"), state)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if approvals == nil {
+			approvals = []*models.ApprovalRequest{}
+		}
+		c.JSON(http.StatusOK, gin.H{"approvals": approvals})
+	}
+}
+
+type decisionRequest struct {
+	By     string `json:"by"`
+	Reason string `json:"reason"`
+}
+
+// handleDecideApproval serves POST /api/v1/executions/:id/approve and
+// /reject with an optional {"by": ..., "reason": ...} body. Deciding an
+// execution that is not waiting, or whose approval was just decided by
+// someone else, is a conflict.
+func handleDecideApproval(m *approval.Manager, state models.ApprovalState) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req decisionRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if req.By == "" {
+			req.By = "api"
+		}
+
+		decide := m.Approve
+		if state == models.ApprovalRejected {
+			decide = m.Reject
+		}
+		a, err := decide(c.Param("id"), req.By, req.Reason)
+		switch {
+		case errors.Is(err, approval.ErrNoPendingApproval), errors.Is(err, models.ErrApprovalDecided):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, a)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// handleListEvents serves GET /api/v1/events.
+//
+// Query parameters: kind, namespace and name of the involved object, type
+// (Normal or Warning), since (RFC 3339 or a duration back from now) and
+// limit (default 100).
+func handleListEvents(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := models.EventQuery{
+			Namespace: c.Query("namespace"),
+			Name:      c.Query("name"),
+			Type:      models.EventType(c.Query("type")),
+			Limit:     100,
+		}
+		if k := c.Query("kind"); k != "" {
+			kind, err := models.ParseResourceKind(k)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			q.Kind = kind
+		}
+		if q.Type != "" && q.Type != models.EventNormal && q.Type != models.EventWarning {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "type must be Normal or Warning"})
+			return
+		}
+		var err error
+		if q.Since, err = parseTimeParam(c.Query("since"), time.Now().UTC(), time.Time{}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since: " + err.Error()})
+			return
+		}
+		if l := c.Query("limit"); l != "" {
+			if q.Limit, err = strconv.Atoi(l); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be an integer"})
+				return
+			}
+		}
+
+		events, err := db.ListEvents(q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if events == nil {
+			events = []*models.Event{}
+		}
+		c.JSON(http.StatusOK, gin.H{"events": events})
+	}
+}
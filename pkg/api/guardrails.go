@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Promptonauts/pipe/pkg/guardrails"
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+type toolCallRequest struct {
+	ExecutionID string                 `json:"executionId"`
+	Step        int                    `json:"step"`
+	Agent       string                 `json:"agent" binding:"required"`
+	Namespace   string                 `json:"namespace"`
+	Tool        string                 `json:"tool" binding:"required"`
+	Args        map[string]interface{} `json:"args"`
+	Target      string                 `json:"target"`
+	Metadata    map[string]interface{} `json:"metadata"`
+}
+
+// handleCheckToolCall serves POST /api/v1/guardrails/tool-calls: runtimes
+// that run tools out of process ask whether a tool call the model picked
+// may run. The reply is 200 with "allowed" false when a guardrail blocks or
+// escalates it, and lists every guardrail's verdict.
+func handleCheckToolCall(engine *guardrails.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req toolCallRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Namespace == "" {
+			req.Namespace = "default"
+		}
+
+		results, err := engine.RunTool(c.Request.Context(), guardrails.CheckInput{
+			AgentName:   req.Agent,
+			Namespace:   req.Namespace,
+			ToolName:    req.Tool,
+			ToolArgs:    req.Args,
+			ToolTarget:  req.Target,
+			ExecutionID: req.ExecutionID,
+			StepIndex:   req.Step,
+			Metadata:    req.Metadata,
+		})
+		verdicts := make([]models.GuardrailVerdict, 0, len(results))
+		for _, r := range results {
+			verdicts = append(verdicts, models.GuardrailVerdict{
+				ExecutionID: req.ExecutionID,
+				GuardrailID: r.GuardrailID,
+				Phase:       string(r.Phase),
+				Step:        r.Step,
+				Passed:      r.Passed,
+				Action:      r.Action,
+				Message:     r.Message,
+				Shadow:      r.Shadow,
+				LatencyMs:   float64(r.Latency.Microseconds()) / 1000,
+			})
+		}
+
+		resp := gin.H{"allowed": err == nil, "verdicts": verdicts}
+		var esc *guardrails.EscalationError
+		if errors.As(err, &esc) {
+			resp["escalated"] = true
+		}
+		if err != nil {
+			resp["reason"] = err.Error()
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
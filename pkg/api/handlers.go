@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+func handleHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleGetExecution serves GET /api/v1/executions/:id: the execution
+// record with its guardrail verdicts.
+func handleGetExecution(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exec, err := db.GetExecution(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, exec)
+	}
+}
+
+// handleListExecutions serves GET /api/v1/executions, newest first,
+// optionally filtered by ?namespace= and capped by ?limit= (default 50).
+func handleListExecutions(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 50
+		if l := c.Query("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be an integer"})
+				return
+			}
+		}
+		execs, err := db.ListExecutions(c.Query("namespace"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if execs == nil {
+			execs = []*models.ExecutionRecord{}
+		}
+		c.JSON(http.StatusOK, gin.H{"executions": execs})
+	}
+}
+
+// handleExecutionLogs serves GET /api/v1/executions/:id/logs.
+func handleExecutionLogs(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logs, err := db.GetExecutionLogs(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if logs == nil {
+			logs = []models.ExecutionLog{}
+		}
+		c.JSON(http.StatusOK, gin.H{"logs": logs})
+	}
+}
+
+// handleExecutionVerdicts serves GET /api/v1/executions/:id/verdicts: every
+// guardrail verdict recorded for the execution, in check order.
+func handleExecutionVerdicts(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		verdicts, err := db.GetGuardrailVerdicts(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if verdicts == nil {
+			verdicts = []models.GuardrailVerdict{}
+		}
+		c.JSON(http.StatusOK, gin.H{"verdicts": verdicts})
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/gin-gonic/gin"
+)
+
+type logLevelsResponse struct {
+	Default    string            `json:"default"`
+	Components map[string]string `json:"components"`
+	Spec       string            `json:"spec"`
+}
+
+// handleGetLogLevels serves GET /admin/log-levels: the default level, the
+// per-component overrides and the spec that reproduces them.
+func handleGetLogLevels(c *gin.Context) {
+	c.JSON(http.StatusOK, currentLogLevels())
+}
+
+// handleSetLogLevels serves PUT and POST /admin/log-levels, changing levels
+// without a restart. The body is either a spec such as
+// "guardrails=debug,store=warn" or {"levels": "<spec>"}; the ?levels=
+// query parameter works too.
+func handleSetLogLevels(logger *observability.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		spec, err := readLevelSpec(c)
+		if err == nil {
+			err = observability.SetLogLevels(spec)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Info("log levels changed", "levels", spec)
+		c.JSON(http.StatusOK, currentLogLevels())
+	}
+}
+
+func currentLogLevels() logLevelsResponse {
+	def, overrides := observability.LogLevels()
+	resp := logLevelsResponse{
+		Default:    strings.ToLower(def.String()),
+		Components: make(map[string]string, len(overrides)),
+		Spec:       observability.FormatLogLevels(def, overrides),
+	}
+	for k, v := range overrides {
+		resp.Components[k] = strings.ToLower(v.String())
+	}
+	return resp
+}
+
+func readLevelSpec(c *gin.Context) (string, error) {
+	if q := c.Query("levels"); q != "" {
+		return q, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	if trimmed := strings.TrimSpace(string(body)); !strings.HasPrefix(trimmed, "{") {
+		return trimmed, nil
+	}
+	var v struct {
+		Levels string `json:"levels"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", err
+	}
+	return v.Levels, nil
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/Promptonauts/pipe/pkg/approval"
+	"github.com/Promptonauts/pipe/pkg/guardrails"
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/Promptonauts/pipe/pkg/slo"
+	"github.com/Promptonauts/pipe/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// Server serves the PIPE HTTP API. Optional components are set on the
+// exported fields before Run; routes backed by a component that is not set
+// are not registered.
+type Server struct {
+	db      store.Store
+	metrics *observability.MetricsRegistry
+	logger  *observability.Logger
+
+	mu       sync.Mutex
+	http     *http.Server
+	shutdown bool
+
+	// Approvals decides escalated executions.
+	Approvals *approval.Manager
+
+	// Guardrails reports on the guardrails the executor runs.
+	Guardrails *guardrails.Engine
+
+	// SLOs reports the latest evaluation of every SLO.
+	SLOs *slo.Evaluator
+
+	// Tracer records a server span per request, continuing the caller's
+	// trace from its traceparent header.
+	Tracer *observability.Tracer
+
+	// AdminToken guards the /admin routes, which callers must send as
+	// "Authorization: Bearer <token>". The routes are not served without
+	// one.
+	AdminToken string
+}
+
+func NewServer(db store.Store, metrics *observability.MetricsRegistry, logger *observability.Logger) *Server {
+	return &Server{
+		db:      db,
+		metrics: metrics,
+		logger:  logger.With("api"),
+	}
+}
+
+// Handler returns the router with every route registered.
+func (s *Server) Handler() http.Handler {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(gin.Recovery())
+	if s.Tracer != nil {
+		r.Use(tracingMiddleware(s.Tracer))
+	}
+
+	r.GET("/healthz", handleHealth)
+	if s.metrics != nil {
+		metrics := gin.WrapH(s.metrics.Handler())
+		r.GET("/metrics", metrics)
+		r.HEAD("/metrics", metrics)
+	}
+
+	if s.AdminToken != "" {
+		admin := r.Group("/admin", requireToken(s.AdminToken))
+		admin.GET("/log-levels", handleGetLogLevels)
+		admin.PUT("/log-levels", handleSetLogLevels(s.logger))
+		admin.POST("/log-levels", handleSetLogLevels(s.logger))
+	}
+
+	v1 := r.Group("/api/v1")
+	v1.GET("/executions", handleListExecutions(s.db))
+	v1.GET("/executions/:id", handleGetExecution(s.db))
+	v1.GET("/executions/:id/logs", handleExecutionLogs(s.db))
+	v1.GET("/executions/:id/verdicts", handleExecutionVerdicts(s.db))
+	v1.GET("/executions/:id/trace", handleExecutionTrace(s.db))
+	v1.GET("/executions/:id/usage", handleExecutionUsage(s.db))
+	v1.GET("/guardrails/violations", handleGuardrailViolations(s.db))
+	v1.GET("/events", handleListEvents(s.db))
+	v1.GET("/usage", handleUsageReport(s.db))
+	if s.Approvals != nil {
+		v1.GET("/approvals", handleListApprovals(s.db))
+		v1.POST("/executions/:id/approve", handleDecideApproval(s.Approvals, models.ApprovalApproved))
+		v1.POST("/executions/:id/reject", handleDecideApproval(s.Approvals, models.ApprovalRejected))
+	}
+	if s.Guardrails != nil {
+		v1.GET("/guardrails/shadow", handleShadowReport(s.Guardrails))
+		v1.POST("/guardrails/tool-calls", handleCheckToolCall(s.Guardrails))
+	}
+	if s.SLOs != nil {
+		v1.GET("/slos/status", handleSLOStatus(s.SLOs))
+	}
+	return r
+}
+
+// requireToken rejects requests that do not carry token as a bearer
+// token.
+func requireToken(token string) gin.HandlerFunc {
+	want := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		got := []byte(c.GetHeader("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "admin token required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Run serves the API on addr until Shutdown is called.
+func (s *Server) Run(addr string) error {
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		return nil
+	}
+	srv := &http.Server{Addr: addr, Handler: s.Handler()}
+	s.http = srv
+	s.mu.Unlock()
+
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting requests and waits for the ones in flight. Run
+// returns once it has; called before Run, it makes Run return at once.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	srv := s.http
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,482 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/approval"
+	"github.com/Promptonauts/pipe/pkg/guardrails"
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/Promptonauts/pipe/pkg/slo"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+func newTestServer(t *testing.T) (*Server, *store.SQLiteStore) {
+	t.Helper()
+	db, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "pipe.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(db, observability.NewMetricsRegistry(), observability.NewLogger("test")), db
+}
+
+func serve(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestApproveResumesOnce(t *testing.T) {
+	srv, db := newTestServer(t)
+	m := approval.NewManager(db, observability.NewLogger("test"), approval.Config{})
+	var resumed []string
+	m.OnResume = func(exec *models.ExecutionRecord) { resumed = append(resumed, exec.ID) }
+	srv.Approvals = m
+
+	exec := &models.ExecutionRecord{AgentName: "a", Namespace: "default", State: models.ExecRunning}
+	if err := db.CreateExecution(exec); err != nil {
+		t.Fatal(err)
+	}
+	esc := &guardrails.EscalationError{Result: guardrails.CheckResult{GuardrailID: "pii", Message: "contains an email"}, Step: 2}
+	if err := m.EscalateExecution(exec.ID, esc); err != nil {
+		t.Fatal(err)
+	}
+
+	h := srv.Handler()
+	if w := serve(h, http.MethodPost, "/api/v1/executions/"+exec.ID+"/approve", `{"by":"alice","reason":"ok"}`); w.Code != http.StatusOK {
+		t.Fatalf("approve: %d %s", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodPost, "/api/v1/executions/"+exec.ID+"/reject", ""); w.Code != http.StatusConflict {
+		t.Fatalf("reject after approve: %d %s, want 409", w.Code, w.Body)
+	}
+	if len(resumed) != 1 || resumed[0] != exec.ID {
+		t.Fatalf("resumed %v, want [%s]", resumed, exec.ID)
+	}
+	if !m.IsApproved(exec.ID, "pii", 2) {
+		t.Fatal("approval not recorded")
+	}
+}
+
+func TestStaleApprovalDecisionConflicts(t *testing.T) {
+	_, db := newTestServer(t)
+	a := &models.ApprovalRequest{ExecutionID: "e1", GuardrailID: "g", State: models.ApprovalPending}
+	if err := db.CreateApproval(a); err != nil {
+		t.Fatal(err)
+	}
+	approved, expired := *a, *a
+	approved.State = models.ApprovalApproved
+	expired.State = models.ApprovalRejected
+	if err := db.UpdateApproval(&approved); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateApproval(&expired); err == nil {
+		t.Fatal("second decision on the same approval succeeded")
+	}
+}
+
+func TestGetExecutionIncludesVerdicts(t *testing.T) {
+	srv, db := newTestServer(t)
+	exec := &models.ExecutionRecord{AgentName: "a", Namespace: "default", State: models.ExecRunning}
+	if err := db.CreateExecution(exec); err != nil {
+		t.Fatal(err)
+	}
+	verdicts := []models.GuardrailVerdict{
+		{GuardrailID: "pii", Phase: "post", Step: 1, Passed: true},
+		{GuardrailID: "toxicity", Phase: "post", Step: 1, Passed: false, Action: "block", Message: "toxic"},
+	}
+	if err := db.AppendGuardrailVerdicts(exec.ID, verdicts); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(srv.Handler(), http.MethodGet, "/api/v1/executions/"+exec.ID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get: %d %s", w.Code, w.Body)
+	}
+	var got models.ExecutionRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Verdicts) != 2 || got.Verdicts[1].GuardrailID != "toxicity" || got.Verdicts[1].Action != "block" {
+		t.Fatalf("verdicts = %+v", got.Verdicts)
+	}
+
+	if w := serve(srv.Handler(), http.MethodGet, "/api/v1/executions/missing", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing execution: %d, want 404", w.Code)
+	}
+}
+
+func TestCheckToolCall(t *testing.T) {
+	srv, _ := newTestServer(t)
+	engine := guardrails.NewEngine(observability.NewMetricsRegistry(), observability.NewLogger("test"))
+	engine.Register(&guardrails.ToolAllowlistGuardrail{Allowed: map[string][]string{"researcher": {"search"}}})
+	srv.Guardrails = engine
+	h := srv.Handler()
+
+	tests := []struct {
+		tool    string
+		allowed bool
+	}{
+		{"search", true},
+		{"shell", false},
+	}
+	for _, tt := range tests {
+		w := serve(h, http.MethodPost, "/api/v1/guardrails/tool-calls", `{"agent":"researcher","tool":"`+tt.tool+`"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", tt.tool, w.Code, w.Body)
+		}
+		var body struct {
+			Allowed  bool                      `json:"allowed"`
+			Verdicts []models.GuardrailVerdict `json:"verdicts"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Allowed != tt.allowed || len(body.Verdicts) == 0 {
+			t.Fatalf("%s: %s, want allowed=%v", tt.tool, w.Body, tt.allowed)
+		}
+	}
+
+	if w := serve(h, http.MethodPost, "/api/v1/guardrails/tool-calls", `{"agent":"researcher"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("missing tool: %d, want 400", w.Code)
+	}
+}
+
+func TestGuardrailViolationsRoute(t *testing.T) {
+	srv, db := newTestServer(t)
+	v := models.GuardrailVerdict{GuardrailID: "pii", AgentName: "a", Namespace: "default", Phase: "post", Action: "block", Message: "m", Timestamp: time.Now().UTC()}
+	if err := db.AppendGuardrailVerdicts("e1", []models.GuardrailVerdict{v}); err != nil {
+		t.Fatal(err)
+	}
+	h := srv.Handler()
+
+	w := serve(h, http.MethodGet, "/api/v1/guardrails/violations?since=1h&groupBy=guardrail,agent", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("violations: %d %s", w.Code, w.Body)
+	}
+	var body struct {
+		Violations []models.ViolationStat `json:"violations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Violations) != 1 || body.Violations[0].GuardrailID != "pii" || body.Violations[0].AgentName != "a" || body.Violations[0].Count != 1 {
+		t.Fatalf("violations = %+v", body.Violations)
+	}
+
+	if w := serve(h, http.MethodGet, "/api/v1/guardrails/violations?groupBy=model", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad groupBy: %d, want 400", w.Code)
+	}
+	if w := serve(h, http.MethodGet, "/api/v1/guardrails/violations?since=7d&window=1d", ""); w.Code != http.StatusOK {
+		t.Fatalf("daily window: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestMetricsRoute(t *testing.T) {
+	srv, _ := newTestServer(t)
+	srv.metrics.Counter("executions.total").Inc()
+	h := srv.Handler()
+
+	w := serve(h, http.MethodGet, "/metrics", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "executions_total 1\n") {
+		t.Fatalf("metrics: %d %s", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodHead, "/metrics", ""); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Fatalf("HEAD metrics: %d, %d bytes", w.Code, w.Body.Len())
+	}
+}
+
+type recordedSpans struct {
+	mu    sync.Mutex
+	spans []*observability.Span
+}
+
+func (r *recordedSpans) OnEnd(s *observability.Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *recordedSpans) Shutdown(context.Context) error { return nil }
+
+func TestTracingMiddlewareContinuesTrace(t *testing.T) {
+	srv, _ := newTestServer(t)
+	srv.Tracer = observability.NewTracer(observability.NewLogger("test"))
+	spans := &recordedSpans{}
+	srv.Tracer.RegisterProcessor(spans)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/executions/missing", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=a")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if len(spans.spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans.spans))
+	}
+	span := spans.spans[0]
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentID != "00f067aa0ba902b7" || span.Kind != observability.SpanKindServer {
+		t.Errorf("span %s/%s kind %q did not continue the caller's trace as a server span", span.TraceID, span.ParentID, span.Kind)
+	}
+	if span.Operation != "GET /api/v1/executions/:id" || span.Tags["http.status_code"] != "404" {
+		t.Errorf("span %q tags %v", span.Operation, span.Tags)
+	}
+	out, err := observability.ParseTraceparent(w.Header().Get("traceparent"))
+	if err != nil || out.TraceID != span.TraceID || out.SpanID != span.SpanID {
+		t.Errorf("response traceparent %q, want span %s", w.Header().Get("traceparent"), span.SpanID)
+	}
+	if got := w.Header().Get("tracestate"); got != "vendor=a" {
+		t.Errorf("response tracestate = %q", got)
+	}
+}
+
+func TestExecutionTraceRoute(t *testing.T) {
+	srv, db := newTestServer(t)
+	if err := db.CreateExecution(&models.ExecutionRecord{ID: "e1", AgentName: "researcher", Namespace: "default", State: models.ExecRunning}); err != nil {
+		t.Fatal(err)
+	}
+	tracer := observability.NewTracer(observability.NewLogger("test"))
+	tracer.RegisterProcessor(observability.NewBatchProcessor(observability.NewStoreExporter(db, observability.NewLogger("test")), observability.NewLogger("test"), observability.BatchOptions{}))
+	engine := guardrails.NewEngine(observability.NewMetricsRegistry(), observability.NewLogger("test"))
+	engine.Register(&guardrails.ToolAllowlistGuardrail{Allowed: map[string][]string{"researcher": {"search"}}})
+	engine.SetTracer(tracer)
+	if _, err := engine.RunTool(context.Background(), guardrails.CheckInput{ExecutionID: "e1", AgentName: "researcher", ToolName: "search"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(srv.Handler(), http.MethodGet, "/api/v1/executions/e1/trace", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("trace: %d %s", w.Code, w.Body)
+	}
+	var trace models.ExecutionTrace
+	if err := json.Unmarshal(w.Body.Bytes(), &trace); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, n := range trace.Roots {
+		found = found || (n.Operation == "guardrail tool-allowlist" && n.ExecutionID == "e1")
+	}
+	if !found || trace.SpanCount != len(trace.Roots) {
+		t.Fatalf("trace = %s, want the tool-allowlist check span", w.Body)
+	}
+
+	if w := serve(srv.Handler(), http.MethodGet, "/api/v1/executions/missing/trace", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing execution: %d, want 404", w.Code)
+	}
+}
+
+func TestLogLevelsRoute(t *testing.T) {
+	srv, _ := newTestServer(t)
+	srv.AdminToken = "secret"
+	h := srv.Handler()
+	t.Cleanup(func() { observability.SetLogLevels("info,guardrails=default") })
+	admin := func(method, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/log-levels", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := admin(http.MethodPut, "guardrails=debug", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("put: %d %s", w.Code, w.Body)
+	}
+	w = admin(http.MethodGet, "", "secret")
+	var body struct {
+		Components map[string]string `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Components["guardrails"] != "debug" {
+		t.Fatalf("get: %d %s", w.Code, w.Body)
+	}
+	if w := admin(http.MethodPost, `{"levels":"store=loud"}`, "secret"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid level: %d, want 400", w.Code)
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if w := admin(http.MethodPut, "guardrails=error", token); w.Code != http.StatusUnauthorized {
+			t.Errorf("put with token %q: %d, want 401", token, w.Code)
+		}
+	}
+	if w := admin(http.MethodGet, "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("get without a token: %d, want 401", w.Code)
+	}
+
+	srv.AdminToken = ""
+	if w := serve(srv.Handler(), http.MethodGet, "/admin/log-levels", ""); w.Code != http.StatusNotFound {
+		t.Errorf("without an admin token: %d, want 404", w.Code)
+	}
+}
+
+func TestShutdownStopsRun(t *testing.T) {
+	srv, _ := newTestServer(t)
+	done := make(chan error, 1)
+	go func() { done <- srv.Run("127.0.0.1:0") }()
+
+	// Shutdown may land before or after Run starts listening; either way
+	// Run must return.
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Run did not return after Shutdown")
+		}
+	}
+}
+
+func TestListEventsRoute(t *testing.T) {
+	srv, db := newTestServer(t)
+	for _, e := range []*models.Event{
+		{InvolvedObject: models.ObjectReference{Kind: models.KindAgent, Namespace: "default", Name: "foo"}, Type: models.EventWarning, Reason: "NotReady", Message: "tool missing"},
+		{InvolvedObject: models.ObjectReference{Kind: models.KindAgent, Namespace: "default", Name: "bar"}, Type: models.EventNormal, Reason: "Ready", Message: "ready"},
+	} {
+		if err := db.RecordEvent(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := srv.Handler()
+
+	w := serve(h, http.MethodGet, "/api/v1/events?kind=Agent&name=foo&since=1h", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("events: %d %s", w.Code, w.Body)
+	}
+	var body struct {
+		Events []*models.Event `json:"events"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Events) != 1 || body.Events[0].Reason != "NotReady" {
+		t.Fatalf("events = %s", w.Body)
+	}
+
+	if w := serve(h, http.MethodGet, "/api/v1/events?type=Loud", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad type: %d, want 400", w.Code)
+	}
+}
+
+func TestUsageRoutes(t *testing.T) {
+	srv, db := newTestServer(t)
+	exec := &models.ExecutionRecord{ID: "exec-1", AgentName: "writer", Namespace: "default", State: models.ExecRunning}
+	if err := db.CreateExecution(exec); err != nil {
+		t.Fatal(err)
+	}
+	for step, tokens := range []int64{100, 300} {
+		u := &models.UsageRecord{ExecutionID: exec.ID, AgentName: "writer", Namespace: "default", Step: step, Provider: "openai", Model: "gpt-4o",
+			PromptTokens: tokens, CompletionTokens: tokens / 2, Cost: float64(tokens) / 1000, Priced: true}
+		if err := db.RecordUsage(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := srv.Handler()
+
+	w := serve(h, http.MethodGet, "/api/v1/executions/exec-1/usage", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("execution usage: %d %s", w.Code, w.Body)
+	}
+	var calls struct {
+		TotalTokens int64                `json:"totalTokens"`
+		Cost        float64              `json:"cost"`
+		Calls       []models.UsageRecord `json:"calls"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &calls); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls.Calls) != 2 || calls.TotalTokens != 600 || calls.Cost < 0.399 || calls.Cost > 0.401 {
+		t.Fatalf("execution usage = %s", w.Body)
+	}
+
+	w = serve(h, http.MethodGet, "/api/v1/usage?since=1d&groupBy=agent,model", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("usage report: %d %s", w.Code, w.Body)
+	}
+	var report struct {
+		Usage []models.UsageStat `json:"usage"`
+		Total models.UsageStat   `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Usage) != 1 || report.Usage[0].AgentName != "writer" || report.Usage[0].Model != "gpt-4o" || report.Total.Calls != 2 {
+		t.Fatalf("usage report = %s", w.Body)
+	}
+
+	if w := serve(h, http.MethodGet, "/api/v1/usage?groupBy=color", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad groupBy: %d, want 400", w.Code)
+	}
+	if w := serve(h, http.MethodGet, "/api/v1/executions/missing/usage", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing execution: %d, want 404", w.Code)
+	}
+}
+
+func TestSLOStatusRoute(t *testing.T) {
+	srv, _ := newTestServer(t)
+	logger := observability.NewLogger("test")
+	srv.SLOs = slo.NewEvaluator(nil, observability.NewMetricsRegistry(), nil, logger, slo.Config{})
+	t.Cleanup(srv.SLOs.Stop)
+	err := srv.SLOs.Apply(&models.GenericResource{
+		APIVersion: "pipe/v1",
+		Kind:       models.KindSLO,
+		Metadata:   models.Metadata{Name: "writer-success", Namespace: "default", Version: "1"},
+		Spec: map[string]interface{}{
+			"agent":     "writer",
+			"objective": map[string]interface{}{"type": "success-ratio", "target": 0.99},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := srv.Handler()
+
+	var body struct {
+		SLOs []slo.Status `json:"slos"`
+	}
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"", 1},
+		{"?namespace=default", 1},
+		{"?namespace=other", 0},
+	} {
+		w := serve(h, http.MethodGet, "/api/v1/slos/status"+tc.query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: %d %s", tc.query, w.Code, w.Body)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.SLOs) != tc.want {
+			t.Fatalf("%q: slos = %s", tc.query, w.Body)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/guardrails"
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// handleShadowReport serves GET /api/v1/guardrails/shadow: what each
+// shadow-mode guardrail would have done had it been enforced, over the
+// verdicts since ?since= (RFC 3339 or a duration back from now, default 7d).
+func handleShadowReport(engine *guardrails.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now().UTC()
+		since, err := parseTimeParam(c.Query("since"), now, now.Add(-7*24*time.Hour))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since: " + err.Error()})
+			return
+		}
+		stats, err := engine.ShadowReport(since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if stats == nil {
+			stats = []models.ShadowStats{}
+		}
+		c.JSON(http.StatusOK, gin.H{"since": since, "guardrails": stats})
+	}
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Promptonauts/pipe/pkg/slo"
+	"github.com/gin-gonic/gin"
+)
+
+// handleSLOStatus serves GET /api/v1/slos/status: the latest SLI and burn
+// rates of every SLO, optionally filtered by ?namespace=.
+func handleSLOStatus(ev *slo.Evaluator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ns := c.Query("namespace")
+		out := []slo.Status{}
+		for _, st := range ev.Statuses() {
+			if ns == "" || st.Namespace == ns {
+				out = append(out, st)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"slos": out})
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/Promptonauts/pipe/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// handleExecutionTrace serves GET /api/v1/executions/:id/trace: the spans
+// recorded for the execution as a tree with start offsets and durations.
+func handleExecutionTrace(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exec, err := db.GetExecution(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		spans, err := db.GetExecutionSpans(exec.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, observability.BuildExecutionTrace(exec.ID, spans))
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/gin-gonic/gin"
+)
+
+// tracingMiddleware continues the caller's trace from its traceparent and
+// tracestate headers, or starts a new one, and returns the server span's
+// traceparent on the response so clients can correlate what they sent.
+func tracingMiddleware(tracer *observability.Tracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := observability.Extract(c.Request.Context(), c.Request.Header)
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route)
+		span.SetKind(observability.SpanKindServer)
+		span.SetTag("http.method", c.Request.Method)
+		span.SetTag("http.route", route)
+		c.Request = c.Request.WithContext(ctx)
+		observability.Inject(ctx, c.Writer.Header())
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetTag("http.status_code", strconv.Itoa(status))
+		if status >= 500 {
+			span.SetStatus(observability.SpanStatusError, c.Errors.String())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// handleUsageReport serves GET /api/v1/usage.
+//
+// Query parameters: since and until (RFC 3339 or a duration back from now
+// such as 7d, default the last 24h), window (bucket size, e.g. 1d),
+// groupBy (comma list of execution, agent, pipeline, namespace, provider,
+// model; default agent), namespace, agent, pipeline and limit.
+func handleUsageReport(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now().UTC()
+		q := models.UsageQuery{
+			Namespace: c.Query("namespace"),
+			Agent:     c.Query("agent"),
+			Pipeline:  c.Query("pipeline"),
+			GroupBy:   []string{"agent"},
+		}
+
+		var err error
+		if q.Since, err = parseTimeParam(c.Query("since"), now, now.Add(-24*time.Hour)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since: " + err.Error()})
+			return
+		}
+		if q.Until, err = parseTimeParam(c.Query("until"), now, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until: " + err.Error()})
+			return
+		}
+		if w := c.Query("window"); w != "" {
+			if q.Window, err = models.ParseDuration(w); err != nil || q.Window <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a positive duration"})
+				return
+			}
+		}
+		if g := c.Query("groupBy"); g != "" {
+			q.GroupBy = strings.Split(g, ",")
+		}
+		if l := c.Query("limit"); l != "" {
+			if q.Limit, err = strconv.Atoi(l); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be an integer"})
+				return
+			}
+		}
+
+		stats, err := db.UsageReport(q)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var total models.UsageStat
+		for _, s := range stats {
+			total.Calls += s.Calls
+			total.PromptTokens += s.PromptTokens
+			total.CompletionTokens += s.CompletionTokens
+			total.TotalTokens += s.TotalTokens
+			total.Cost += s.Cost
+			total.UnpricedCalls += s.UnpricedCalls
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"since":  q.Since,
+			"until":  q.Until,
+			"window": q.Window.String(),
+			"usage":  stats,
+			"total":  total,
+		})
+	}
+}
+
+// handleExecutionUsage serves GET /api/v1/executions/:id/usage: every model
+// call of the execution with its tokens and cost, plus the totals.
+func handleExecutionUsage(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exec, err := db.GetExecution(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		records, err := db.GetExecutionUsage(exec.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if records == nil {
+			records = []models.UsageRecord{}
+		}
+		// The totals are summed from the calls, which the guardrail
+		// engine meters as they are checked.
+		var total models.UsageStat
+		for _, r := range records {
+			total.PromptTokens += r.PromptTokens
+			total.CompletionTokens += r.CompletionTokens
+			total.TotalTokens += r.TotalTokens()
+			total.Cost += r.Cost
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"executionId":      exec.ID,
+			"promptTokens":     total.PromptTokens,
+			"completionTokens": total.CompletionTokens,
+			"totalTokens":      total.TotalTokens,
+			"cost":             total.Cost,
+			"calls":            records,
+		})
+	}
+}
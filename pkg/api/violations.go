@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// handleGuardrailViolations serves GET /api/v1/guardrails/violations.
+//
+// Query parameters: since and until (RFC 3339 or a duration back from now,
+// default the last 24h), window (bucket size, e.g. 1h or 1d), groupBy (comma list
+// of guardrail, agent, namespace, action, phase; default guardrail),
+// namespace, agent, guardrail, shadow=true and limit.
+func handleGuardrailViolations(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now().UTC()
+		q := models.ViolationQuery{
+			Namespace: c.Query("namespace"),
+			Agent:     c.Query("agent"),
+			Guardrail: c.Query("guardrail"),
+			Shadow:    c.Query("shadow") == "true",
+			GroupBy:   []string{"guardrail"},
+		}
+
+		var err error
+		if q.Since, err = parseTimeParam(c.Query("since"), now, now.Add(-24*time.Hour)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since: " + err.Error()})
+			return
+		}
+		if q.Until, err = parseTimeParam(c.Query("until"), now, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until: " + err.Error()})
+			return
+		}
+		if w := c.Query("window"); w != "" {
+			if q.Window, err = models.ParseDuration(w); err != nil || q.Window <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a positive duration"})
+				return
+			}
+		}
+		if g := c.Query("groupBy"); g != "" {
+			q.GroupBy = strings.Split(g, ",")
+		}
+		if l := c.Query("limit"); l != "" {
+			if q.Limit, err = strconv.Atoi(l); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be an integer"})
+				return
+			}
+		}
+
+		stats, err := db.GuardrailViolations(q)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"since":      q.Since,
+			"until":      q.Until,
+			"window":     q.Window.String(),
+			"violations": stats,
+		})
+	}
+}
+
+// parseTimeParam accepts an RFC 3339 timestamp or a duration counted back
+// from now, which may use a d suffix for days (e.g. 7d).
+func parseTimeParam(v string, now, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if d, err := models.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,276 @@
+package approval
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/events"
+	"github.com/Promptonauts/pipe/pkg/guardrails"
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+)
+
+type Store interface {
+	GetExecution(id string) (*models.ExecutionRecord, error)
+	UpdateExecution(exec *models.ExecutionRecord) error
+	AppendExecutionLog(id string, log models.ExecutionLog) error
+	CreateApproval(a *models.ApprovalRequest) error
+	UpdateApproval(a *models.ApprovalRequest) error
+	GetApproval(id string) (*models.ApprovalRequest, error)
+	ListApprovals(executionID string, state models.ApprovalState) ([]*models.ApprovalRequest, error)
+}
+
+// ErrNoPendingApproval is returned by Approve and Reject when the execution
+// is not waiting for a decision.
+var ErrNoPendingApproval = errors.New("no pending approval")
+
+type Config struct {
+	Timeout         time.Duration
+	DefaultDecision models.ApprovalState
+	CheckInterval   time.Duration
+}
+
+// Manager pauses executions escalated by a guardrail and resumes or fails
+// them once a reviewer decides, or the timeout applies the default decision.
+type Manager struct {
+	store  Store
+	cfg    Config
+	logger *observability.Logger
+	stopCh chan struct{}
+
+	// OnResume, when set, is called after an approval moves an execution
+	// back to Pending so the caller can requeue it.
+	OnResume func(exec *models.ExecutionRecord)
+
+	// Events, when set, receives an event per escalation and decision.
+	Events *events.Recorder
+}
+
+func NewManager(s Store, logger *observability.Logger, cfg Config) *Manager {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Hour
+	}
+	if cfg.DefaultDecision == "" {
+		cfg.DefaultDecision = models.ApprovalRejected
+	}
+	if cfg.CheckInterval == 0 {
+		cfg.CheckInterval = 30 * time.Second
+	}
+	return &Manager{
+		store:  s,
+		cfg:    cfg,
+		logger: logger.With("approval"),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Escalate pauses exec and records a pending approval for the escalation.
+func (m *Manager) Escalate(exec *models.ExecutionRecord, esc *guardrails.EscalationError) (*models.ApprovalRequest, error) {
+	timeout, decision, err := m.policy(esc.Policy)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	a := &models.ApprovalRequest{
+		ExecutionID:     exec.ID,
+		GuardrailID:     esc.Result.GuardrailID,
+		Step:            esc.Step,
+		Message:         esc.Result.Message,
+		State:           models.ApprovalPending,
+		DefaultDecision: decision,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(timeout),
+	}
+	if err := m.store.CreateApproval(a); err != nil {
+		return nil, fmt.Errorf("create approval: %w", err)
+	}
+
+	exec.State = models.ExecPaused
+	exec.ApprovalID = a.ID
+	if err := m.store.UpdateExecution(exec); err != nil {
+		return nil, fmt.Errorf("pause execution: %w", err)
+	}
+	m.appendLog(exec.ID, "WARN", a.Step, fmt.Sprintf(
+		"paused: %s; awaiting approval %s (default %s at %s)",
+		esc.Error(), a.ID, decision, a.ExpiresAt.Format(time.RFC3339)))
+
+	m.Events.Warning(models.ExecutionReference(exec), events.ReasonEscalated,
+		"guardrail %s escalated step %d: %s; awaiting approval %s", a.GuardrailID, a.Step, a.Message, a.ID)
+	m.logger.Info("execution escalated", "execution", exec.ID, "guardrail", a.GuardrailID, "approval", a.ID)
+	return a, nil
+}
+
+func (m *Manager) Approve(executionID, by, reason string) (*models.ApprovalRequest, error) {
+	return m.decidePending(executionID, models.ApprovalApproved, by, reason)
+}
+
+func (m *Manager) Reject(executionID, by, reason string) (*models.ApprovalRequest, error) {
+	return m.decidePending(executionID, models.ApprovalRejected, by, reason)
+}
+
+// EscalateExecution implements guardrails.Escalator: it pauses the
+// execution the guardrail engine escalated.
+func (m *Manager) EscalateExecution(executionID string, esc *guardrails.EscalationError) error {
+	exec, err := m.store.GetExecution(executionID)
+	if err != nil {
+		return err
+	}
+	_, err = m.Escalate(exec, esc)
+	return err
+}
+
+// IsApproved implements guardrails.ApprovalChecker.
+func (m *Manager) IsApproved(executionID, guardrailID string, step int) bool {
+	approved, err := m.store.ListApprovals(executionID, models.ApprovalApproved)
+	if err != nil {
+		m.logger.Error("failed to list approvals", "execution", executionID, "error", err)
+		return false
+	}
+	for _, a := range approved {
+		if a.GuardrailID == guardrailID && a.Step == step {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpireDue applies the default decision to pending approvals past their
+// deadline and returns how many were decided.
+func (m *Manager) ExpireDue(now time.Time) int {
+	pending, err := m.store.ListApprovals("", models.ApprovalPending)
+	if err != nil {
+		m.logger.Error("failed to list pending approvals", "error", err)
+		return 0
+	}
+	n := 0
+	for _, a := range pending {
+		if a.ExpiresAt.After(now) {
+			continue
+		}
+		err := m.decide(a, a.DefaultDecision, "timeout", "no decision before "+a.ExpiresAt.Format(time.RFC3339))
+		if errors.Is(err, models.ErrApprovalDecided) {
+			continue // a reviewer decided first
+		}
+		if err != nil {
+			m.logger.Error("failed to expire approval", "approval", a.ID, "error", err)
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func (m *Manager) Run() {
+	ticker := time.NewTicker(m.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.ExpireDue(time.Now().UTC())
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+func (m *Manager) Stop() {
+	close(m.stopCh)
+}
+
+func (m *Manager) decidePending(executionID string, state models.ApprovalState, by, reason string) (*models.ApprovalRequest, error) {
+	pending, err := m.store.ListApprovals(executionID, models.ApprovalPending)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, fmt.Errorf("execution %s: %w", executionID, ErrNoPendingApproval)
+	}
+	a := pending[0]
+	if err := m.decide(a, state, by, reason); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (m *Manager) decide(a *models.ApprovalRequest, state models.ApprovalState, by, reason string) error {
+	now := time.Now().UTC()
+	a.State = state
+	a.DecidedAt = &now
+	a.DecidedBy = by
+	a.Reason = reason
+	if err := m.store.UpdateApproval(a); err != nil {
+		return fmt.Errorf("update approval: %w", err)
+	}
+	// From here on this call owns the decision: the conditional update
+	// above failed for anyone deciding concurrently.
+
+	exec, err := m.store.GetExecution(a.ExecutionID)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("approval %s %s by %s", a.ID, state, by)
+	if reason != "" {
+		msg += ": " + reason
+	}
+	m.appendLog(exec.ID, "INFO", a.Step, msg)
+
+	exec.ApprovalID = ""
+	if state == models.ApprovalApproved {
+		exec.State = models.ExecPending
+	} else {
+		exec.State = models.ExecFailed
+		exec.Error = fmt.Sprintf("rejected escalation from guardrail %s: %s", a.GuardrailID, a.Message)
+		exec.CompletedAt = &now
+	}
+	if err := m.store.UpdateExecution(exec); err != nil {
+		return fmt.Errorf("update execution: %w", err)
+	}
+
+	if state == models.ApprovalApproved {
+		m.Events.Normal(models.ExecutionReference(exec), events.ReasonApproved, msg)
+	} else {
+		m.Events.Warning(models.ExecutionReference(exec), events.ReasonApprovalRejected, msg)
+	}
+	m.logger.Info("approval decided", "approval", a.ID, "execution", exec.ID, "state", state, "by", by)
+	if state == models.ApprovalApproved && m.OnResume != nil {
+		m.OnResume(exec)
+	}
+	return nil
+}
+
+func (m *Manager) policy(p *models.EscalationPolicy) (time.Duration, models.ApprovalState, error) {
+	timeout, decision := m.cfg.Timeout, m.cfg.DefaultDecision
+	if p == nil {
+		return timeout, decision, nil
+	}
+	if p.Timeout != "" {
+		d, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return 0, "", fmt.Errorf("escalation timeout: %w", err)
+		}
+		timeout = d
+	}
+	switch p.DefaultDecision {
+	case "":
+	case "approve":
+		decision = models.ApprovalApproved
+	case "reject":
+		decision = models.ApprovalRejected
+	default:
+		return 0, "", fmt.Errorf("escalation defaultDecision must be 'approve' or 'reject', got %q", p.DefaultDecision)
+	}
+	return timeout, decision, nil
+}
+
+func (m *Manager) appendLog(executionID, level string, step int, msg string) {
+	err := m.store.AppendExecutionLog(executionID, models.ExecutionLog{
+		Timestamp: time.Now().UTC(),
+		Level:     level,
+		Message:   msg,
+		Step:      step,
+	})
+	if err != nil {
+		m.logger.Error("failed to append execution log", "execution", executionID, "error", err)
+	}
+}
@@ -0,0 +1,126 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+)
+
+// Reasons reported by PIPE components. Reasons are short CamelCase words
+// users can filter on; the message carries the detail.
+const (
+	ReasonScheduled        = "Scheduled"
+	ReasonStarted          = "Started"
+	ReasonRetrying         = "Retrying"
+	ReasonTimedOut         = "TimedOut"
+	ReasonCompleted        = "Completed"
+	ReasonFailed           = "Failed"
+	ReasonGuardrailBlocked = "GuardrailBlocked"
+	ReasonEscalated        = "Escalated"
+	ReasonApproved         = "Approved"
+	ReasonApprovalRejected = "ApprovalRejected"
+	ReasonBudgetExceeded   = "BudgetExceeded"
+
+	ReasonSLOBurnRateHigh     = "SLOBurnRateHigh"
+	ReasonSLOBurnRateResolved = "SLOBurnRateResolved"
+	ReasonInvalidSLO          = "InvalidSLO"
+)
+
+type Store interface {
+	RecordEvent(e *models.Event) error
+	DeleteEventsBefore(t time.Time) (int64, error)
+}
+
+// Recorder reports events on behalf of one component. A nil Recorder
+// drops everything, so components can take one optionally.
+type Recorder struct {
+	store  Store
+	source string
+	logger *observability.Logger
+}
+
+func NewRecorder(s Store, logger *observability.Logger) *Recorder {
+	return &Recorder{store: s, logger: logger.With("events")}
+}
+
+// WithSource returns a recorder that stamps events with component, e.g.
+// "reconciler" or "scheduler".
+func (r *Recorder) WithSource(component string) *Recorder {
+	if r == nil {
+		return nil
+	}
+	return &Recorder{store: r.store, source: component, logger: r.logger}
+}
+
+func (r *Recorder) Normal(obj models.ObjectReference, reason, format string, args ...interface{}) {
+	r.Eventf(obj, models.EventNormal, reason, format, args...)
+}
+
+func (r *Recorder) Warning(obj models.ObjectReference, reason, format string, args ...interface{}) {
+	r.Eventf(obj, models.EventWarning, reason, format, args...)
+}
+
+// Eventf records an event. Failures are logged, never returned: events are
+// informational and must not fail the operation that reports them.
+func (r *Recorder) Eventf(obj models.ObjectReference, eventType models.EventType, reason, format string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	msg := format
+	if len(args) > 0 {
+		msg = fmt.Sprintf(format, args...)
+	}
+	e := &models.Event{
+		InvolvedObject: obj,
+		Type:           eventType,
+		Reason:         reason,
+		Message:        msg,
+		Source:         r.source,
+	}
+	if err := r.store.RecordEvent(e); err != nil {
+		r.logger.Error("failed to record event", "object", obj.String(), "reason", reason, "error", err)
+		return
+	}
+	if eventType == models.EventWarning {
+		r.logger.Warn(msg, "object", obj.String(), "reason", reason, "count", e.Count)
+	} else {
+		r.logger.Debug(msg, "object", obj.String(), "reason", reason, "count", e.Count)
+	}
+}
+
+// Prune deletes events not seen for longer than ttl. Run it periodically;
+// StartPruning does so in the background.
+func (r *Recorder) Prune(ttl time.Duration) {
+	if r == nil {
+		return
+	}
+	n, err := r.store.DeleteEventsBefore(time.Now().UTC().Add(-ttl))
+	if err != nil {
+		r.logger.Error("failed to prune events", "error", err)
+		return
+	}
+	if n > 0 {
+		r.logger.Debug("pruned events", "count", n)
+	}
+}
+
+// StartPruning prunes every interval until stop is closed.
+func (r *Recorder) StartPruning(ttl, interval time.Duration, stop <-chan struct{}) {
+	if r == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Prune(ttl)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
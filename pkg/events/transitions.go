@@ -0,0 +1,71 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+// RecordTransitions reports an event for each execution lifecycle change
+// on events until it is closed. Pass it the store's WatchExecutions
+// channel. Pauses are left to the approval manager, which reports the
+// escalation that caused them, and step changes are not reported.
+func (r *Recorder) RecordTransitions(events <-chan store.ExecutionEvent) {
+	for ev := range events {
+		r.transition(ev)
+	}
+}
+
+func (r *Recorder) transition(ev store.ExecutionEvent) {
+	exec := ev.Execution
+	obj := models.ExecutionReference(exec)
+	if ev.Type == store.EventCreated {
+		r.Normal(obj, ReasonScheduled, "Execution of agent %s queued", exec.AgentName)
+		return
+	}
+	if ev.PrevState == exec.State {
+		return
+	}
+	switch exec.State {
+	case models.ExecRunning:
+		if ev.PrevState == models.ExecPaused {
+			r.Normal(obj, ReasonStarted, "Resumed at step %d", exec.CurrentStep)
+		} else {
+			r.Normal(obj, ReasonStarted, "Started agent %s", exec.AgentName)
+		}
+	case models.ExecRetrying:
+		reason := ReasonRetrying
+		if isTimeout(exec.Error) {
+			reason = ReasonTimedOut
+		}
+		r.Warning(obj, reason, "Retry %d of %d after: %s", exec.RetryCount, exec.MaxRetries, errorOrUnknown(exec.Error))
+	case models.ExecCompleted:
+		r.Normal(obj, ReasonCompleted, "Completed %s", durationOf(exec))
+	case models.ExecFailed:
+		r.Warning(obj, ReasonFailed, "Failed: %s", errorOrUnknown(exec.Error))
+	}
+}
+
+func isTimeout(msg string) bool {
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out") || strings.Contains(msg, "deadline exceeded")
+}
+
+func errorOrUnknown(msg string) string {
+	if msg == "" {
+		return "unknown error"
+	}
+	return msg
+}
+
+func durationOf(exec *models.ExecutionRecord) string {
+	switch {
+	case exec.LatencyMs > 0:
+		return fmt.Sprintf("in %dms", exec.LatencyMs)
+	case exec.StartedAt != nil && exec.CompletedAt != nil:
+		return fmt.Sprintf("in %dms", exec.CompletedAt.Sub(*exec.StartedAt).Milliseconds())
+	}
+	return "successfully"
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+type memoryStore struct {
+	events []*models.Event
+}
+
+func (s *memoryStore) RecordEvent(e *models.Event) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *memoryStore) DeleteEventsBefore(time.Time) (int64, error) { return 0, nil }
+
+func TestRecordTransitions(t *testing.T) {
+	s := &memoryStore{}
+	r := NewRecorder(s, observability.NewLogger("test")).WithSource("executor")
+	exec := func(state models.ExecutionState, errMsg string) *models.ExecutionRecord {
+		return &models.ExecutionRecord{ID: "e1", AgentName: "a", Namespace: "default", State: state, Error: errMsg, RetryCount: 1, MaxRetries: 3, LatencyMs: 1200}
+	}
+	ch := make(chan store.ExecutionEvent, 10)
+	ch <- store.ExecutionEvent{Type: store.EventCreated, Execution: exec(models.ExecPending, "")}
+	ch <- store.ExecutionEvent{Type: store.EventUpdated, Execution: exec(models.ExecRunning, ""), PrevState: models.ExecPending}
+	ch <- store.ExecutionEvent{Type: store.EventUpdated, Execution: exec(models.ExecRunning, ""), PrevState: models.ExecRunning} // step change
+	ch <- store.ExecutionEvent{Type: store.EventUpdated, Execution: exec(models.ExecRetrying, "model call: context deadline exceeded"), PrevState: models.ExecRunning}
+	ch <- store.ExecutionEvent{Type: store.EventUpdated, Execution: exec(models.ExecPaused, ""), PrevState: models.ExecRunning}
+	ch <- store.ExecutionEvent{Type: store.EventUpdated, Execution: exec(models.ExecCompleted, ""), PrevState: models.ExecRunning}
+	close(ch)
+	r.RecordTransitions(ch)
+
+	want := []struct {
+		reason string
+		typ    models.EventType
+	}{
+		{ReasonScheduled, models.EventNormal},
+		{ReasonStarted, models.EventNormal},
+		{ReasonTimedOut, models.EventWarning},
+		{ReasonCompleted, models.EventNormal},
+	}
+	if len(s.events) != len(want) {
+		t.Fatalf("recorded %d events, want %d: %+v", len(s.events), len(want), s.events)
+	}
+	for i, w := range want {
+		e := s.events[i]
+		if e.Reason != w.reason || e.Type != w.typ || e.Source != "executor" || e.InvolvedObject.Kind != models.KindExecution || e.InvolvedObject.Name != "e1" {
+			t.Errorf("event %d = %s %s from %s about %s, want %s %s", i, e.Type, e.Reason, e.Source, e.InvolvedObject, w.typ, w.reason)
+		}
+	}
+	if got := s.events[2].Message; got != "Retry 1 of 3 after: model call: context deadline exceeded" {
+		t.Errorf("retry message = %q", got)
+	}
+}
@@ -0,0 +1,290 @@
+package guardrails
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+)
+
+type BudgetScope string
+
+const (
+	BudgetExecution        BudgetScope = "execution"
+	BudgetPipelineRun      BudgetScope = "pipeline-run"
+	BudgetAgentDaily       BudgetScope = "agent-daily"
+	BudgetNamespaceMonthly BudgetScope = "namespace-monthly"
+)
+
+type BudgetLimit struct {
+	MaxTokens int64   `yaml:"maxTokens" json:"maxTokens"`
+	MaxCost   float64 `yaml:"maxCost" json:"maxCost"`
+}
+
+// UsageStore persists cumulative usage so budgets survive restarts and are
+// shared by servers using the same database. ChargeBudget must apply the
+// charges atomically; see store.SQLiteStore.ChargeBudget.
+type UsageStore interface {
+	ChargeBudget(charges []models.BudgetCharge) (used []models.BudgetUsage, exceeded int, err error)
+}
+
+// reservation is the estimate charged for a step in the pre phase, settled
+// against the actual usage in the post phase.
+type reservation struct {
+	keys   []string
+	tokens int64
+	cost   float64
+}
+
+// BudgetGuardrail prices calls with Prices unless the agent sets its own
+// model pricing, the same way usage.Meter does.
+type BudgetGuardrail struct {
+	Limits map[BudgetScope]BudgetLimit
+	Prices models.PriceTable
+
+	store    UsageStore
+	mu       sync.Mutex
+	usage    map[string]models.BudgetUsage  // used when no store is configured
+	reserved map[string]map[int]reservation // execution -> step -> pre-phase estimate
+	runs     map[string]string              // execution -> pipeline run
+	now      func() time.Time
+}
+
+func NewBudgetGuardrail(limits map[BudgetScope]BudgetLimit, prices models.PriceTable, store UsageStore) *BudgetGuardrail {
+	return &BudgetGuardrail{
+		Limits:   limits,
+		Prices:   prices,
+		store:    store,
+		usage:    make(map[string]models.BudgetUsage),
+		reserved: make(map[string]map[int]reservation),
+		runs:     make(map[string]string),
+		now:      time.Now,
+	}
+}
+
+func (g *BudgetGuardrail) ID() string    { return "budget" }
+func (g *BudgetGuardrail) Phase() Phase  { return "both" }
+func (g *BudgetGuardrail) Priority() int { return 92 }
+
+// Check reserves the estimated prompt cost before a model call, refusing
+// the call when that would take a scope over its limit, and replaces the
+// reservation with the actual prompt+completion usage after it. The post
+// phase blocks once a scope is over, so the execution stops there.
+func (g *BudgetGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	scopes, keys := g.keys(input)
+
+	if input.Phase == PhasePre {
+		tokens := int64(input.TokenCount)
+		cost, _ := g.Prices.Cost(input.model(), tokens, 0)
+		charges := make([]models.BudgetCharge, len(keys))
+		for i, key := range keys {
+			limit := g.Limits[scopes[i]]
+			charges[i] = models.BudgetCharge{Key: key, Tokens: tokens, Cost: cost, MaxTokens: limit.MaxTokens, MaxCost: limit.MaxCost}
+		}
+		used, exceeded, err := g.charge(charges)
+		if err != nil {
+			return g.storeFailure(err)
+		}
+		if exceeded >= 0 {
+			return g.exceeded(scopes[exceeded], charges[exceeded], used[exceeded])
+		}
+		g.reserve(input, reservation{keys: keys, tokens: tokens, cost: cost})
+		return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "within budget"}
+	}
+
+	prompt, completion := int64(input.PromptTokens), int64(input.CompletionTokens)
+	if prompt == 0 && completion == 0 {
+		prompt = int64(input.TokenCount)
+	}
+	cost, _ := g.Prices.Cost(input.model(), prompt, completion)
+
+	// The usage happened, so it is charged unconditionally, less what the
+	// pre phase already reserved for this step.
+	charges := make([]models.BudgetCharge, 0, len(keys))
+	index := make(map[string]int, len(keys))
+	for _, key := range keys {
+		index[key] = len(charges)
+		charges = append(charges, models.BudgetCharge{Key: key, Tokens: prompt + completion, Cost: cost})
+	}
+	if r, ok := g.settle(input); ok {
+		for _, key := range r.keys {
+			i, ok := index[key]
+			if !ok {
+				i = len(charges)
+				charges = append(charges, models.BudgetCharge{Key: key})
+			}
+			charges[i].Tokens -= r.tokens
+			charges[i].Cost -= r.cost
+		}
+	}
+	used, _, err := g.charge(charges)
+	if err != nil {
+		return g.storeFailure(err)
+	}
+	for i, scope := range scopes {
+		limit := g.Limits[scope]
+		c := models.BudgetCharge{MaxTokens: limit.MaxTokens, MaxCost: limit.MaxCost}
+		if c.Exceeds(used[i]) {
+			return g.exceeded(scope, c, used[i])
+		}
+	}
+	return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "within budget"}
+}
+
+// Release refunds reservations of steps that never reached the post
+// phase and forgets the execution's pipeline run.
+func (g *BudgetGuardrail) Release(executionID string) error {
+	g.mu.Lock()
+	pending := g.reserved[executionID]
+	delete(g.reserved, executionID)
+	delete(g.runs, executionID)
+	g.mu.Unlock()
+
+	var errs []error
+	for _, r := range pending {
+		errs = append(errs, g.refund(r))
+	}
+	return errors.Join(errs...)
+}
+
+// Refund gives back the reservation of a call that another guardrail
+// stopped in the pre phase.
+func (g *BudgetGuardrail) Refund(input CheckInput) error {
+	if r, ok := g.settle(input); ok {
+		return g.refund(r)
+	}
+	return nil
+}
+
+func (g *BudgetGuardrail) refund(r reservation) error {
+	charges := make([]models.BudgetCharge, len(r.keys))
+	for i, key := range r.keys {
+		charges[i] = models.BudgetCharge{Key: key, Tokens: -r.tokens, Cost: -r.cost}
+	}
+	if _, _, err := g.charge(charges); err != nil {
+		return fmt.Errorf("refund %d tokens and $%.4f: %w", r.tokens, r.cost, err)
+	}
+	return nil
+}
+
+func (g *BudgetGuardrail) reserve(input CheckInput, r reservation) {
+	if input.ExecutionID == "" {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	steps, ok := g.reserved[input.ExecutionID]
+	if !ok {
+		steps = make(map[int]reservation)
+		g.reserved[input.ExecutionID] = steps
+	}
+	if prev, ok := steps[input.StepIndex]; ok {
+		// A retried step reserves again; keep a single reservation.
+		r.tokens += prev.tokens
+		r.cost += prev.cost
+	}
+	steps[input.StepIndex] = r
+}
+
+func (g *BudgetGuardrail) settle(input CheckInput) (reservation, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	steps := g.reserved[input.ExecutionID]
+	r, ok := steps[input.StepIndex]
+	delete(steps, input.StepIndex)
+	return r, ok
+}
+
+func (g *BudgetGuardrail) exceeded(scope BudgetScope, c models.BudgetCharge, used models.BudgetUsage) CheckResult {
+	msg := fmt.Sprintf("%s cost budget exceeded: $%.4f/$%.4f", scope, used.Cost, c.MaxCost)
+	if c.MaxTokens > 0 && used.Tokens > c.MaxTokens {
+		msg = fmt.Sprintf("%s token budget exceeded: %d/%d tokens", scope, used.Tokens, c.MaxTokens)
+	}
+	return CheckResult{Passed: false, GuardrailID: g.ID(), Message: msg, Action: "block"}
+}
+
+func (g *BudgetGuardrail) storeFailure(err error) CheckResult {
+	return CheckResult{
+		Passed:      false,
+		GuardrailID: g.ID(),
+		Message:     fmt.Sprintf("failed to update budget usage: %v", err),
+		Action:      "warn",
+	}
+}
+
+// keys returns the scopes that apply to input and their budget keys.
+func (g *BudgetGuardrail) keys(input CheckInput) ([]BudgetScope, []string) {
+	now := g.now().UTC()
+	var scopes []BudgetScope
+	var keys []string
+	add := func(scope BudgetScope, key string) {
+		scopes = append(scopes, scope)
+		keys = append(keys, key)
+	}
+	if input.ExecutionID != "" {
+		add(BudgetExecution, "execution/"+input.ExecutionID)
+	}
+	if run := g.pipelineRun(input); run != "" {
+		add(BudgetPipelineRun, "pipeline-run/"+run)
+	}
+	if input.AgentName != "" {
+		add(BudgetAgentDaily, fmt.Sprintf("agent/%s/%s/%s", input.Namespace, input.AgentName, now.Format("2006-01-02")))
+	}
+	if input.Namespace != "" {
+		add(BudgetNamespaceMonthly, fmt.Sprintf("namespace/%s/%s", input.Namespace, now.Format("2006-01")))
+	}
+	return scopes, keys
+}
+
+// pipelineRun returns the pipeline run input belongs to. When the caller
+// did not set it, the execution record is looked up once per execution;
+// an execution that is not part of a larger run is its own run.
+func (g *BudgetGuardrail) pipelineRun(input CheckInput) string {
+	if input.PipelineRunID != "" || input.PipelineName == "" || input.ExecutionID == "" {
+		return input.PipelineRunID
+	}
+	g.mu.Lock()
+	run, ok := g.runs[input.ExecutionID]
+	g.mu.Unlock()
+	if ok {
+		return run
+	}
+
+	run = input.ExecutionID
+	if lookup, ok := g.store.(interface {
+		GetExecution(id string) (*models.ExecutionRecord, error)
+	}); ok {
+		if exec, err := lookup.GetExecution(input.ExecutionID); err == nil && exec.PipelineRunID != "" {
+			run = exec.PipelineRunID
+		}
+	}
+	g.mu.Lock()
+	g.runs[input.ExecutionID] = run
+	g.mu.Unlock()
+	return run
+}
+
+func (g *BudgetGuardrail) charge(charges []models.BudgetCharge) ([]models.BudgetUsage, int, error) {
+	if g.store != nil {
+		return g.store.ChargeBudget(charges)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	used := make([]models.BudgetUsage, len(charges))
+	for i, c := range charges {
+		u := g.usage[c.Key]
+		u.Tokens += c.Tokens
+		u.Cost += c.Cost
+		used[i] = u
+		if c.Exceeds(u) {
+			return used[:i+1], i, nil
+		}
+	}
+	for i, c := range charges {
+		g.usage[c.Key] = used[i]
+	}
+	return used, -1, nil
+}
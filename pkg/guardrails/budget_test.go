@@ -0,0 +1,100 @@
+package guardrails
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+)
+
+// refundFailingStore charges like the in-memory budget but fails every
+// charge that gives usage back.
+type refundFailingStore struct {
+	usage map[string]models.BudgetUsage
+}
+
+func (s *refundFailingStore) ChargeBudget(charges []models.BudgetCharge) ([]models.BudgetUsage, int, error) {
+	used := make([]models.BudgetUsage, len(charges))
+	for i, c := range charges {
+		if c.Tokens < 0 {
+			return nil, -1, errors.New("database is locked")
+		}
+		u := s.usage[c.Key]
+		u.Tokens += c.Tokens
+		used[i] = u
+	}
+	for i, c := range charges {
+		s.usage[c.Key] = used[i]
+	}
+	return used, -1, nil
+}
+
+func TestBudgetReservations(t *testing.T) {
+	pre := func(step, tokens int) CheckInput {
+		return CheckInput{ExecutionID: "e1", StepIndex: step, Phase: PhasePre, TokenCount: tokens}
+	}
+	post := func(step, prompt, completion int) CheckInput {
+		return CheckInput{ExecutionID: "e1", StepIndex: step, Phase: PhasePost, PromptTokens: prompt, CompletionTokens: completion}
+	}
+	for _, tc := range []struct {
+		name     string
+		run      func(g *BudgetGuardrail) error
+		want     int64
+		released bool
+	}{
+		{"post replaces the estimate", func(g *BudgetGuardrail) error {
+			g.Check(context.Background(), pre(0, 100))
+			g.Check(context.Background(), post(0, 100, 50))
+			return nil
+		}, 150, false},
+		{"retried step keeps one reservation", func(g *BudgetGuardrail) error {
+			g.Check(context.Background(), pre(0, 100))
+			g.Check(context.Background(), pre(0, 100))
+			g.Check(context.Background(), post(0, 80, 40))
+			return nil
+		}, 120, false},
+		{"refund of a stopped call", func(g *BudgetGuardrail) error {
+			g.Check(context.Background(), pre(0, 100))
+			return g.Refund(pre(0, 100))
+		}, 0, false},
+		{"release of unfinished steps", func(g *BudgetGuardrail) error {
+			g.Check(context.Background(), pre(0, 100))
+			g.Check(context.Background(), post(0, 60, 0))
+			g.Check(context.Background(), pre(1, 100))
+			g.Check(context.Background(), pre(2, 100))
+			return g.Release("e1")
+		}, 60, true},
+	} {
+		g := NewBudgetGuardrail(map[BudgetScope]BudgetLimit{BudgetExecution: {MaxTokens: 1000}}, nil, nil)
+		if err := tc.run(g); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if got := g.usage["execution/e1"].Tokens; got != tc.want {
+			t.Errorf("%s: %d tokens charged, want %d", tc.name, got, tc.want)
+		}
+		if _, ok := g.reserved["e1"]; ok && tc.released {
+			t.Errorf("%s: reservations kept: %v", tc.name, g.reserved)
+		}
+	}
+}
+
+func TestFailedRefundIsReported(t *testing.T) {
+	e := newTestEngine()
+	budget := NewBudgetGuardrail(map[BudgetScope]BudgetLimit{BudgetExecution: {MaxTokens: 1000}}, nil,
+		&refundFailingStore{usage: make(map[string]models.BudgetUsage)})
+	e.Register(budget)
+	e.Register(&stubGuardrail{id: "deny", result: CheckResult{Passed: false, Action: "block", Message: "denied"}})
+
+	input := CheckInput{ExecutionID: "e1", Prompt: "hello", TokenCount: 100}
+	if _, err := e.RunPre(context.Background(), input); err == nil {
+		t.Fatal("not blocked")
+	}
+	if err := budget.Release("e1"); err != nil {
+		t.Fatalf("release after the refund was settled: %v", err)
+	}
+	failures := e.metrics.CounterVec("guardrail.refund.failures", "guardrail").WithLabelValues("budget").Value()
+	if failures != 1 {
+		t.Errorf("refund failures = %d, want 1", failures)
+	}
+}
@@ -0,0 +1,356 @@
+package guardrails
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ClassifierModel is a multinomial naive Bayes model over word unigrams and
+// bigrams. It is small enough to train on a laptop and to evaluate inline.
+type ClassifierModel struct {
+	Labels        []string                      `json:"labels"`
+	LogPrior      map[string]float64            `json:"logPrior"`
+	LogLikelihood map[string]map[string]float64 `json:"logLikelihood"` // label -> feature -> log P(feature|label)
+}
+
+type TrainingExample struct {
+	Text  string `json:"text"`
+	Label string `json:"label"`
+}
+
+// TrainClassifier fits a model with additive smoothing alpha (1 when zero).
+func TrainClassifier(examples []TrainingExample, alpha float64) (*ClassifierModel, error) {
+	if len(examples) == 0 {
+		return nil, fmt.Errorf("classifier: no training examples")
+	}
+	if alpha <= 0 {
+		alpha = 1
+	}
+
+	docs := make(map[string]int)
+	counts := make(map[string]map[string]int)
+	totals := make(map[string]int)
+	vocab := make(map[string]struct{})
+	for _, ex := range examples {
+		if ex.Label == "" {
+			return nil, fmt.Errorf("classifier: example %q has no label", ex.Text)
+		}
+		docs[ex.Label]++
+		if counts[ex.Label] == nil {
+			counts[ex.Label] = make(map[string]int)
+		}
+		for _, f := range classifierFeatures(ex.Text) {
+			counts[ex.Label][f]++
+			totals[ex.Label]++
+			vocab[f] = struct{}{}
+		}
+	}
+
+	m := &ClassifierModel{
+		LogPrior:      make(map[string]float64, len(docs)),
+		LogLikelihood: make(map[string]map[string]float64, len(docs)),
+	}
+	v := float64(len(vocab))
+	for label, n := range docs {
+		m.Labels = append(m.Labels, label)
+		m.LogPrior[label] = math.Log(float64(n) / float64(len(examples)))
+		denom := float64(totals[label]) + alpha*v
+		ll := make(map[string]float64, len(vocab))
+		for f := range vocab {
+			ll[f] = math.Log((float64(counts[label][f]) + alpha) / denom)
+		}
+		m.LogLikelihood[label] = ll
+	}
+	sort.Strings(m.Labels)
+	return m, nil
+}
+
+// Predict returns the posterior probability of each label. Words the model
+// has never seen are ignored; ok is false when none of the text was known.
+func (m *ClassifierModel) Predict(text string) (probs map[string]float64, ok bool) {
+	scores := make(map[string]float64, len(m.Labels))
+	for _, label := range m.Labels {
+		scores[label] = m.LogPrior[label]
+	}
+	for _, f := range classifierFeatures(text) {
+		for _, label := range m.Labels {
+			if l, seen := m.LogLikelihood[label][f]; seen {
+				scores[label] += l
+				ok = true
+			}
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+
+	// Softmax in log space to avoid underflow on long texts.
+	max := math.Inf(-1)
+	for _, s := range scores {
+		max = math.Max(max, s)
+	}
+	var sum float64
+	for label, s := range scores {
+		scores[label] = math.Exp(s - max)
+		sum += scores[label]
+	}
+	for label := range scores {
+		scores[label] /= sum
+	}
+	return scores, true
+}
+
+// Top returns the most likely label and its probability.
+func (m *ClassifierModel) Top(text string) (string, float64, bool) {
+	probs, ok := m.Predict(text)
+	if !ok {
+		return "", 0, false
+	}
+	var best string
+	for _, label := range m.Labels {
+		if best == "" || probs[label] > probs[best] {
+			best = label
+		}
+	}
+	return best, probs[best], true
+}
+
+func (m *ClassifierModel) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(m)
+}
+
+func LoadClassifierModel(path string) (*ClassifierModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var m ClassifierModel
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decode classifier model %s: %w", path, err)
+	}
+	if len(m.Labels) == 0 {
+		return nil, fmt.Errorf("classifier model %s has no labels", path)
+	}
+	return &m, nil
+}
+
+// ReadTrainingExamples reads one example per line, either as a JSON object
+// {"text": ..., "label": ...} or as "label<TAB>text". Blank lines and lines
+// starting with # are skipped.
+func ReadTrainingExamples(r io.Reader) ([]TrainingExample, error) {
+	var out []TrainingExample
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var ex TrainingExample
+		if strings.HasPrefix(line, "{") {
+			if err := json.Unmarshal([]byte(line), &ex); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+		} else {
+			label, text, found := strings.Cut(line, "\t")
+			if !found {
+				return nil, fmt.Errorf("line %d: expected label<TAB>text", n)
+			}
+			ex = TrainingExample{Label: strings.TrimSpace(label), Text: text}
+		}
+		out = append(out, ex)
+	}
+	return out, sc.Err()
+}
+
+func classifierFeatures(text string) []string {
+	words := strings.FieldsFunc(normalizeText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	features := make([]string, 0, 2*len(words))
+	features = append(features, words...)
+	for i := 1; i < len(words); i++ {
+		features = append(features, words[i-1]+" "+words[i])
+	}
+	return features
+}
+
+// ClassifierGuardrail flags text by label probability. In category mode any
+// label outside Ignore scoring at or above its threshold is a violation. When
+// AllowedTopics or DeniedTopics are set it runs in topic mode instead and
+// refuses requests whose most likely label is denied or not allowed. With
+// AllowedTopics only a confident allowed label passes: text the model knows
+// nothing about, or cannot place above the threshold, gets UncertainAction.
+type ClassifierGuardrail struct {
+	Model           *ClassifierModel // DefaultToxicityModel when nil
+	Threshold       float64          // default 0.8
+	Thresholds      map[string]float64
+	Ignore          []string // labels never flagged in category mode, default ["neutral"]
+	AllowedTopics   []string
+	DeniedTopics    []string
+	UncertainAction string // block (default) or escalate
+}
+
+func (g *ClassifierGuardrail) ID() string    { return "classifier" }
+func (g *ClassifierGuardrail) Phase() Phase  { return "both" }
+func (g *ClassifierGuardrail) Priority() int { return 80 }
+
+func (g *ClassifierGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	text := input.Prompt
+	if input.Phase == PhasePost {
+		text = input.Output
+	}
+	model := g.Model
+	if model == nil {
+		model = DefaultToxicityModel()
+	}
+	probs, ok := model.Predict(text)
+	if err := ctx.Err(); err != nil {
+		return CheckResult{GuardrailID: g.ID(), Err: err}
+	}
+	allowlist := len(g.AllowedTopics) > 0
+	if !ok {
+		if allowlist {
+			return g.uncertain("request has no known terms to place in an allowed topic")
+		}
+		return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "no known terms to classify"}
+	}
+
+	if allowlist || len(g.DeniedTopics) > 0 {
+		label, p, _ := model.Top(text)
+		denied := contains(g.DeniedTopics, label) || (allowlist && !contains(g.AllowedTopics, label))
+		confident := p >= g.threshold(label)
+		switch {
+		case denied && confident:
+			return CheckResult{
+				Passed:      false,
+				GuardrailID: g.ID(),
+				Message:     fmt.Sprintf("request is off-topic: classified as %s (p=%.2f)", label, p),
+				Action:      "block",
+			}
+		case allowlist && !confident:
+			return g.uncertain(fmt.Sprintf("request topic is uncertain: most likely %s (p=%.2f < %.2f)", label, p, g.threshold(label)))
+		}
+		return CheckResult{Passed: true, GuardrailID: g.ID(), Message: fmt.Sprintf("topic %s (p=%.2f)", label, p)}
+	}
+
+	ignore := g.Ignore
+	if ignore == nil {
+		ignore = []string{"neutral"}
+	}
+	var flagged []string
+	for _, label := range model.Labels {
+		if contains(ignore, label) {
+			continue
+		}
+		if p := probs[label]; p >= g.threshold(label) {
+			flagged = append(flagged, fmt.Sprintf("%s (p=%.2f)", label, p))
+		}
+	}
+	if len(flagged) > 0 {
+		return CheckResult{
+			Passed:      false,
+			GuardrailID: g.ID(),
+			Message:     "classified as " + strings.Join(flagged, ", "),
+			Action:      "block",
+		}
+	}
+	return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "no category above threshold"}
+}
+
+// uncertain refuses a request that topic mode cannot place in an allowed
+// topic with confidence.
+func (g *ClassifierGuardrail) uncertain(msg string) CheckResult {
+	action := g.UncertainAction
+	if action == "" {
+		action = "block"
+	}
+	return CheckResult{Passed: false, GuardrailID: g.ID(), Message: msg, Action: action}
+}
+
+func (g *ClassifierGuardrail) threshold(label string) float64 {
+	if t, ok := g.Thresholds[label]; ok {
+		return t
+	}
+	if g.Threshold > 0 {
+		return g.Threshold
+	}
+	return 0.8
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	defaultToxicityOnce  sync.Once
+	defaultToxicityModel *ClassifierModel
+)
+
+// DefaultToxicityModel is trained once from the bundled examples. It knows
+// the labels neutral, harassment, threat and self-harm and is meant as a
+// starting point; train a domain model with pipectl guardrail train.
+func DefaultToxicityModel() *ClassifierModel {
+	defaultToxicityOnce.Do(func() {
+		m, err := TrainClassifier(defaultToxicityExamples, 0.5)
+		if err != nil {
+			panic(err)
+		}
+		defaultToxicityModel = m
+	})
+	return defaultToxicityModel
+}
+
+var defaultToxicityExamples = []TrainingExample{
+	{"can you help me reset my password", "neutral"},
+	{"what is the status of my order", "neutral"},
+	{"summarize this article in three bullet points", "neutral"},
+	{"thanks, that was really helpful", "neutral"},
+	{"please translate this paragraph into spanish", "neutral"},
+	{"how do i configure the api key", "neutral"},
+	{"write a short poem about the ocean", "neutral"},
+	{"i am frustrated that the app keeps crashing", "neutral"},
+	{"this product is terrible and the update broke everything", "neutral"},
+	{"explain how photosynthesis works", "neutral"},
+	{"what time does the store open tomorrow", "neutral"},
+	{"i disagree with your answer, can you check again", "neutral"},
+	{"kill the process and restart the server", "neutral"},
+	{"the movie was about a detective solving a murder", "neutral"},
+
+	{"you are a stupid worthless idiot", "harassment"},
+	{"shut up you pathetic loser", "harassment"},
+	{"nobody likes you, you are disgusting", "harassment"},
+	{"you are so dumb it is embarrassing", "harassment"},
+	{"what a useless moron you are", "harassment"},
+	{"go away, you ugly freak", "harassment"},
+	{"you are an idiot and everyone laughs at you", "harassment"},
+	{"listen here you worthless piece of trash", "harassment"},
+
+	{"i will hurt you if you do that again", "threat"},
+	{"i know where you live and i am coming for you", "threat"},
+	{"you will regret this, i will make you pay", "threat"},
+	{"i am going to beat you up tomorrow", "threat"},
+	{"watch your back or you will get hurt", "threat"},
+	{"i will find you and destroy you", "threat"},
+
+	{"i want to hurt myself", "self-harm"},
+	{"i do not want to live anymore", "self-harm"},
+	{"i have been thinking about ending my life", "self-harm"},
+	{"what is the easiest way to harm myself", "self-harm"},
+	{"i feel like cutting myself again", "self-harm"},
+}
@@ -0,0 +1,58 @@
+package guardrails
+
+import (
+	"context"
+	"testing"
+)
+
+func newTopicModel(t *testing.T) *ClassifierModel {
+	t.Helper()
+	m, err := TrainClassifier([]TrainingExample{
+		{Text: "my invoice shows a double charge", Label: "billing"},
+		{Text: "refund the charge on my card", Label: "billing"},
+		{Text: "update the card on my invoice", Label: "billing"},
+		{Text: "recommend a good sushi restaurant", Label: "food"},
+		{Text: "where can I eat good ramen", Label: "food"},
+		{Text: "best restaurant for dinner tonight", Label: "food"},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestClassifierTopicAllowlist(t *testing.T) {
+	m := newTopicModel(t)
+	tests := []struct {
+		name      string
+		prompt    string
+		uncertain string
+		passed    bool
+		action    string
+	}{
+		{"allowed topic", "I see a double charge on my invoice", "", true, ""},
+		{"denied by allowlist", "recommend a good sushi restaurant", "", false, "block"},
+		{"no known terms", "Explain quantum chromodynamics", "", false, "block"},
+		{"low confidence", "a good card", "", false, "block"},
+		{"low confidence escalates", "a good card", "escalate", false, "escalate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &ClassifierGuardrail{Model: m, Threshold: 0.9, AllowedTopics: []string{"billing"}, UncertainAction: tt.uncertain}
+			r := g.Check(context.Background(), CheckInput{Prompt: tt.prompt, Phase: PhasePre})
+			if r.Passed != tt.passed || r.Action != tt.action {
+				t.Fatalf("got passed=%v action=%q (%s), want passed=%v action=%q", r.Passed, r.Action, r.Message, tt.passed, tt.action)
+			}
+		})
+	}
+}
+
+func TestClassifierDenylistPassesUnknownText(t *testing.T) {
+	g := &ClassifierGuardrail{Model: newTopicModel(t), Threshold: 0.6, DeniedTopics: []string{"food"}}
+	if r := g.Check(context.Background(), CheckInput{Prompt: "Explain quantum chromodynamics", Phase: PhasePre}); !r.Passed {
+		t.Fatalf("denylist refused text it knows nothing about: %s", r.Message)
+	}
+	if r := g.Check(context.Background(), CheckInput{Prompt: "recommend a good sushi restaurant", Phase: PhasePre}); r.Passed {
+		t.Fatal("denied topic passed")
+	}
+}
@@ -1,9 +1,18 @@
 package guardrails
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/Promptonauts/pipe/pkg/events"
+	"github.com/Promptonauts/pipe/pkg/models"
 	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/Promptonauts/pipe/pkg/store"
 )
 
 type Phase string
@@ -11,42 +20,147 @@ type Phase string
 const (
 	PhasePre  Phase = "pre"
 	PhasePost Phase = "post"
+	PhaseTool Phase = "tool" // after the model picks a tool, before it runs
+	PhaseAll  Phase = "all"  // pre, post and tool; "both" is pre and post
 )
 
 type CheckInput struct {
-	Prompt      string
-	Output      string
-	TokenCount  int
-	AgentName   string
-	ExecutionID string
-	StepIndex   int
-	Metadata    map[string]interface{}
+	Prompt           string
+	Output           string
+	TokenCount       int
+	PromptTokens     int
+	CompletionTokens int
+	AgentName        string
+	Namespace        string
+	PipelineName     string
+	PipelineRunID    string
+	ModelProvider    string
+	ModelName        string
+	ModelPricing     *models.ModelPrice // the agent's pricing override, if any
+	ToolName         string
+	ToolArgs         map[string]interface{}
+	ToolTarget       string // endpoint URL or command the tool call will hit
+	ExecutionID      string
+	StepIndex        int
+	Phase            Phase
+	Metadata         map[string]interface{}
+}
+
+// model returns the model of the call being checked.
+func (in CheckInput) model() models.ModelConfig {
+	return models.ModelConfig{Provider: in.ModelProvider, Name: in.ModelName, Pricing: in.ModelPricing}
 }
 
 type CheckResult struct {
 	Passed      bool
 	GuardrailID string
 	Message     string
-	Action      string // block , warn or log
+	Action      string // block , warn , log or escalate
+	Shadow      bool   // evaluated in shadow mode, never enforced
+	Phase       Phase
+	Step        int
+	Latency     time.Duration
+	Err         error // set when the check could not be evaluated; the failure policy decides
+}
+
+// EscalationError is returned by RunPre/RunPost when a guardrail asks for a
+// human decision. With an Escalator configured the execution has already
+// been paused when it is returned; the caller stops it without failing it.
+type EscalationError struct {
+	Result CheckResult
+	Step   int
+	Policy *models.EscalationPolicy // nil uses the approval manager defaults
+}
+
+func (e *EscalationError) Error() string {
+	return fmt.Sprintf("escalated by guardrail %s: %s", e.Result.GuardrailID, e.Result.Message)
+}
+
+// VerdictStore persists check results with the execution they ran for.
+type VerdictStore interface {
+	AppendGuardrailVerdicts(id string, verdicts []models.GuardrailVerdict) error
+}
+
+// ApprovalChecker reports whether a human already approved an escalation,
+// so a resumed execution does not escalate on the same step again.
+type ApprovalChecker interface {
+	IsApproved(executionID, guardrailID string, step int) bool
+}
+
+// Escalator files an approval for an escalated execution and pauses it.
+type Escalator interface {
+	EscalateExecution(executionID string, esc *EscalationError) error
 }
 
 type Guardrail interface {
 	ID() string
 	Phase() Phase
-	Check(input CheckInput) CheckResult
+	Check(ctx context.Context, input CheckInput) CheckResult
 	Priority() int
 }
 
+// FailurePolicy decides the verdict when a guardrail times out or panics.
+type FailurePolicy string
+
+const (
+	FailOpen   FailurePolicy = "open"
+	FailClosed FailurePolicy = "closed"
+)
+
+type Config struct {
+	Timeout       time.Duration // per-guardrail deadline unless the guardrail sets its own
+	FailurePolicy FailurePolicy
+}
+
+// ExecutionReleaser is implemented by guardrails that keep per-execution
+// state which can be dropped once the execution is terminal. An error means
+// something the execution held could not be given back.
+type ExecutionReleaser interface {
+	Release(executionID string) error
+}
+
+// Refunder is implemented by guardrails that consume something, such as a
+// rate limit token or a budget reservation, when they pass a call. Refund
+// gives it back when another guardrail stops the call.
+type Refunder interface {
+	Refund(input CheckInput) error
+}
+
+// UsageMeter prices and records the tokens of a model call; usage.Meter
+// implements it.
+type UsageMeter interface {
+	Record(exec *models.ExecutionRecord, model models.ModelConfig, step int, promptTokens, completionTokens int64) (*models.UsageRecord, error)
+}
+
 type Engine struct {
+	mu         sync.RWMutex
 	guardrails []Guardrail
+	factory    *Factory
+	approvals  ApprovalChecker
+	escalator  Escalator
+	meter      UsageMeter
+	verdicts   VerdictStore
+	recorder   *events.Recorder
+	shadow     *shadowReport
+	cfg        Config
 	metrics    *observability.MetricsRegistry
+	tracer     *observability.Tracer
 	logger     *observability.Logger
+
+	activeMu      sync.Mutex
+	active        map[string]struct{} // executions checked and not yet released
+	sweepInterval time.Duration
 }
 
 func NewEngine(metrics *observability.MetricsRegistry, logger *observability.Logger) *Engine {
 	e := &Engine{
-		metrics: metrics,
-		logger:  logger.With("guardrails"),
+		factory:       NewFactory(nil),
+		shadow:        newShadowReport(),
+		cfg:           Config{Timeout: 5 * time.Second, FailurePolicy: FailClosed},
+		metrics:       metrics,
+		logger:        logger.With("guardrails"),
+		active:        make(map[string]struct{}),
+		sweepInterval: time.Minute,
 	}
 	e.Register(&PromptInjectionGuardrail{})
 
@@ -58,48 +172,553 @@ func NewEngine(metrics *observability.MetricsRegistry, logger *observability.Log
 	return e
 }
 
+func (e *Engine) Configure(cfg Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cfg.Timeout > 0 {
+		e.cfg.Timeout = cfg.Timeout
+	}
+	if cfg.FailurePolicy != "" {
+		e.cfg.FailurePolicy = cfg.FailurePolicy
+	}
+}
+
+// SetStore gives guardrails built from resources access to persistent state.
+func (e *Engine) SetStore(s Store) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.factory = NewFactory(s)
+	e.verdicts = s
+}
+
+// SetApprovals lets reviewers' approvals pass escalated checks. When a
+// also implements Escalator, escalations file an approval and pause the
+// execution before the EscalationError is returned.
+func (e *Engine) SetApprovals(a ApprovalChecker) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.approvals = a
+	e.escalator, _ = a.(Escalator)
+}
+
+// SetTracer records a span per guardrail check under the span in the
+// check's context.
+func (e *Engine) SetTracer(t *observability.Tracer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tracer = t
+}
+
+// SetMeter records the usage of every model call checked in the post
+// phase.
+func (e *Engine) SetMeter(m UsageMeter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.meter = m
+}
+
+// SetEvents reports an event on the execution for each call a guardrail
+// blocks.
+func (e *Engine) SetEvents(r *events.Recorder) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.recorder = r
+}
+
+func (e *Engine) Factory() *Factory {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.factory
+}
+
 func (e *Engine) Register(g Guardrail) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, existing := range e.guardrails {
+		if existing.ID() == g.ID() {
+			closeGuardrail(existing)
+			e.guardrails[i] = g
+			e.logger.Info("guardrail replaced", "id", g.ID(), "phase", g.Phase())
+			return
+		}
+	}
 	e.guardrails = append(e.guardrails, g)
 	e.logger.Info("guardrail registered", "id", g.ID(), "phase", g.Phase())
 }
 
-func (e *Engine) RunPre(input CheckInput) ([]CheckResult, error) {
-	return e.run(PhasePre, input)
+// Apply builds a guardrail from a Guardrail resource and registers it,
+// replacing any guardrail with the same name. For an Agent or Tool resource
+// it registers the guardrails the resource declares for itself.
+func (e *Engine) Apply(res *models.GenericResource) error {
+	if res.Kind == models.KindAgent || res.Kind == models.KindTool {
+		return e.applyDeclared(res)
+	}
+	g, err := e.Factory().Build(res)
+	if err != nil {
+		return err
+	}
+	e.Register(g)
+	return nil
+}
+
+func (e *Engine) Remove(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, g := range e.guardrails {
+		if g.ID() == id {
+			closeGuardrail(g)
+			e.guardrails = append(e.guardrails[:i], e.guardrails[i+1:]...)
+			e.logger.Info("guardrail removed", "id", id)
+			return
+		}
+	}
+}
+
+// Release drops per-execution guardrail state. ReleaseFinished calls it
+// when an execution reaches a terminal state.
+func (e *Engine) Release(executionID string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, g := range e.guardrails {
+		if r, ok := g.(ExecutionReleaser); ok {
+			if err := r.Release(executionID); err != nil {
+				e.refundFailed(g, executionID, err)
+			}
+		}
+	}
+	e.shadow.release(executionID)
+
+	e.activeMu.Lock()
+	delete(e.active, executionID)
+	e.activeMu.Unlock()
+}
+
+// ExecutionStore is where ReleaseFinished learns that executions finished.
+type ExecutionStore interface {
+	WatchExecutions() <-chan store.ExecutionEvent
+	GetExecution(id string) (*models.ExecutionRecord, error)
+}
+
+// ReleaseFinished releases the state of every execution that reaches a
+// terminal state, until stop is closed. Besides following the store's
+// execution events, it looks up the executions the engine still holds
+// state for every sweep interval, so a finish it missed is caught too.
+func (e *Engine) ReleaseFinished(s ExecutionStore, stop <-chan struct{}) {
+	events := s.WatchExecutions()
+	ticker := time.NewTicker(e.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if ev.Execution.State.IsTerminal() {
+				e.Release(ev.Execution.ID)
+			}
+		case <-ticker.C:
+			e.sweep(s)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (e *Engine) sweep(s ExecutionStore) {
+	e.activeMu.Lock()
+	ids := make([]string, 0, len(e.active))
+	for id := range e.active {
+		ids = append(ids, id)
+	}
+	e.activeMu.Unlock()
+
+	for _, id := range ids {
+		exec, err := s.GetExecution(id)
+		if err != nil {
+			e.logger.Warn("failed to look up execution", "execution", id, "error", err)
+			continue
+		}
+		if exec.State.IsTerminal() {
+			e.Release(id)
+		}
+	}
+}
+
+// track notes that guardrails may hold state for an execution until it is
+// released.
+func (e *Engine) track(executionID string) {
+	if executionID == "" {
+		return
+	}
+	e.activeMu.Lock()
+	e.active[executionID] = struct{}{}
+	e.activeMu.Unlock()
 }
 
-func (e *Engine) RunPost(input CheckInput) ([]CheckResult, error) {
-	return e.run(PhasePost, input)
+// ShadowReport summarizes the verdicts of guardrails running in shadow mode
+// across executions, for tuning before they are enforced. With a store that
+// can report on the persisted verdicts the report covers those since the
+// given time and survives restarts; otherwise it covers this process.
+func (e *Engine) ShadowReport(since time.Time) ([]models.ShadowStats, error) {
+	e.mu.RLock()
+	verdicts := e.verdicts
+	e.mu.RUnlock()
+	if r, ok := verdicts.(interface {
+		ShadowReport(since time.Time) ([]models.ShadowStats, error)
+	}); ok {
+		return r.ShadowReport(since)
+	}
+	return e.shadow.snapshot(), nil
 }
 
-func (e *Engine) run(phase Phase, input CheckInput) ([]CheckResult, error) {
-	var results []CheckResult
+func (e *Engine) RunPre(ctx context.Context, input CheckInput) ([]CheckResult, error) {
+	return e.run(ctx, PhasePre, input)
+}
 
+func (e *Engine) RunPost(ctx context.Context, input CheckInput) ([]CheckResult, error) {
+	return e.run(ctx, PhasePost, input)
+}
+
+// RunTool checks a tool call chosen by the model before it is executed.
+func (e *Engine) RunTool(ctx context.Context, input CheckInput) ([]CheckResult, error) {
+	return e.run(ctx, PhaseTool, input)
+}
+
+// run evaluates every guardrail of the phase concurrently, each under its own
+// deadline, then applies the verdicts in priority order so the first
+// blocking or escalating guardrail wins deterministically.
+func (e *Engine) run(ctx context.Context, phase Phase, input CheckInput) ([]CheckResult, error) {
+	input.Phase = phase
+	e.track(input.ExecutionID)
+	log := e.logger.WithContext(ctx)
+
+	e.mu.RLock()
+	var guardrails []Guardrail
 	for _, g := range e.guardrails {
-		if g.Phase() != phase && g.Phase() != "both" {
+		if g.Phase() != phase && g.Phase() != PhaseAll && (g.Phase() != "both" || phase == PhaseTool) {
+			continue
+		}
+		if s, ok := g.(interface{ Applies(CheckInput) bool }); ok && !s.Applies(input) {
+			continue
+		}
+		guardrails = append(guardrails, g)
+	}
+	approvals := e.approvals
+	escalator := e.escalator
+	meter := e.meter
+	verdicts := e.verdicts
+	recorder := e.recorder
+	cfg := e.cfg
+	tracer := e.tracer
+	e.mu.RUnlock()
+
+	sort.SliceStable(guardrails, func(i, j int) bool {
+		return guardrails[i].Priority() > guardrails[j].Priority()
+	})
+
+	checks := make([]*pendingCheck, len(guardrails))
+	for i, g := range guardrails {
+		checks[i] = e.startCheck(ctx, cfg, tracer, g, input)
+	}
+	results := make([]CheckResult, len(guardrails))
+	for i, c := range checks {
+		results[i] = e.wait(c, input)
+	}
+	if phase == PhasePost && meter != nil {
+		e.recordUsage(meter, input)
+	}
+
+	var shadowed []CheckResult
+	enforcedFailed := false
+	defer func() {
+		for _, r := range shadowed {
+			e.shadow.record(input, r, enforcedFailed)
+		}
+		e.persist(verdicts, input, results)
+	}()
+
+	var verdict error
+	var decidedBy Guardrail
+	for i, g := range guardrails {
+		result := &results[i]
+		if !result.Passed && result.Action == "escalate" && approvals != nil &&
+			approvals.IsApproved(input.ExecutionID, result.GuardrailID, input.StepIndex) {
+			result.Passed = true
+			result.Message = "approved by reviewer: " + result.Message
+		}
+
+		if s, ok := g.(interface{ Shadow() bool }); ok && s.Shadow() {
+			result.Shadow = true
+			shadowed = append(shadowed, *result)
+			e.metrics.Counter("guardrail.shadow.checks.total").Inc()
+			if !result.Passed {
+				e.violationCounter("guardrail.shadow.violations", input, *result).Inc()
+				log.Info("shadow guardrail violation",
+					"guardrail", g.ID(),
+					"action", result.Action,
+					"message", result.Message,
+					"agent", input.AgentName,
+					"execution", input.ExecutionID,
+				)
+			}
 			continue
 		}
-		result := g.Check(input)
-		results = append(results, result)
 
 		e.metrics.Counter("guardrail.checks.total").Inc()
 
 		if !result.Passed {
+			enforcedFailed = true
 
-			e.metrics.Counter("guardrail.violations.total").Inc()
-
-			e.metrics.Counter(fmt.Sprintf("gyardrail.violations.%s", g.ID())).Inc()
-			e.logger.Warn("guardrail violation",
+			e.violationCounter("guardrail.violations", input, *result).Inc()
+			log.Warn("guardrail violation",
 				"guardrail", g.ID(),
 				"action", result.Action,
 				"message", result.Message,
 				"agent", input.AgentName,
 				"execution", input.ExecutionID,
 			)
+			if verdict != nil {
+				continue
+			}
+			decidedBy = g
 			if result.Action == "block" {
-				return results,
-					fmt.Errorf("blocked by guardrail %s: %s", g.ID(), result.Message)
+				verdict = fmt.Errorf("blocked by guardrail %s: %s", g.ID(), result.Message)
+			}
+			if result.Action == "escalate" {
+				var policy *models.EscalationPolicy
+				if p, ok := g.(interface {
+					EscalationPolicy() *models.EscalationPolicy
+				}); ok {
+					policy = p.EscalationPolicy()
+				}
+				verdict = &EscalationError{Result: *result, Step: input.StepIndex, Policy: policy}
+			}
+		}
+	}
+
+	if verdict != nil && phase != PhasePost {
+		// The call is not made, so what the passing guardrails consumed for
+		// it is given back. Post-phase usage already happened.
+		for i, c := range checks {
+			if r, ok := guardrails[i].(Refunder); ok && c.finished && results[i].Passed {
+				if err := r.Refund(input); err != nil {
+					e.refundFailed(guardrails[i], input.ExecutionID, err)
+				}
 			}
 		}
 	}
-	return results, nil
+
+	if esc, ok := verdict.(*EscalationError); ok && escalator != nil && input.ExecutionID != "" {
+		if err := escalator.EscalateExecution(input.ExecutionID, esc); err != nil {
+			// Without a pending approval nobody could resume the execution,
+			// so an escalation that cannot be filed blocks.
+			log.Error("failed to escalate execution", "execution", input.ExecutionID, "guardrail", esc.Result.GuardrailID, "error", err)
+			verdict = fmt.Errorf("blocked by guardrail %s: escalation failed: %v", esc.Result.GuardrailID, err)
+		}
+	}
+	if _, escalated := verdict.(*EscalationError); verdict != nil && !escalated && input.ExecutionID != "" {
+		obj := models.ObjectReference{Kind: models.KindExecution, Namespace: input.Namespace, Name: input.ExecutionID}
+		recorder.Warning(obj, blockReason(decidedBy), "Step %d %s: %v", input.StepIndex, phase, verdict)
+	}
+	return results, verdict
+}
+
+// blockReason is the event reason for a call blocked by g.
+func blockReason(g Guardrail) string {
+	if r, ok := g.(*resourceGuardrail); ok {
+		g = r.Guardrail
+	}
+	if _, ok := g.(*BudgetGuardrail); ok {
+		return events.ReasonBudgetExceeded
+	}
+	return events.ReasonGuardrailBlocked
+}
+
+// refundFailed reports usage a guardrail consumed and could not give back,
+// which stays charged against its limits.
+func (e *Engine) refundFailed(g Guardrail, executionID string, err error) {
+	e.metrics.CounterVec("guardrail.refund.failures", "guardrail").WithLabelValues(g.ID()).Inc()
+	e.logger.Error("failed to give back guardrail usage", "guardrail", g.ID(), "execution", executionID, "error", err)
+}
+
+// recordUsage meters the model call checked in the post phase. The call
+// was made whatever the verdict, so it is always recorded. The execution
+// totals Record adds up are not persisted here; they are summed from the
+// usage records instead.
+func (e *Engine) recordUsage(meter UsageMeter, input CheckInput) {
+	prompt, completion := int64(input.PromptTokens), int64(input.CompletionTokens)
+	if prompt == 0 && completion == 0 {
+		prompt = int64(input.TokenCount)
+	}
+	if prompt == 0 && completion == 0 {
+		return
+	}
+	exec := &models.ExecutionRecord{
+		ID:            input.ExecutionID,
+		AgentName:     input.AgentName,
+		PipelineName:  input.PipelineName,
+		PipelineRunID: input.PipelineRunID,
+		Namespace:     input.Namespace,
+	}
+	if _, err := meter.Record(exec, input.model(), input.StepIndex, prompt, completion); err != nil {
+		e.logger.Error("failed to record usage", "execution", input.ExecutionID, "error", err)
+	}
+}
+
+// pendingCheck is a guardrail check running in its own goroutine.
+type pendingCheck struct {
+	g        Guardrail
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan CheckResult
+	span     *observability.Span
+	start    time.Time
+	timeout  time.Duration
+	policy   FailurePolicy
+	finished bool // the guardrail's own result was used
+}
+
+// startCheck runs one guardrail in a goroutine under its deadline. The
+// guardrail gets the deadline's context, which wait cancels once it stops
+// waiting, so a guardrail that overran can give up.
+func (e *Engine) startCheck(ctx context.Context, cfg Config, tracer *observability.Tracer, g Guardrail, input CheckInput) *pendingCheck {
+	c := &pendingCheck{g: g, done: make(chan CheckResult, 1), timeout: cfg.Timeout, policy: cfg.FailurePolicy}
+	if t, ok := g.(interface{ Timeout() time.Duration }); ok && t.Timeout() > 0 {
+		c.timeout = t.Timeout()
+	}
+	if p, ok := g.(interface{ FailurePolicy() FailurePolicy }); ok && p.FailurePolicy() != "" {
+		c.policy = p.FailurePolicy()
+	}
+	if tracer != nil {
+		ctx, c.span = tracer.Start(ctx, "guardrail "+g.ID())
+		if input.ExecutionID != "" {
+			c.span.SetTag(observability.AttrExecutionID, input.ExecutionID)
+		}
+	}
+	c.ctx, c.cancel = context.WithTimeout(ctx, c.timeout)
+	c.start = time.Now()
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				e.metrics.Counter("guardrail.panics.total").Inc()
+				e.logger.WithContext(c.ctx).Error("guardrail panicked", "guardrail", g.ID(), "panic", fmt.Sprint(r))
+				c.done <- failureResult(g.ID(), c.policy, fmt.Sprintf("panicked: %v", r))
+			}
+		}()
+		c.done <- g.Check(c.ctx, input)
+	}()
+	return c
+}
+
+// wait collects the result of a started check, turning a timeout, error or
+// panic into a result according to the failure policy.
+func (e *Engine) wait(c *pendingCheck, input CheckInput) CheckResult {
+	defer c.cancel()
+
+	log := e.logger.WithContext(c.ctx)
+	var result CheckResult
+	select {
+	case result = <-c.done:
+		if result.Err != nil {
+			e.metrics.Counter("guardrail.errors.total").Inc()
+			log.Warn("guardrail failed", "guardrail", c.g.ID(), "error", result.Err.Error(), "policy", c.policy)
+			result = failureResult(c.g.ID(), c.policy, fmt.Sprintf("failed: %v", result.Err))
+		} else {
+			c.finished = true
+		}
+	case <-c.ctx.Done():
+		e.metrics.Counter("guardrail.timeouts.total").Inc()
+		log.Warn("guardrail timed out", "guardrail", c.g.ID(), "timeout", c.timeout.String(), "policy", c.policy)
+		result = failureResult(c.g.ID(), c.policy, fmt.Sprintf("did not finish: %v", c.ctx.Err()))
+	}
+	result.Phase = input.Phase
+	result.Step = input.StepIndex
+	result.Latency = time.Since(c.start)
+
+	ms := float64(result.Latency.Microseconds()) / 1000
+	e.metrics.HistogramVecWithBuckets("guardrail.latency.ms", guardrailLatencyBuckets, "guardrail", "phase").
+		WithLabelValues(c.g.ID(), string(input.Phase)).Observe(ms)
+	e.metrics.SummaryVec("guardrail.latency.quantiles.ms", observability.SummaryOpts{}, "guardrail").
+		WithLabelValues(c.g.ID()).Observe(ms)
+	if c.span != nil {
+		endCheckSpan(c.span, c.g, result)
+	}
+	return result
+}
+
+// check runs one guardrail and waits for it.
+func (e *Engine) check(ctx context.Context, cfg Config, g Guardrail, input CheckInput) CheckResult {
+	return e.wait(e.startCheck(ctx, cfg, nil, g, input), input)
+}
+
+func endCheckSpan(span *observability.Span, g Guardrail, r CheckResult) {
+	shadow := false
+	if s, ok := g.(interface{ Shadow() bool }); ok {
+		shadow = s.Shadow()
+	}
+	span.SetTag("guardrail.id", r.GuardrailID)
+	span.SetTag("guardrail.phase", string(r.Phase))
+	span.SetTag("guardrail.step", strconv.Itoa(r.Step))
+	span.SetTag("guardrail.passed", strconv.FormatBool(r.Passed))
+	if !r.Passed {
+		span.SetTag("guardrail.action", r.Action)
+		span.SetTag("guardrail.shadow", strconv.FormatBool(shadow))
+		if r.Action == "block" && !shadow {
+			span.SetStatus(observability.SpanStatusError, r.Message)
+		}
+	}
+	span.End()
+}
+
+// Most guardrails finish in well under a millisecond; plugins and
+// classifiers can take seconds.
+var guardrailLatencyBuckets = observability.ExponentialBuckets(0.05, 2.5, 12)
+
+// closeGuardrail releases resources such as plugin processes held by a
+// guardrail that is being replaced or removed.
+func closeGuardrail(g Guardrail) {
+	if c, ok := g.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+func failureResult(id string, policy FailurePolicy, reason string) CheckResult {
+	if policy == FailOpen {
+		return CheckResult{Passed: true, GuardrailID: id, Message: reason + " (fail-open)", Action: "log"}
+	}
+	return CheckResult{Passed: false, GuardrailID: id, Message: reason + " (fail-closed)", Action: "block"}
+}
+
+func (e *Engine) violationCounter(name string, input CheckInput, r CheckResult) *observability.Counter {
+	return e.metrics.CounterVec(name, "guardrail", "agent", "namespace", "action", "phase").
+		WithLabelValues(r.GuardrailID, input.AgentName, input.Namespace, r.Action, string(input.Phase))
+}
+
+func (e *Engine) persist(store VerdictStore, input CheckInput, results []CheckResult) {
+	executionID := input.ExecutionID
+	if store == nil || executionID == "" || len(results) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	verdicts := make([]models.GuardrailVerdict, 0, len(results))
+	for _, r := range results {
+		verdicts = append(verdicts, models.GuardrailVerdict{
+			ExecutionID: executionID,
+			GuardrailID: r.GuardrailID,
+			AgentName:   input.AgentName,
+			Namespace:   input.Namespace,
+			Phase:       string(r.Phase),
+			Step:        r.Step,
+			Passed:      r.Passed,
+			Action:      r.Action,
+			Message:     r.Message,
+			Shadow:      r.Shadow,
+			LatencyMs:   float64(r.Latency.Microseconds()) / 1000,
+			Timestamp:   now,
+		})
+	}
+	if err := store.AppendGuardrailVerdicts(executionID, verdicts); err != nil {
+		e.logger.Error("failed to persist guardrail verdicts", "execution", executionID, "error", err)
+	}
 }
@@ -0,0 +1,206 @@
+package guardrails
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/events"
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/Promptonauts/pipe/pkg/store"
+	"github.com/Promptonauts/pipe/pkg/usage"
+)
+
+// stubGuardrail returns a fixed result, or waits for its context when slow.
+type stubGuardrail struct {
+	id       string
+	result   CheckResult
+	slow     bool
+	canceled chan struct{}
+}
+
+func (g *stubGuardrail) ID() string    { return g.id }
+func (g *stubGuardrail) Phase() Phase  { return PhasePre }
+func (g *stubGuardrail) Priority() int { return 10 }
+
+func (g *stubGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	if g.slow {
+		<-ctx.Done()
+		close(g.canceled)
+		return CheckResult{GuardrailID: g.id, Err: ctx.Err()}
+	}
+	r := g.result
+	r.GuardrailID = g.id
+	return r
+}
+
+func TestBlockedCallRefundsRateLimit(t *testing.T) {
+	e := newTestEngine()
+	e.Remove("loop-detection") // the same prompt is sent on purpose
+	e.Register(NewTokenBucketLimiter("test", 1, time.Hour, 1, []string{RateKeyAgent}, nil))
+	e.Register(&stubGuardrail{id: "deny", result: CheckResult{Passed: false, Action: "block", Message: "denied"}})
+
+	input := CheckInput{AgentName: "a", Prompt: "hello", ExecutionID: "e1"}
+	for i := 0; i < 3; i++ {
+		results, err := e.RunPre(context.Background(), input)
+		if err == nil {
+			t.Fatalf("run %d: not blocked", i)
+		}
+		if r, _ := findResult(results, "rate-limiter"); !r.Passed {
+			t.Fatalf("run %d: rate limiter failed, the blocked calls used its only token: %s", i, r.Message)
+		}
+	}
+
+	e.Remove("deny")
+	if _, err := e.RunPre(context.Background(), input); err != nil {
+		t.Fatalf("first allowed call: %v", err)
+	}
+	if _, err := e.RunPre(context.Background(), input); err == nil {
+		t.Fatal("second allowed call passed a 1/hour limit")
+	}
+}
+
+func TestTimedOutCheckIsCanceled(t *testing.T) {
+	e := newTestEngine()
+	e.Configure(Config{Timeout: 10 * time.Millisecond, FailurePolicy: FailClosed})
+	slow := &stubGuardrail{id: "slow", slow: true, canceled: make(chan struct{})}
+	e.Register(slow)
+
+	results, err := e.RunPre(context.Background(), CheckInput{AgentName: "a", Prompt: "hello"})
+	if err == nil {
+		t.Fatal("timed out fail-closed guardrail did not block")
+	}
+	if r, _ := findResult(results, "slow"); r.Passed || r.Action != "block" {
+		t.Fatalf("slow result = %+v", r)
+	}
+	select {
+	case <-slow.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("guardrail context was not canceled after the timeout")
+	}
+}
+
+type usageRecords []*models.UsageRecord
+
+func (u *usageRecords) RecordUsage(r *models.UsageRecord) error {
+	*u = append(*u, r)
+	return nil
+}
+
+func TestPostPhaseMetersUsageAtBudgetPrice(t *testing.T) {
+	prices := models.PriceTable{"openai/gpt-4o": {PromptPer1K: 1, CompletionPer1K: 2}}
+	var records usageRecords
+	e := newTestEngine()
+	e.SetMeter(usage.NewMeter(&records, prices, observability.NewMetricsRegistry(), observability.NewLogger("test")))
+	budget := NewBudgetGuardrail(map[BudgetScope]BudgetLimit{BudgetExecution: {MaxCost: 100}}, prices, nil)
+	e.Register(budget)
+
+	for _, tc := range []struct {
+		execution string
+		pricing   *models.ModelPrice
+		want      float64
+	}{
+		{"table", nil, 2},
+		{"agent", &models.ModelPrice{PromptPer1K: 10, CompletionPer1K: 20}, 20},
+	} {
+		input := CheckInput{
+			AgentName:        "a",
+			Namespace:        "team",
+			ExecutionID:      tc.execution,
+			StepIndex:        1,
+			ModelProvider:    "openai",
+			ModelName:        "gpt-4o",
+			ModelPricing:     tc.pricing,
+			Output:           "done",
+			PromptTokens:     1000,
+			CompletionTokens: 500,
+		}
+		if _, err := e.RunPost(context.Background(), input); err != nil {
+			t.Fatalf("%s: %v", tc.execution, err)
+		}
+		if len(records) == 0 || records[len(records)-1].ExecutionID != tc.execution {
+			t.Fatalf("%s: call was not metered", tc.execution)
+		}
+		r := records[len(records)-1]
+		if !r.Priced || math.Abs(r.Cost-tc.want) > 1e-9 || r.Step != 1 || r.PromptTokens != 1000 || r.CompletionTokens != 500 {
+			t.Errorf("%s: usage record = %+v, want cost %v", tc.execution, r, tc.want)
+		}
+		if got := budget.usage["execution/"+tc.execution].Cost; math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: budget charged %v, meter priced %v", tc.execution, got, r.Cost)
+		}
+	}
+}
+
+// finishedStore never reports an event, so executions are only released
+// by the sweep.
+type finishedStore struct{}
+
+func (finishedStore) WatchExecutions() <-chan store.ExecutionEvent { return nil }
+
+func (finishedStore) GetExecution(id string) (*models.ExecutionRecord, error) {
+	return &models.ExecutionRecord{ID: id, State: models.ExecCompleted}, nil
+}
+
+func TestReleaseFinishedSweepsMissedExecutions(t *testing.T) {
+	e := newTestEngine()
+	e.sweepInterval = 5 * time.Millisecond
+	loop := &LoopDetectionGuardrail{MaxRepeats: 3}
+	e.Register(loop)
+	if _, err := e.RunPre(context.Background(), CheckInput{ExecutionID: "e1", Prompt: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go e.ReleaseFinished(finishedStore{}, stop)
+	deadline := time.Now().Add(time.Second)
+	for {
+		loop.mu.Lock()
+		held := len(loop.states)
+		loop.mu.Unlock()
+		if held == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("finished execution was not released by the sweep")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+type eventLog []*models.Event
+
+func (l *eventLog) RecordEvent(e *models.Event) error {
+	*l = append(*l, e)
+	return nil
+}
+
+func (l *eventLog) DeleteEventsBefore(t time.Time) (int64, error) { return 0, nil }
+
+func TestBlockedCallsAreReported(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		guardrail Guardrail
+		reason    string // empty for no event
+	}{
+		{"block", &stubGuardrail{id: "deny", result: CheckResult{Passed: false, Action: "block", Message: "denied"}}, events.ReasonGuardrailBlocked},
+		{"budget", NewBudgetGuardrail(map[BudgetScope]BudgetLimit{BudgetExecution: {MaxTokens: 10}}, nil, nil), events.ReasonBudgetExceeded},
+		{"escalate", &stubGuardrail{id: "review", result: CheckResult{Passed: false, Action: "escalate", Message: "review"}}, ""},
+		{"warn", &stubGuardrail{id: "note", result: CheckResult{Passed: false, Action: "warn", Message: "note"}}, ""},
+	} {
+		var log eventLog
+		e := newTestEngine()
+		e.SetEvents(events.NewRecorder(&log, observability.NewLogger("test")))
+		e.Register(tc.guardrail)
+		e.RunPre(context.Background(), CheckInput{ExecutionID: "e1", Namespace: "default", Prompt: "hello", TokenCount: 100})
+
+		switch {
+		case tc.reason == "" && len(log) != 0:
+			t.Errorf("%s: events %+v, want none", tc.name, log)
+		case tc.reason != "" && (len(log) != 1 || log[0].Reason != tc.reason || log[0].InvolvedObject.Name != "e1"):
+			t.Errorf("%s: events %+v, want one %s on e1", tc.name, log, tc.reason)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package guardrails
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+)
+
+// Store is the persistence used by the engine and the guardrails it builds.
+type Store interface {
+	UsageStore
+	RateLimitStore
+	VerdictStore
+}
+
+type Factory struct {
+	store Store
+}
+
+func NewFactory(store Store) *Factory {
+	return &Factory{store: store}
+}
+
+// Build instantiates a guardrail from a Guardrail resource. The resource name
+// becomes the guardrail ID and spec phase, priority and action override the
+// built-in defaults.
+func (f *Factory) Build(res *models.GenericResource) (Guardrail, error) {
+	if res.Kind != models.KindGuardrail {
+		return nil, fmt.Errorf("resource %s is not a Guardrail", res.Key())
+	}
+	var spec models.GuardrailSpec
+	if err := decodeConfig(res.Spec, &spec); err != nil {
+		return nil, fmt.Errorf("decode guardrail spec: %w", err)
+	}
+
+	g, err := f.build(res.Metadata.Name, spec)
+	if err != nil {
+		return nil, fmt.Errorf("guardrail %s: %w", res.Metadata.Name, err)
+	}
+	rg := &resourceGuardrail{Guardrail: g, id: res.Metadata.Name, spec: spec}
+	if spec.Timeout != "" {
+		if rg.timeout, err = time.ParseDuration(spec.Timeout); err != nil {
+			return nil, fmt.Errorf("guardrail %s: timeout: %w", res.Metadata.Name, err)
+		}
+	}
+	return rg, nil
+}
+
+func (f *Factory) build(name string, spec models.GuardrailSpec) (Guardrail, error) {
+	cfg := spec.Config
+	switch spec.Type {
+	case "prompt-injection":
+		patterns, err := configPatterns(cfg["patterns"])
+		if err != nil {
+			return nil, err
+		}
+		if extend, _ := cfg["extendDefaults"].(bool); extend || len(patterns) == 0 {
+			patterns = append(DefaultInjectionPatterns(), patterns...)
+		}
+		return &PromptInjectionGuardrail{
+			Patterns:          patterns,
+			Threshold:         configFloat(cfg, "threshold", 0),
+			ObfuscationWeight: configFloat(cfg, "obfuscationWeight", 0),
+		}, nil
+	case "token-limit":
+		return &TokenLimitGuardrail{MaxTokens: configInt(cfg, "maxTokens", 4096)}, nil
+	case "loop-detection":
+		return &LoopDetectionGuardrail{
+			MaxRepeats:          configInt(cfg, "maxRepeats", 3),
+			SimilarityThreshold: configFloat(cfg, "similarityThreshold", 0),
+			HistorySize:         configInt(cfg, "historySize", 0),
+			MaxPeriod:           configInt(cfg, "maxPeriod", 0),
+			MaxExecutions:       configInt(cfg, "maxExecutions", 0),
+		}, nil
+	case "rate-limit":
+		rate := configInt(cfg, "rate", configInt(cfg, "maxPerMinute", 100))
+		per, err := configDuration(cfg, "per", time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		var store RateLimitStore
+		if shared, _ := cfg["shared"].(bool); shared && f.store != nil {
+			store = f.store
+		}
+		return NewTokenBucketLimiter(name, rate, per, configInt(cfg, "burst", rate), configStrings(cfg, "keys"), store), nil
+	case "schema-validation":
+		schema, _ := cfg["schema"].(map[string]interface{})
+		repair, _ := cfg["repair"].(bool)
+		g := &SchemaValidationGuardrail{
+			ExpectedFields: configStrings(cfg, "expectedFields"),
+			Schema:         schema,
+			Repair:         repair,
+		}
+		if _, err := g.compile(); err != nil {
+			return nil, fmt.Errorf("config.schema: %w", err)
+		}
+		return g, nil
+	case "budget":
+		var limits map[BudgetScope]BudgetLimit
+		if err := decodeConfig(cfg["limits"], &limits); err != nil {
+			return nil, fmt.Errorf("config.limits: %w", err)
+		}
+		var prices models.PriceTable
+		if err := decodeConfig(cfg["prices"], &prices); err != nil {
+			return nil, fmt.Errorf("config.prices: %w", err)
+		}
+		return NewBudgetGuardrail(limits, prices, f.store), nil
+	case "tool-allowlist":
+		var allowed map[string][]string
+		if err := decodeConfig(cfg["allow"], &allowed); err != nil {
+			return nil, fmt.Errorf("config.allow: %w", err)
+		}
+		return &ToolAllowlistGuardrail{Allowed: allowed}, nil
+	case "domain-allowlist":
+		httpsOnly, _ := cfg["httpsOnly"].(bool)
+		allowOther, _ := cfg["allowNonURL"].(bool)
+		return &DomainAllowlistGuardrail{Domains: configStrings(cfg, "domains"), HTTPSOnly: httpsOnly, AllowOther: allowOther}, nil
+	case "tool-args-validation":
+		// Each Tool resource's schema.input is enforced on its own; see
+		// applyDeclared. This type validates against the schema the caller
+		// passes for tools that are not declared as resources.
+		return &ToolArgsValidationGuardrail{}, nil
+	case "classifier":
+		uncertain, _ := cfg["uncertainAction"].(string)
+		switch uncertain {
+		case "", "block", "escalate":
+		default:
+			return nil, fmt.Errorf("config.uncertainAction must be block or escalate, got %q", uncertain)
+		}
+		g := &ClassifierGuardrail{
+			Threshold:       configFloat(cfg, "threshold", 0),
+			Ignore:          configStrings(cfg, "ignore"),
+			AllowedTopics:   configStrings(cfg, "allowedTopics"),
+			DeniedTopics:    configStrings(cfg, "deniedTopics"),
+			UncertainAction: uncertain,
+		}
+		if err := decodeConfig(cfg["thresholds"], &g.Thresholds); err != nil {
+			return nil, fmt.Errorf("config.thresholds: %w", err)
+		}
+		if path, _ := cfg["model"].(string); path != "" {
+			m, err := LoadClassifierModel(path)
+			if err != nil {
+				return nil, err
+			}
+			g.Model = m
+		}
+		return g, nil
+	case "grounding":
+		requireCitations, _ := cfg["requireCitations"].(bool)
+		contextKey, _ := cfg["contextKey"].(string)
+		return &GroundingGuardrail{
+			ContextKey:       contextKey,
+			MinSupport:       configFloat(cfg, "minSupport", 0),
+			Threshold:        configFloat(cfg, "threshold", 0),
+			RequireCitations: requireCitations,
+		}, nil
+	case "plugin":
+		health, err := configDuration(cfg, "healthInterval", 0)
+		if err != nil {
+			return nil, err
+		}
+		transport, _ := cfg["transport"].(string)
+		command, _ := cfg["command"].(string)
+		url, _ := cfg["url"].(string)
+		return NewPluginGuardrail(name, Phase(spec.Phase), PluginConfig{
+			Transport:      transport,
+			Command:        command,
+			Args:           configStrings(cfg, "args"),
+			Env:            configStrings(cfg, "env"),
+			URL:            url,
+			HealthInterval: health,
+		})
+	default:
+		return nil, fmt.Errorf("unknown guardrail type %q", spec.Type)
+	}
+}
+
+type resourceGuardrail struct {
+	Guardrail
+	id      string
+	spec    models.GuardrailSpec
+	timeout time.Duration
+}
+
+func (g *resourceGuardrail) ID() string { return g.id }
+
+func (g *resourceGuardrail) Phase() Phase {
+	if g.spec.Phase != "" {
+		return Phase(g.spec.Phase)
+	}
+	return g.Guardrail.Phase()
+}
+
+func (g *resourceGuardrail) Priority() int {
+	if g.spec.Priority != 0 {
+		return g.spec.Priority
+	}
+	return g.Guardrail.Priority()
+}
+
+func (g *resourceGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	result := g.Guardrail.Check(ctx, input)
+	result.GuardrailID = g.id
+	if !result.Passed && g.spec.Action != "" {
+		result.Action = g.spec.Action
+	}
+	return result
+}
+
+func (g *resourceGuardrail) Timeout() time.Duration {
+	return g.timeout
+}
+
+func (g *resourceGuardrail) FailurePolicy() FailurePolicy {
+	return FailurePolicy(g.spec.FailurePolicy)
+}
+
+func (g *resourceGuardrail) Shadow() bool {
+	return g.spec.Mode == "shadow"
+}
+
+func (g *resourceGuardrail) EscalationPolicy() *models.EscalationPolicy {
+	return g.spec.Escalation
+}
+
+func (g *resourceGuardrail) Close() error {
+	if c, ok := g.Guardrail.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (g *resourceGuardrail) Release(executionID string) error {
+	if r, ok := g.Guardrail.(ExecutionReleaser); ok {
+		return r.Release(executionID)
+	}
+	return nil
+}
+
+func (g *resourceGuardrail) Refund(input CheckInput) error {
+	if r, ok := g.Guardrail.(Refunder); ok {
+		return r.Refund(input)
+	}
+	return nil
+}
+
+func decodeConfig(in interface{}, out interface{}) error {
+	if in == nil {
+		return nil
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func configInt(cfg map[string]interface{}, key string, def int) int {
+	switch v := cfg[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return def
+}
+
+// configPatterns accepts either plain strings (weight 1) or
+// {pattern, weight} objects.
+func configPatterns(v interface{}) ([]InjectionPattern, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	patterns := make([]InjectionPattern, 0, len(items))
+	for i, item := range items {
+		switch p := item.(type) {
+		case string:
+			patterns = append(patterns, InjectionPattern{Pattern: p, Weight: 1})
+		default:
+			var ip InjectionPattern
+			if err := decodeConfig(p, &ip); err != nil || ip.Pattern == "" {
+				return nil, fmt.Errorf("config.patterns[%d]: expected string or {pattern, weight}", i)
+			}
+			patterns = append(patterns, ip)
+		}
+	}
+	return patterns, nil
+}
+
+func configFloat(cfg map[string]interface{}, key string, def float64) float64 {
+	switch v := cfg[key].(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return def
+}
+
+func configDuration(cfg map[string]interface{}, key string, def time.Duration) (time.Duration, error) {
+	s, ok := cfg[key].(string)
+	if !ok || s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("config.%s: %w", key, err)
+	}
+	return d, nil
+}
+
+func configStrings(cfg map[string]interface{}, key string) []string {
+	var out []string
+	if err := decodeConfig(cfg[key], &out); err != nil {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,328 @@
+package guardrails
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// GroundingGuardrail checks that the claims in an answer are supported by
+// the retrieved documents passed in input.Metadata[ContextKey]. The context
+// may be a string, a list of strings, or a list of {id, text} objects.
+//
+// Each sentence of the output is a claim. A claim is supported when enough
+// of its content words and word pairs appear in one document and every
+// number it states appears in that document. A claim that negates what the
+// document asserts, or asserts what it negates, is unsupported. The score
+// is the fraction of supported claims.
+type GroundingGuardrail struct {
+	ContextKey       string  // default "context"
+	MinSupport       float64 // per-claim overlap needed, default 0.5
+	Threshold        float64 // minimum score, default 0.8
+	RequireCitations bool    // every claim must cite a document, as [1] or [doc-id]
+}
+
+func (g *GroundingGuardrail) ID() string    { return "grounding" }
+func (g *GroundingGuardrail) Phase() Phase  { return PhasePost }
+func (g *GroundingGuardrail) Priority() int { return 70 }
+
+type groundingDoc struct {
+	id       string
+	words    map[string]bool
+	bigrams  map[string]bool
+	numbers  map[string]bool
+	negated  map[string]bool // words following a negation
+	asserted map[string]bool // words not following one
+}
+
+func (g *GroundingGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	key := g.ContextKey
+	if key == "" {
+		key = "context"
+	}
+	docs := groundingDocs(input.Metadata[key])
+	if len(docs) == 0 {
+		return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "no context to ground against"}
+	}
+
+	minSupport := g.MinSupport
+	if minSupport <= 0 {
+		minSupport = 0.5
+	}
+	threshold := g.Threshold
+	if threshold <= 0 {
+		threshold = 0.8
+	}
+
+	var claims, supported int
+	var unsupported []string
+	for _, sentence := range splitSentences(input.Output) {
+		if err := ctx.Err(); err != nil {
+			return CheckResult{GuardrailID: g.ID(), Err: err}
+		}
+		words := contentWords(sentence)
+		if len(words) < 3 {
+			continue // greetings, fragments and the like make no claim
+		}
+		claims++
+
+		candidates := docs
+		cited := citedDocs(sentence, docs)
+		if len(cited) > 0 {
+			candidates = cited
+		} else if g.RequireCitations {
+			unsupported = append(unsupported, truncate(sentence, 60)+" (no citation)")
+			continue
+		}
+
+		best := 0.0
+		for _, d := range candidates {
+			if s := claimSupport(words, d); s > best {
+				best = s
+			}
+		}
+		if best >= minSupport {
+			supported++
+		} else {
+			unsupported = append(unsupported, fmt.Sprintf("%s (%.2f)", truncate(sentence, 60), best))
+		}
+	}
+	if claims == 0 {
+		return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "output makes no claims"}
+	}
+
+	score := float64(supported) / float64(claims)
+	if score < threshold {
+		return CheckResult{
+			Passed:      false,
+			GuardrailID: g.ID(),
+			Message: fmt.Sprintf("grounding score %.2f < %.2f: %d of %d claims unsupported: %s",
+				score, threshold, claims-supported, claims, strings.Join(firstN(unsupported, 3), "; ")),
+			Action: "warn",
+		}
+	}
+	return CheckResult{Passed: true, GuardrailID: g.ID(), Message: fmt.Sprintf("grounding score %.2f (%d claims)", score, claims)}
+}
+
+// claimSupport blends unigram and bigram coverage of the claim by the
+// document. A number missing from the document, or a word the claim and
+// the document disagree on negating, makes the claim unsupported.
+func claimSupport(words []string, d groundingDoc) float64 {
+	var uni, bi, pairs int
+	for i, w := range words {
+		if isNumber(w) && !d.numbers[w] {
+			return 0
+		}
+		if !groundingNegations[w] {
+			if i > 0 && groundingNegations[words[i-1]] {
+				if !d.negated[w] {
+					return 0
+				}
+			} else if d.negated[w] && !d.asserted[w] {
+				return 0
+			}
+		}
+		if d.words[w] {
+			uni++
+		}
+		if i > 0 {
+			pairs++
+			if d.bigrams[words[i-1]+" "+w] {
+				bi++
+			}
+		}
+	}
+	score := 0.6 * float64(uni) / float64(len(words))
+	if pairs > 0 {
+		score += 0.4 * float64(bi) / float64(pairs)
+	}
+	return score
+}
+
+func groundingDocs(v interface{}) []groundingDoc {
+	var docs []groundingDoc
+	add := func(id, text string) {
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		d := groundingDoc{
+			id:       id,
+			words:    map[string]bool{},
+			bigrams:  map[string]bool{},
+			numbers:  map[string]bool{},
+			negated:  map[string]bool{},
+			asserted: map[string]bool{},
+		}
+		words := contentWords(text)
+		for i, w := range words {
+			d.words[w] = true
+			if isNumber(w) {
+				d.numbers[w] = true
+			}
+			if i > 0 && groundingNegations[words[i-1]] {
+				d.negated[w] = true
+			} else {
+				d.asserted[w] = true
+			}
+			if i > 0 {
+				d.bigrams[words[i-1]+" "+w] = true
+			}
+		}
+		docs = append(docs, d)
+	}
+
+	switch c := v.(type) {
+	case string:
+		add("1", c)
+	case []string:
+		for i, s := range c {
+			add(strconv.Itoa(i+1), s)
+		}
+	case []interface{}:
+		for i, item := range c {
+			id := strconv.Itoa(i + 1)
+			switch doc := item.(type) {
+			case string:
+				add(id, doc)
+			case map[string]interface{}:
+				if s, ok := doc["id"].(string); ok && s != "" {
+					id = s
+				}
+				text, _ := doc["text"].(string)
+				if text == "" {
+					text, _ = doc["content"].(string)
+				}
+				add(id, text)
+			}
+		}
+	}
+	return docs
+}
+
+var citationRef = regexp.MustCompile(`\[([^\[\]]{1,64})\]`)
+
+// citedDocs returns the documents a sentence cites. "[1]" refers to the
+// first document; other bracketed text is matched against document IDs.
+func citedDocs(sentence string, docs []groundingDoc) []groundingDoc {
+	var out []groundingDoc
+	for _, m := range citationRef.FindAllStringSubmatch(sentence, -1) {
+		for _, ref := range strings.Split(m[1], ",") {
+			ref = strings.TrimSpace(ref)
+			for i, d := range docs {
+				if d.id == ref || strconv.Itoa(i+1) == ref {
+					out = append(out, d)
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+func splitSentences(text string) []string {
+	var out []string
+	start := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		end := r == '\n'
+		if r == '.' || r == '!' || r == '?' {
+			// Keep decimals such as 3.5 inside the sentence.
+			end = i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+		}
+		if end {
+			if s := strings.TrimSpace(string(runes[start : i+1])); s != "" {
+				out = append(out, s)
+			}
+			start = i + 1
+		}
+	}
+	if s := strings.TrimSpace(string(runes[start:])); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// contentWords lowercases, drops stopwords and citation markers, and strips
+// common English suffixes so "prices" and "price" compare equal.
+func contentWords(text string) []string {
+	text = citationRef.ReplaceAllString(text, " ")
+	fields := strings.FieldsFunc(expandNegations.Replace(normalizeText(text)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != ','
+	})
+	words := make([]string, 0, len(fields))
+	for _, f := range fields {
+		f = strings.Trim(f, ".,")
+		if isNumber(f) {
+			words = append(words, strings.ReplaceAll(f, ",", ""))
+			continue
+		}
+		f = strings.NewReplacer(".", "", ",", "").Replace(f)
+		if f == "" || groundingStopwords[f] {
+			continue
+		}
+		words = append(words, stem(f))
+	}
+	return words
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	return err == nil
+}
+
+func stem(w string) string {
+	for _, suffix := range []string{"ing", "ed", "es", "s"} {
+		if len(w) > len(suffix)+3 && strings.HasSuffix(w, suffix) {
+			return w[:len(w)-len(suffix)]
+		}
+	}
+	return w
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
+
+func firstN(s []string, n int) []string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// groundingNegations are kept as content words: "is not available" must
+// not match a document saying "is available".
+var groundingNegations = map[string]bool{
+	"not": true, "no": true, "never": true, "none": true, "nor": true, "neither": true, "without": true,
+}
+
+// expandNegations splits contractions so their negation survives
+// tokenization, which breaks words at apostrophes.
+var expandNegations = strings.NewReplacer(
+	"cannot", "can not",
+	"can't", "can not", "can’t", "can not",
+	"won't", "will not", "won’t", "will not",
+	"n't", " not", "n’t", " not",
+)
+
+var groundingStopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "but": true, "of": true, "to": true,
+	"in": true, "on": true, "at": true, "for": true, "with": true, "by": true, "from": true, "as": true,
+	"is": true, "are": true, "was": true, "were": true, "be": true, "been": true, "it": true, "its": true,
+	"this": true, "that": true, "these": true, "those": true, "there": true, "their": true, "they": true,
+	"we": true, "you": true, "your": true, "our": true, "i": true, "he": true, "she": true, "his": true,
+	"her": true, "has": true, "have": true, "had": true, "do": true, "does": true, "did": true,
+	"so": true, "if": true, "than": true, "then": true, "also": true, "which": true, "who": true, "can": true,
+	"will": true, "would": true, "should": true, "could": true, "may": true, "about": true, "into": true,
+	"according": true, "based": true, "document": true, "source": true,
+}
@@ -0,0 +1,31 @@
+package guardrails
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGroundingNegation(t *testing.T) {
+	g := &GroundingGuardrail{}
+	tests := []struct {
+		name    string
+		context string
+		output  string
+		passed  bool
+	}{
+		{"same claim", "The premium plan is available in Europe.", "The premium plan is available in Europe.", true},
+		{"claim negates source", "The premium plan is available in Europe.", "The premium plan is not available in Europe.", false},
+		{"source negates claim", "The premium plan is not available in Europe.", "The premium plan is available in Europe.", false},
+		{"both negate", "The premium plan is not available in Europe.", "The premium plan isn't available in Europe.", true},
+		{"never versus always", "Refunds are processed within five days.", "Refunds are never processed within five days.", false},
+		{"contraction", "Support does not answer calls on weekends.", "Support answers calls on weekends.", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := g.Check(context.Background(), CheckInput{Output: tt.output, Metadata: map[string]interface{}{"context": tt.context}, Phase: PhasePost})
+			if r.Passed != tt.passed {
+				t.Fatalf("passed = %v, want %v: %s", r.Passed, tt.passed, r.Message)
+			}
+		})
+	}
+}
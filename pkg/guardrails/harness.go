@@ -0,0 +1,192 @@
+package guardrails
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/observability"
+)
+
+// TestCase is one row of a guardrail test table. Expect is "pass" or the
+// action a failing check must report (block, warn, log or escalate).
+// Cases sharing an Execution run against the same execution ID, in order,
+// so stateful guardrails such as loop detection can be exercised.
+type TestCase struct {
+	Name            string                 `yaml:"name" json:"name"`
+	Phase           Phase                  `yaml:"phase,omitempty" json:"phase,omitempty"`
+	Prompt          string                 `yaml:"prompt,omitempty" json:"prompt,omitempty"`
+	Output          string                 `yaml:"output,omitempty" json:"output,omitempty"`
+	TokenCount      int                    `yaml:"tokenCount,omitempty" json:"tokenCount,omitempty"`
+	AgentName       string                 `yaml:"agent,omitempty" json:"agent,omitempty"`
+	Namespace       string                 `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	ModelProvider   string                 `yaml:"provider,omitempty" json:"provider,omitempty"`
+	ModelName       string                 `yaml:"model,omitempty" json:"model,omitempty"`
+	ToolName        string                 `yaml:"tool,omitempty" json:"tool,omitempty"`
+	ToolArgs        map[string]interface{} `yaml:"toolArgs,omitempty" json:"toolArgs,omitempty"`
+	ToolTarget      string                 `yaml:"toolTarget,omitempty" json:"toolTarget,omitempty"`
+	Execution       string                 `yaml:"execution,omitempty" json:"execution,omitempty"`
+	Metadata        map[string]interface{} `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	Expect          string                 `yaml:"expect" json:"expect"`
+	MessageContains string                 `yaml:"messageContains,omitempty" json:"messageContains,omitempty"`
+}
+
+type CaseResult struct {
+	Name     string        `json:"name"`
+	Phase    Phase         `json:"phase"`
+	Expect   string        `json:"expect"`
+	Got      string        `json:"got"`
+	Message  string        `json:"message"`
+	Passed   bool          `json:"passed"`
+	Reason   string        `json:"reason,omitempty"`
+	Duration time.Duration `json:"durationNs"`
+}
+
+type TestReport struct {
+	Guardrail string       `json:"guardrail"`
+	Total     int          `json:"total"`
+	Passed    int          `json:"passed"`
+	Failed    int          `json:"failed"`
+	Cases     []CaseResult `json:"cases"`
+}
+
+func (r *TestReport) OK() bool {
+	return r.Failed == 0
+}
+
+// RunCases runs g against each case the way the engine would, with the same
+// timeout and failure policy handling, but without shadow mode or approvals
+// so the raw verdict is what gets compared.
+func RunCases(ctx context.Context, g Guardrail, cases []TestCase, logger *observability.Logger) *TestReport {
+	e := &Engine{
+		cfg:     Config{Timeout: 5 * time.Second, FailurePolicy: FailClosed},
+		metrics: observability.NewMetricsRegistry(),
+		logger:  logger.With("harness"),
+	}
+	report := &TestReport{Guardrail: g.ID(), Cases: make([]CaseResult, 0, len(cases))}
+
+	steps := make(map[string]int)
+	for i, tc := range cases {
+		if tc.Name == "" {
+			tc.Name = fmt.Sprintf("case-%d", i+1)
+		}
+		execID := tc.Execution
+		if execID == "" {
+			execID = fmt.Sprintf("test-%d", i+1)
+		}
+		input := CheckInput{
+			Prompt:        tc.Prompt,
+			Output:        tc.Output,
+			TokenCount:    tc.TokenCount,
+			AgentName:     tc.AgentName,
+			Namespace:     tc.Namespace,
+			ModelProvider: tc.ModelProvider,
+			ModelName:     tc.ModelName,
+			ToolName:      tc.ToolName,
+			ToolArgs:      tc.ToolArgs,
+			ToolTarget:    tc.ToolTarget,
+			ExecutionID:   execID,
+			StepIndex:     steps[execID],
+			Phase:         casePhase(g, tc),
+			Metadata:      tc.Metadata,
+		}
+		steps[execID]++
+
+		start := time.Now()
+		result := e.check(ctx, e.cfg, g, input)
+		cr := CaseResult{
+			Name:     tc.Name,
+			Phase:    input.Phase,
+			Expect:   strings.ToLower(tc.Expect),
+			Got:      verdict(result),
+			Message:  result.Message,
+			Duration: time.Since(start),
+		}
+		if cr.Expect == "" {
+			cr.Expect = "pass"
+		}
+		switch {
+		case cr.Got != cr.Expect:
+			cr.Reason = fmt.Sprintf("expected %s, got %s", cr.Expect, cr.Got)
+		case tc.MessageContains != "" && !strings.Contains(result.Message, tc.MessageContains):
+			cr.Reason = fmt.Sprintf("message %q does not contain %q", result.Message, tc.MessageContains)
+		default:
+			cr.Passed = true
+		}
+
+		report.Total++
+		if cr.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Cases = append(report.Cases, cr)
+	}
+
+	for execID := range steps {
+		if r, ok := g.(ExecutionReleaser); ok {
+			r.Release(execID)
+		}
+	}
+	return report
+}
+
+// casePhase picks the phase for a case when the guardrail runs in both:
+// cases with an output are post checks, the rest pre checks. A guardrail
+// that also runs on tool calls checks cases naming a tool as tool calls.
+func casePhase(g Guardrail, tc TestCase) Phase {
+	if tc.Phase != "" {
+		return tc.Phase
+	}
+	p := g.Phase()
+	if p != "both" && p != PhaseAll {
+		return p
+	}
+	if p == PhaseAll && tc.ToolName != "" {
+		return PhaseTool
+	}
+	if tc.Output != "" {
+		return PhasePost
+	}
+	return PhasePre
+}
+
+func verdict(r CheckResult) string {
+	if r.Passed {
+		return "pass"
+	}
+	if r.Action == "" {
+		return "block"
+	}
+	return r.Action
+}
+
+// WriteText prints one line per case and a summary, in a form that reads
+// well in CI logs.
+func (r *TestReport) WriteText(w io.Writer) error {
+	for _, c := range r.Cases {
+		status := "PASS"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		if _, err := fmt.Fprintf(w, "%s  %-30s %-5s %-8s %s\n", status, c.Name, c.Phase, c.Got, c.Message); err != nil {
+			return err
+		}
+		if !c.Passed {
+			if _, err := fmt.Fprintf(w, "      %s\n", c.Reason); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%s: %d passed, %d failed, %d total\n", r.Guardrail, r.Passed, r.Failed, r.Total)
+	return err
+}
+
+func (r *TestReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -1,15 +1,52 @@
 package guardrails
 
 import (
-	"crypto/sha256"
+	"container/list"
+	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"strings"
 	"sync"
+	"unicode"
 )
 
+const (
+	defaultLoopHistory       = 64
+	defaultLoopSimilarity    = 0.9
+	defaultLoopMaxPeriod     = 4
+	defaultLoopMaxExecutions = 10000
+	minHashSize              = 32
+)
+
+// LoopDetectionGuardrail keeps a bounded history per execution and phase and
+// flags exact repeats, near-duplicates (MinHash over word shingles) and
+// oscillation cycles such as A→B→A→B. Model calls are compared by prompt and
+// output; tool calls by tool and arguments, and cycle by tool name. State is
+// dropped by Release once the execution is terminal; MaxExecutions caps it
+// for executions never released.
 type LoopDetectionGuardrail struct {
-	MaxRepeats int
-	mu         sync.Mutex
-	seen       map[string]int //hash -> count
+	MaxRepeats          int
+	SimilarityThreshold float64 // 0 uses the default, >1 disables near-duplicate detection
+	HistorySize         int
+	MaxPeriod           int
+	MaxExecutions       int
+
+	mu     sync.Mutex
+	states map[string]*list.Element // values are *loopState
+	lru    *list.List               // most recently used first
+}
+
+type loopEntry struct {
+	hash      uint64
+	signature string
+	minhash   [minHashSize]uint64
+}
+
+type loopState struct {
+	key     string
+	entries []loopEntry // ring buffer, oldest first once full
+	next    int
 }
 
 func (g *LoopDetectionGuardrail) ID() string {
@@ -17,35 +54,233 @@ func (g *LoopDetectionGuardrail) ID() string {
 }
 
 func (g *LoopDetectionGuardrail) Phase() Phase {
-	return "both"
+	return PhaseAll
 }
 
 func (g *LoopDetectionGuardrail) Priority() int {
 	return 80
 }
 
-func (g *LoopDetectionGuardrail) Check(input CheckInput) CheckResult {
+func (g *LoopDetectionGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	if g.seen == nil {
-		g.seen = make(map[string]int)
+	if g.states == nil {
+		g.states = make(map[string]*list.Element)
+		g.lru = list.New()
 	}
 
-	content := input.Prompt + "|" + input.Output
-	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
-	key := input.ExecutionID + ":" + hash
+	key := loopKey(input.ExecutionID, input.Phase)
+	var st *loopState
+	if el, ok := g.states[key]; ok {
+		g.lru.MoveToFront(el)
+		st = el.Value.(*loopState)
+	} else {
+		g.evict()
+		st = &loopState{key: key}
+		g.states[key] = g.lru.PushFront(st)
+	}
 
-	g.seen[key]++
-	count := g.seen[key]
+	content := input.Prompt + "|" + input.Output
+	if input.Phase == PhaseTool {
+		args, _ := json.Marshal(input.ToolArgs) // map keys are sorted
+		content = input.ToolName + "|" + string(args)
+	}
+	entry := loopEntry{hash: hash64(content), minhash: minHash(content)}
+	entry.signature = fmt.Sprintf("%x", entry.hash)
+	if input.Phase == PhaseTool {
+		entry.signature = input.ToolName
+	}
 
-	if count > g.MaxRepeats {
-		return CheckResult{
-			Passed:      false,
-			GuardrailID: g.ID(),
-			Message:     fmt.Sprintf("loop detected: same content repeated %d times (max %d)", count, g.MaxRepeats),
-			Action:      "block",
+	history := st.ordered()
+	exact, similar := 1, 1
+	threshold := g.similarity()
+	for _, prev := range history {
+		if prev.hash == entry.hash {
+			exact++
+			similar++
+		} else if threshold <= 1 && jaccard(prev.minhash, entry.minhash) >= threshold {
+			similar++
 		}
 	}
+	st.push(entry, g.historySize())
+
+	if exact > g.MaxRepeats {
+		return g.block(fmt.Sprintf("loop detected: same content repeated %d times (max %d)", exact, g.MaxRepeats))
+	}
+	if similar > g.MaxRepeats {
+		return g.block(fmt.Sprintf("loop detected: near-duplicate content repeated %d times (similarity >= %.2f, max %d)", similar, threshold, g.MaxRepeats))
+	}
+	if cycle := g.oscillation(append(history, entry)); cycle != "" {
+		return g.block(fmt.Sprintf("loop detected: oscillation %s repeated %d times", cycle, g.cycleRepeats()))
+	}
 	return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "no loop detected"}
 }
+
+// Release drops all state held for an execution.
+func (g *LoopDetectionGuardrail) Release(executionID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, phase := range []Phase{PhasePre, PhasePost, PhaseTool} {
+		key := loopKey(executionID, phase)
+		if el, ok := g.states[key]; ok {
+			g.lru.Remove(el)
+			delete(g.states, key)
+		}
+	}
+	return nil
+}
+
+func loopKey(executionID string, phase Phase) string {
+	return executionID + "/" + string(phase)
+}
+
+func (g *LoopDetectionGuardrail) block(msg string) CheckResult {
+	return CheckResult{
+		Passed:      false,
+		GuardrailID: g.ID(),
+		Message:     msg,
+		Action:      "block",
+	}
+}
+
+// oscillation looks for the tail of the sequence being a cycle of 2..MaxPeriod
+// distinct steps repeated MaxRepeats times.
+func (g *LoopDetectionGuardrail) oscillation(seq []loopEntry) string {
+	maxPeriod := g.MaxPeriod
+	if maxPeriod == 0 {
+		maxPeriod = defaultLoopMaxPeriod
+	}
+	repeats := g.cycleRepeats()
+	for period := 2; period <= maxPeriod; period++ {
+		n := period * repeats
+		if len(seq) < n {
+			break
+		}
+		tail := seq[len(seq)-n:]
+		cyclic := true
+		for i := period; i < n; i++ {
+			if tail[i].signature != tail[i-period].signature {
+				cyclic = false
+				break
+			}
+		}
+		if !cyclic || tail[0].signature == tail[1].signature {
+			continue
+		}
+		names := make([]string, 0, period+1)
+		for _, e := range tail[:period] {
+			names = append(names, shortSignature(e.signature))
+		}
+		names = append(names, names[0])
+		return strings.Join(names, "→")
+	}
+	return ""
+}
+
+// evict removes the least recently used execution once MaxExecutions is
+// reached. Must be called with g.mu held.
+func (g *LoopDetectionGuardrail) evict() {
+	limit := g.MaxExecutions
+	if limit == 0 {
+		limit = defaultLoopMaxExecutions
+	}
+	for len(g.states) >= limit {
+		oldest := g.lru.Back()
+		g.lru.Remove(oldest)
+		delete(g.states, oldest.Value.(*loopState).key)
+	}
+}
+
+// cycleRepeats is how many times a cycle must repeat to be flagged; a
+// single pass through it is not a loop.
+func (g *LoopDetectionGuardrail) cycleRepeats() int {
+	if g.MaxRepeats < 2 {
+		return 2
+	}
+	return g.MaxRepeats
+}
+
+func (g *LoopDetectionGuardrail) similarity() float64 {
+	if g.SimilarityThreshold == 0 {
+		return defaultLoopSimilarity
+	}
+	return g.SimilarityThreshold
+}
+
+func (g *LoopDetectionGuardrail) historySize() int {
+	if g.HistorySize == 0 {
+		return defaultLoopHistory
+	}
+	return g.HistorySize
+}
+
+func (s *loopState) push(e loopEntry, size int) {
+	if len(s.entries) < size {
+		s.entries = append(s.entries, e)
+		return
+	}
+	s.entries[s.next] = e
+	s.next = (s.next + 1) % size
+}
+
+func (s *loopState) ordered() []loopEntry {
+	out := make([]loopEntry, 0, len(s.entries)+1)
+	out = append(out, s.entries[s.next:]...)
+	return append(out, s.entries[:s.next]...)
+}
+
+func shortSignature(sig string) string {
+	if len(sig) > 12 {
+		return sig[:12]
+	}
+	return sig
+}
+
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// minHash signs the word 3-shingles of s so that the fraction of equal slots
+// between two signatures estimates their Jaccard similarity.
+func minHash(s string) [minHashSize]uint64 {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	width := 3
+	if len(words) < width {
+		width = len(words)
+	}
+
+	var sig [minHashSize]uint64
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	for i := 0; i+width <= len(words) && width > 0; i++ {
+		base := hash64(strings.Join(words[i:i+width], " "))
+		for j := range sig {
+			// Cheap independent permutations derived from one base hash.
+			h := (base ^ uint64(j)*0x9e3779b97f4a7c15) * 0xbf58476d1ce4e5b9
+			h ^= h >> 31
+			if h < sig[j] {
+				sig[j] = h
+			}
+		}
+	}
+	return sig
+}
+
+func jaccard(a, b [minHashSize]uint64) float64 {
+	if a[0] == ^uint64(0) || b[0] == ^uint64(0) {
+		return 0 // no words to compare
+	}
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / minHashSize
+}
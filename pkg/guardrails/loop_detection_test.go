@@ -0,0 +1,139 @@
+package guardrails
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLoopDetection(t *testing.T) {
+	model := func(prompt, output string) CheckInput {
+		return CheckInput{ExecutionID: "e1", Phase: PhasePost, Prompt: prompt, Output: output}
+	}
+	tool := func(name, query string) CheckInput {
+		return CheckInput{ExecutionID: "e1", Phase: PhaseTool, ToolName: name, ToolArgs: map[string]interface{}{"query": query}}
+	}
+	answer := "The quarterly report shows revenue grew by twelve percent while costs stayed flat across all regions. " +
+		"Europe led the growth with new enterprise contracts, North America held steady after the price change, " +
+		"and Asia recovered from a slow first month once the partner program launched in the second half."
+
+	for _, tc := range []struct {
+		name       string
+		maxRepeats int
+		calls      []CheckInput
+		blockedAt  int // index of the first blocked call, -1 for none
+		message    string
+	}{
+		{
+			name:       "exact repeats",
+			maxRepeats: 2,
+			calls:      []CheckInput{model("summarize", answer), model("summarize", answer), model("summarize", answer)},
+			blockedAt:  2,
+			message:    "same content repeated 3 times (max 2)",
+		},
+		{
+			name:       "distinct outputs",
+			maxRepeats: 2,
+			calls:      []CheckInput{model("summarize", answer), model("summarize", "Revenue is down"), model("summarize", "Costs rose")},
+			blockedAt:  -1,
+		},
+		{
+			name:       "near-duplicate outputs",
+			maxRepeats: 2,
+			calls: []CheckInput{
+				model("summarize", answer),
+				model("summarize", answer+" again"),
+				model("summarize", answer+" once more"),
+			},
+			blockedAt: 2,
+			message:   "near-duplicate content repeated 3 times",
+		},
+		{
+			name:       "A-B-A-B tool calls",
+			maxRepeats: 2,
+			calls:      []CheckInput{tool("search", "a"), tool("fetch", "b"), tool("search", "c"), tool("fetch", "d")},
+			blockedAt:  3,
+			message:    "oscillation search→fetch→search repeated 2 times",
+		},
+		{
+			name:       "A-B-C cycle",
+			maxRepeats: 2,
+			calls: []CheckInput{
+				tool("search", "1"), tool("fetch", "2"), tool("parse", "3"),
+				tool("search", "4"), tool("fetch", "5"), tool("parse", "6"),
+			},
+			blockedAt: 5,
+			message:   "oscillation search→fetch→parse→search",
+		},
+		{
+			name:       "cycle repeats are clamped to two",
+			maxRepeats: 1,
+			calls:      []CheckInput{tool("search", "a"), tool("fetch", "b"), tool("search", "c"), tool("fetch", "d")},
+			blockedAt:  3,
+			message:    "repeated 2 times",
+		},
+		{
+			name:       "same tool with new arguments",
+			maxRepeats: 2,
+			calls:      []CheckInput{tool("search", "a"), tool("search", "b"), tool("search", "c")},
+			blockedAt:  -1,
+		},
+		{
+			name:       "same tool call repeated",
+			maxRepeats: 2,
+			calls:      []CheckInput{tool("search", "a"), tool("search", "a"), tool("search", "a")},
+			blockedAt:  2,
+			message:    "same content repeated 3 times",
+		},
+	} {
+		g := &LoopDetectionGuardrail{MaxRepeats: tc.maxRepeats}
+		blockedAt := -1
+		var msg string
+		for i, in := range tc.calls {
+			if r := g.Check(context.Background(), in); !r.Passed {
+				blockedAt, msg = i, r.Message
+				break
+			}
+		}
+		if blockedAt != tc.blockedAt {
+			t.Errorf("%s: blocked at call %d (%q), want %d", tc.name, blockedAt, msg, tc.blockedAt)
+			continue
+		}
+		if !strings.Contains(msg, tc.message) {
+			t.Errorf("%s: message %q, want it to contain %q", tc.name, msg, tc.message)
+		}
+	}
+}
+
+func TestLoopDetectionReleasesEveryPhase(t *testing.T) {
+	g := &LoopDetectionGuardrail{MaxRepeats: 3}
+	for _, phase := range []Phase{PhasePre, PhasePost, PhaseTool} {
+		g.Check(context.Background(), CheckInput{ExecutionID: "e1", Phase: phase, Prompt: "p", ToolName: "search"})
+		g.Check(context.Background(), CheckInput{ExecutionID: "e2", Phase: phase, Prompt: "p", ToolName: "search"})
+	}
+	if err := g.Release("e1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.states) != 3 || g.lru.Len() != 3 {
+		t.Fatalf("after release: %d states, %d in LRU; want e2's 3", len(g.states), g.lru.Len())
+	}
+	for key := range g.states {
+		if !strings.HasPrefix(key, "e2/") {
+			t.Errorf("state %s kept", key)
+		}
+	}
+}
+
+func TestEngineDetectsToolCallLoops(t *testing.T) {
+	e := newTestEngine()
+	var err error
+	// The default engine flags a cycle repeated three times.
+	for i := 0; i < 6 && err == nil; i++ {
+		name := []string{"search", "fetch"}[i%2]
+		_, err = e.RunTool(context.Background(), CheckInput{ExecutionID: "e1", ToolName: name, ToolArgs: map[string]interface{}{"n": fmt.Sprint(i)}})
+	}
+	if err == nil || !strings.Contains(err.Error(), "oscillation") {
+		t.Fatalf("tool call cycle not blocked: %v", err)
+	}
+}
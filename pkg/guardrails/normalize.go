@@ -0,0 +1,142 @@
+package guardrails
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables maps common Cyrillic and Greek lookalikes (after lowercasing)
+// to the Latin letter they imitate.
+var confusables = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd',
+	'ɡ': 'g', 'ӏ': 'l', 'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ı': 'i',
+}
+
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's', '!': 'i', '|': 'l',
+}
+
+var (
+	base64Token = regexp.MustCompile(`[A-Za-z0-9+/_-]{16,}={0,2}`)
+	hexToken    = regexp.MustCompile(`\b(?:[0-9a-fA-F]{2}){8,}\b`)
+)
+
+// foldMarks applies NFKC after decomposing and dropping combining marks, so
+// fullwidth, mathematical and circled letters fold to ASCII and accented
+// letters lose their accents.
+var foldMarks = transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFKC)
+
+// normalizeText folds s with NFKC and maps confusables: format characters
+// (zero-width, bidi controls) and combining marks are dropped, compatibility
+// forms fold to their canonical letters, lookalike letters map to Latin and
+// runs of whitespace collapse to a single space.
+func normalizeText(s string) string {
+	if folded, _, err := transform.String(foldMarks, s); err == nil {
+		s = folded
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		if unicode.Is(unicode.Cf, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		if unicode.IsSpace(r) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func deLeet(s string) string {
+	return strings.Map(func(r rune) rune {
+		if c, ok := leetspeak[r]; ok {
+			return c
+		}
+		return r
+	}, s)
+}
+
+// despace rejoins letters spelled out with separators, so "i g n o r e" and
+// "i.g.n.o.r.e" read as "ignore". Only whitespace and the separators in
+// despaceSeparator split words; other punctuation stays part of its word so
+// a pattern such as "system prompt:" still needs its colon.
+func despace(s string) string {
+	tokens := strings.FieldsFunc(s, despaceSeparator)
+	var b strings.Builder
+	run := false
+	for _, tok := range tokens {
+		single := utf8.RuneCountInString(tok) == 1
+		if b.Len() > 0 && !(single && run) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok)
+		run = single
+	}
+	return b.String()
+}
+
+func despaceSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(".-_*·•", r)
+}
+
+// decodeEmbedded returns printable payloads hidden in s as base64, hex or
+// percent-encoding.
+func decodeEmbedded(s string) []string {
+	var out []string
+	for _, tok := range base64Token.FindAllString(s, -1) {
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+			if data, err := enc.DecodeString(tok); err == nil && isPrintable(data) {
+				out = append(out, string(data))
+				break
+			}
+		}
+	}
+	for _, tok := range hexToken.FindAllString(s, -1) {
+		if data, err := hex.DecodeString(tok); err == nil && isPrintable(data) {
+			out = append(out, string(data))
+		}
+	}
+	if strings.Contains(s, "%") {
+		if dec, err := url.QueryUnescape(s); err == nil && dec != s {
+			out = append(out, dec)
+		}
+	}
+	return out
+}
+
+func isPrintable(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+	printable := 0
+	total := 0
+	for _, r := range string(data) {
+		total++
+		if unicode.IsPrint(r) || unicode.IsSpace(r) {
+			printable++
+		}
+	}
+	return float64(printable)/float64(total) > 0.9
+}
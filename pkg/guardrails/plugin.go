@@ -0,0 +1,482 @@
+package guardrails
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/observability"
+)
+
+const (
+	PluginStdio = "stdio"
+	PluginHTTP  = "http"
+
+	pluginMaxBackoff = 30 * time.Second
+)
+
+type PluginConfig struct {
+	Transport      string        // stdio (default) or http
+	Command        string        // started and supervised for stdio; optional for http
+	Args           []string      //
+	Env            []string      // extra KEY=VALUE pairs
+	URL            string        // base URL for http, must be a loopback address
+	HealthInterval time.Duration // 0 disables background health checks
+}
+
+// PluginGuardrail delegates Check to an external process speaking JSON-RPC
+// 2.0 over newline-delimited stdio, or to a loopback HTTP server exposing
+// POST /check and GET /health. Crashed or unhealthy processes are restarted
+// with exponential backoff.
+type PluginGuardrail struct {
+	id     string
+	phase  Phase
+	cfg    PluginConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	proc      *pluginProcess
+	failures  int
+	nextStart time.Time
+	healthy   bool
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+}
+
+type pluginCheckParams struct {
+	Prompt           string                 `json:"prompt"`
+	Output           string                 `json:"output"`
+	TokenCount       int                    `json:"tokenCount"`
+	PromptTokens     int                    `json:"promptTokens"`
+	CompletionTokens int                    `json:"completionTokens"`
+	AgentName        string                 `json:"agentName"`
+	Namespace        string                 `json:"namespace"`
+	ModelProvider    string                 `json:"modelProvider"`
+	ModelName        string                 `json:"modelName"`
+	ToolName         string                 `json:"toolName,omitempty"`
+	ToolArgs         map[string]interface{} `json:"toolArgs,omitempty"`
+	ToolTarget       string                 `json:"toolTarget,omitempty"`
+	ExecutionID      string                 `json:"executionId"`
+	Step             int                    `json:"step"`
+	Phase            Phase                  `json:"phase"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type pluginCheckResult struct {
+	Passed  bool    `json:"passed"`
+	Message string  `json:"message"`
+	Action  string  `json:"action"`
+	Score   float64 `json:"score"`
+}
+
+func NewPluginGuardrail(id string, phase Phase, cfg PluginConfig) (*PluginGuardrail, error) {
+	if cfg.Transport == "" {
+		cfg.Transport = PluginStdio
+	}
+	switch cfg.Transport {
+	case PluginStdio:
+		if cfg.Command == "" {
+			return nil, fmt.Errorf("plugin: command is required for stdio transport")
+		}
+	case PluginHTTP:
+		if err := requireLoopback(cfg.URL); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("plugin: unknown transport %q", cfg.Transport)
+	}
+	if phase == "" {
+		phase = "both"
+	}
+
+	g := &PluginGuardrail{
+		id:      id,
+		phase:   phase,
+		cfg:     cfg,
+		client:  &http.Client{Transport: observability.NewTransport(nil, nil)},
+		healthy: true,
+		stopCh:  make(chan struct{}),
+	}
+	if cfg.HealthInterval > 0 {
+		go g.healthLoop()
+	}
+	return g, nil
+}
+
+func (g *PluginGuardrail) ID() string    { return g.id }
+func (g *PluginGuardrail) Phase() Phase  { return g.phase }
+func (g *PluginGuardrail) Priority() int { return 60 }
+
+func (g *PluginGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	params := pluginCheckParams{
+		Prompt:           input.Prompt,
+		Output:           input.Output,
+		TokenCount:       input.TokenCount,
+		PromptTokens:     input.PromptTokens,
+		CompletionTokens: input.CompletionTokens,
+		AgentName:        input.AgentName,
+		Namespace:        input.Namespace,
+		ModelProvider:    input.ModelProvider,
+		ModelName:        input.ModelName,
+		ToolName:         input.ToolName,
+		ToolArgs:         input.ToolArgs,
+		ToolTarget:       input.ToolTarget,
+		ExecutionID:      input.ExecutionID,
+		Step:             input.StepIndex,
+		Phase:            input.Phase,
+		Metadata:         input.Metadata,
+	}
+
+	var out pluginCheckResult
+	if err := g.call(ctx, "check", params, &out); err != nil {
+		return CheckResult{GuardrailID: g.ID(), Message: "plugin error: " + err.Error(), Err: err}
+	}
+	if out.Message == "" {
+		out.Message = "no message from plugin"
+	}
+	if !out.Passed && out.Action == "" {
+		out.Action = "block"
+	}
+	return CheckResult{Passed: out.Passed, GuardrailID: g.ID(), Message: out.Message, Action: out.Action}
+}
+
+// Health asks the plugin whether it is ready.
+func (g *PluginGuardrail) Health(ctx context.Context) error {
+	var out struct {
+		Status string `json:"status"`
+	}
+	if err := g.call(ctx, "health", struct{}{}, &out); err != nil {
+		return err
+	}
+	if out.Status != "ok" {
+		return fmt.Errorf("plugin reported status %q", out.Status)
+	}
+	return nil
+}
+
+func (g *PluginGuardrail) Close() error {
+	g.stopOnce.Do(func() { close(g.stopCh) })
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.proc != nil {
+		g.proc.kill()
+		g.proc = nil
+	}
+	return nil
+}
+
+func (g *PluginGuardrail) call(ctx context.Context, method string, params, out interface{}) error {
+	proc, err := g.process()
+	if err != nil {
+		return err
+	}
+	if g.cfg.Transport == PluginHTTP {
+		err = g.callHTTP(ctx, method, params, out)
+	} else {
+		err = proc.call(ctx, method, params, out)
+	}
+	g.mu.Lock()
+	if err == nil {
+		g.failures = 0
+	}
+	g.mu.Unlock()
+	return err
+}
+
+// process returns the supervised process, starting or restarting it when
+// needed. For HTTP plugins without a command it returns nil.
+func (g *PluginGuardrail) process() (*pluginProcess, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	select {
+	case <-g.stopCh:
+		return nil, fmt.Errorf("plugin %s is closed", g.id)
+	default:
+	}
+
+	if g.cfg.Command == "" {
+		return nil, nil
+	}
+	if g.proc != nil && g.proc.alive() {
+		return g.proc, nil
+	}
+	if now := time.Now(); now.Before(g.nextStart) {
+		return nil, fmt.Errorf("plugin %s is restarting, next attempt in %s", g.id, g.nextStart.Sub(now).Round(time.Millisecond))
+	}
+
+	proc, err := startPluginProcess(g.cfg)
+	if err != nil {
+		g.backoff()
+		return nil, err
+	}
+	g.proc = proc
+	g.backoff() // counts as a failure until a call succeeds
+	return proc, nil
+}
+
+// backoff must be called with g.mu held.
+func (g *PluginGuardrail) backoff() {
+	delay := 500 * time.Millisecond << g.failures
+	if delay > pluginMaxBackoff || delay <= 0 {
+		delay = pluginMaxBackoff
+	}
+	if g.failures > 0 {
+		g.nextStart = time.Now().Add(delay)
+	}
+	g.failures++
+}
+
+func (g *PluginGuardrail) healthLoop() {
+	ticker := time.NewTicker(g.cfg.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), g.cfg.HealthInterval)
+			err := g.Health(ctx)
+			cancel()
+
+			g.mu.Lock()
+			g.healthy = err == nil
+			if err != nil && g.proc != nil {
+				// Kill so the next call starts a fresh process.
+				g.proc.kill()
+				g.proc = nil
+			}
+			g.mu.Unlock()
+		case <-g.stopCh:
+			return
+		}
+	}
+}
+
+// Healthy reports the result of the last background health check.
+func (g *PluginGuardrail) Healthy() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.healthy
+}
+
+func (g *PluginGuardrail) callHTTP(ctx context.Context, method string, params, out interface{}) error {
+	httpMethod, path := http.MethodPost, "/check"
+	var body io.Reader
+	if method == "health" {
+		httpMethod, path = http.MethodGet, "/health"
+	} else {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, httpMethod, g.cfg.URL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("plugin returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func requireLoopback(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("plugin: invalid url %q", raw)
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("plugin: url %q must point to localhost", raw)
+}
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type pluginProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[int64]chan rpcResponse
+	nextID  int64
+	done    chan struct{}
+	err     error
+}
+
+func startPluginProcess(cfg PluginConfig) (*pluginProcess, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	cmd.Stderr = os.Stderr
+
+	p := &pluginProcess{cmd: cmd, pending: make(map[int64]chan rpcResponse), done: make(chan struct{})}
+	var stdout io.ReadCloser
+	if cfg.Transport != PluginHTTP {
+		var err error
+		if p.stdin, err = cmd.StdinPipe(); err != nil {
+			return nil, err
+		}
+		if stdout, err = cmd.StdoutPipe(); err != nil {
+			return nil, err
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start plugin %s: %w", cfg.Command, err)
+	}
+
+	if stdout != nil {
+		go p.readLoop(stdout)
+	} else {
+		go func() {
+			p.exit(cmd.Wait())
+		}()
+	}
+	return p, nil
+}
+
+func (p *pluginProcess) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var resp rpcResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			continue // tolerate stray output
+		}
+		p.mu.Lock()
+		ch, ok := p.pending[resp.ID]
+		delete(p.pending, resp.ID)
+		p.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+	err := scanner.Err()
+	if waitErr := p.cmd.Wait(); err == nil {
+		err = waitErr
+	}
+	p.exit(err)
+}
+
+func (p *pluginProcess) exit(err error) {
+	if err == nil {
+		err = errors.New("plugin exited")
+	}
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+	close(p.done)
+}
+
+func (p *pluginProcess) alive() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *pluginProcess) kill() {
+	if p.stdin != nil {
+		p.stdin.Close()
+	}
+	if p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+}
+
+func (p *pluginProcess) call(ctx context.Context, method string, params, out interface{}) error {
+	p.mu.Lock()
+	p.nextID++
+	id := p.nextID
+	ch := make(chan rpcResponse, 1)
+	p.pending[id] = ch
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	// A plugin that stops reading its input blocks the write, so it runs
+	// in its own goroutine and gives way to ctx.
+	written := make(chan error, 1)
+	go func() {
+		p.writeMu.Lock()
+		defer p.writeMu.Unlock()
+		_, err := p.stdin.Write(append(data, '\n'))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			return fmt.Errorf("write to plugin: %w", err)
+		}
+	case <-p.done:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return fmt.Errorf("plugin exited: %v", p.err)
+	case <-ctx.Done():
+		// The request may be half written, which leaves the stream
+		// unusable; kill the process so the next call starts a new one.
+		p.kill()
+		return fmt.Errorf("write to plugin: %w", ctx.Err())
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("plugin error %d: %s", resp.Error.Code, resp.Error.Message)
+		}
+		return json.Unmarshal(resp.Result, out)
+	case <-p.done:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return fmt.Errorf("plugin exited: %v", p.err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
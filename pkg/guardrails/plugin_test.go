@@ -0,0 +1,145 @@
+package guardrails
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPluginHelperProcess is not a test: run with PIPE_TEST_PLUGIN set, the
+// test binary acts as a stdio plugin. "stall" never reads its input.
+func TestPluginHelperProcess(t *testing.T) {
+	mode := os.Getenv("PIPE_TEST_PLUGIN")
+	if mode == "" {
+		return
+	}
+	if mode == "stall" {
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	enc := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req struct {
+			ID     int64             `json:"id"`
+			Method string            `json:"method"`
+			Params pluginCheckParams `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			os.Exit(2)
+		}
+		var result interface{}
+		switch req.Method {
+		case "health":
+			result = map[string]string{"status": "ok"}
+		case "check":
+			result = fakePluginCheck(req.Params)
+		}
+		os.Stdout.WriteString("stray output is ignored\n")
+		enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}
+	os.Exit(0)
+}
+
+func fakePluginCheck(p pluginCheckParams) pluginCheckResult {
+	if strings.Contains(p.Prompt, "forbidden") {
+		return pluginCheckResult{Passed: false, Message: "forbidden word in " + string(p.Phase)}
+	}
+	return pluginCheckResult{Passed: true, Message: "fine"}
+}
+
+func newHelperPlugin(t *testing.T, mode string) *PluginGuardrail {
+	t.Helper()
+	g, err := NewPluginGuardrail("helper", PhasePre, PluginConfig{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestPluginHelperProcess$"},
+		Env:     []string{"PIPE_TEST_PLUGIN=" + mode},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func testPluginProtocol(t *testing.T, g *PluginGuardrail) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := g.Health(ctx); err != nil {
+		t.Fatalf("health: %v", err)
+	}
+	if r := g.Check(ctx, CheckInput{Prompt: "hello", Phase: PhasePre}); !r.Passed || r.Message != "fine" || r.Err != nil {
+		t.Fatalf("allowed prompt: %+v", r)
+	}
+	r := g.Check(ctx, CheckInput{Prompt: "a forbidden word", Phase: PhasePre})
+	if r.Passed || r.Action != "block" || r.Message != "forbidden word in pre" {
+		t.Fatalf("forbidden prompt: %+v, want a block defaulted from the missing action", r)
+	}
+}
+
+func TestPluginStdio(t *testing.T) {
+	testPluginProtocol(t, newHelperPlugin(t, "serve"))
+}
+
+func TestPluginHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/health":
+			json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		case r.Method == http.MethodPost && r.URL.Path == "/check":
+			var p pluginCheckParams
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(fakePluginCheck(p))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	g, err := NewPluginGuardrail("helper", PhasePre, PluginConfig{Transport: PluginHTTP, URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	testPluginProtocol(t, g)
+}
+
+func TestPluginRejectsRemoteURL(t *testing.T) {
+	if _, err := NewPluginGuardrail("remote", PhasePre, PluginConfig{Transport: PluginHTTP, URL: "http://example.com"}); err == nil {
+		t.Fatal("non-loopback plugin URL accepted")
+	}
+}
+
+func TestPluginWriteHonorsContext(t *testing.T) {
+	g := newHelperPlugin(t, "stall")
+
+	// Larger than a pipe buffer, so the write blocks on a plugin that
+	// does not read.
+	input := CheckInput{Prompt: strings.Repeat("x", 1<<20), Phase: PhasePre}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	done := make(chan CheckResult, 1)
+	go func() { done <- g.Check(ctx, input) }()
+	select {
+	case r := <-done:
+		if r.Err == nil {
+			t.Fatalf("check against a stalled plugin succeeded: %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("check blocked on a plugin that does not read its input")
+	}
+}
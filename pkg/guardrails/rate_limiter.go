@@ -1,54 +1,186 @@
 package guardrails
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
 
+const (
+	RateKeyNamespace = "namespace"
+	RateKeyAgent     = "agent"
+	RateKeyProvider  = "provider"
+	RateKeyTool      = "tool"
+)
+
+// RateLimitStore shares limiter state between servers. UpdateRateLimit must
+// apply update atomically to the theoretical arrival time stored under key;
+// a zero time is passed when the key has no state yet.
+type RateLimitStore interface {
+	UpdateRateLimit(key string, update func(tat time.Time) (time.Time, bool)) (bool, error)
+}
+
+// RateLimiterGuardrail is a GCRA limiter: each key holds only its theoretical
+// arrival time, which is equivalent to a token bucket refilled at rate/per
+// with capacity burst.
 type RateLimiterGuardrail struct {
-	maxPerMinute int
-	mu           sync.Mutex
-	windows      map[string][]time.Time
+	name     string
+	interval time.Duration // emission interval between requests
+	burst    int
+	keys     []string
+	phase    Phase
+	store    RateLimitStore
+
+	mu      sync.Mutex
+	tats    map[string]time.Time
+	sweepAt int
+	now     func() time.Time
 }
 
 func NewRateLimiter(maxPerMinute int) *RateLimiterGuardrail {
+	return NewTokenBucketLimiter("rate-limiter", maxPerMinute, time.Minute, maxPerMinute, []string{RateKeyAgent}, nil)
+}
+
+func NewTokenBucketLimiter(name string, rate int, per time.Duration, burst int, keys []string, store RateLimitStore) *RateLimiterGuardrail {
+	if rate < 1 {
+		rate = 1
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	if len(keys) == 0 {
+		keys = []string{RateKeyAgent}
+	}
+	// The tool name is only known once the model has picked a tool, so a
+	// limiter keyed by tool counts tool calls instead of model calls.
+	phase := PhasePre
+	for _, k := range keys {
+		if k == RateKeyTool {
+			phase = PhaseTool
+		}
+	}
 	return &RateLimiterGuardrail{
-		maxPerMinute: maxPerMinute,
-		windows:      make(map[string][]time.Time),
+		name:     name,
+		interval: per / time.Duration(rate),
+		burst:    burst,
+		keys:     keys,
+		phase:    phase,
+		store:    store,
+		tats:     make(map[string]time.Time),
+		sweepAt:  1024,
+		now:      time.Now,
 	}
 }
 
 func (g *RateLimiterGuardrail) ID() string    { return "rate-limiter" }
-func (g *RateLimiterGuardrail) Phase() Phase  { return PhasePre }
+func (g *RateLimiterGuardrail) Phase() Phase  { return g.phase }
 func (g *RateLimiterGuardrail) Priority() int { return 95 }
 
-func (g *RateLimiterGuardrail) Check(input CheckInput) CheckResult {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	now := time.Now()
-	windowStart := now.Add(-1 * time.Minute)
-	key := input.AgentName
+func (g *RateLimiterGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	key := g.key(input)
+	now := g.now()
 
-	//Pruning the old entries
+	var retryAfter time.Duration
+	update := func(tat time.Time) (time.Time, bool) {
+		if tat.Before(now) {
+			tat = now
+		}
+		tolerance := g.interval * time.Duration(g.burst-1)
+		if wait := tat.Sub(now) - tolerance; wait > 0 {
+			retryAfter = wait
+			return tat, false
+		}
+		return tat.Add(g.interval), true
+	}
 
-	var valid []time.Time
-	for _, t := range g.windows[key] {
-		if t.After(windowStart) {
-			valid = append(valid, t)
+	var allowed bool
+	if g.store != nil {
+		var err error
+		allowed, err = g.store.UpdateRateLimit("ratelimit/"+g.name+"/"+key, update)
+		if err != nil {
+			return CheckResult{
+				Passed:      false,
+				GuardrailID: g.ID(),
+				Message:     fmt.Sprintf("rate limiter state unavailable: %v", err),
+				Action:      "warn",
+			}
 		}
+	} else {
+		g.mu.Lock()
+		var tat time.Time
+		tat, allowed = update(g.tats[key])
+		g.tats[key] = tat
+		g.sweep(now)
+		g.mu.Unlock()
 	}
-	g.windows[key] = valid
 
-	if len(valid) >= g.maxPerMinute {
+	if !allowed {
 		return CheckResult{
 			Passed:      false,
 			GuardrailID: g.ID(),
-			Message:     fmt.Sprintf("rate limit exceeded: %d requests in last minute (max %d)", len(valid), g.maxPerMinute),
+			Message:     fmt.Sprintf("rate limit exceeded for %s: retry in %s (burst %d)", key, retryAfter.Round(time.Millisecond), g.burst),
 			Action:      "block",
 		}
 	}
-	g.windows[key] = append(g.windows[key], now)
 	return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "within rate limit"}
 }
+
+// Refund gives back the token a passing Check took for a call that another
+// guardrail then stopped.
+func (g *RateLimiterGuardrail) Refund(input CheckInput) error {
+	key := g.key(input)
+	refund := func(tat time.Time) (time.Time, bool) {
+		if tat.IsZero() {
+			return tat, false
+		}
+		return tat.Add(-g.interval), true
+	}
+	if g.store != nil {
+		_, err := g.store.UpdateRateLimit("ratelimit/"+g.name+"/"+key, refund)
+		return err
+	}
+	g.mu.Lock()
+	if tat, ok := refund(g.tats[key]); ok {
+		g.tats[key] = tat
+	}
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *RateLimiterGuardrail) key(input CheckInput) string {
+	parts := make([]string, 0, len(g.keys))
+	for _, k := range g.keys {
+		var v string
+		switch k {
+		case RateKeyNamespace:
+			v = input.Namespace
+		case RateKeyAgent:
+			v = input.AgentName
+		case RateKeyProvider:
+			v = input.ModelProvider
+		case RateKeyTool:
+			v = input.ToolName
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// sweep drops keys whose bucket is full again, so idle keys cost nothing.
+// Must be called with g.mu held.
+func (g *RateLimiterGuardrail) sweep(now time.Time) {
+	if len(g.tats) < g.sweepAt {
+		return
+	}
+	for k, tat := range g.tats {
+		if !tat.After(now) {
+			delete(g.tats, k)
+		}
+	}
+	g.sweepAt = 2 * len(g.tats)
+	if g.sweepAt < 1024 {
+		g.sweepAt = 1024
+	}
+}
@@ -0,0 +1,172 @@
+package guardrails
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+// ResourceStore is the part of the store the engine follows to keep its
+// guardrails in line with the resources that declare them.
+type ResourceStore interface {
+	List(kind models.ResourceKind, namespace string) ([]*models.GenericResource, error)
+	Watch(kind models.ResourceKind) <-chan store.ResourceEvent
+}
+
+var followedKinds = []models.ResourceKind{models.KindGuardrail, models.KindAgent, models.KindTool}
+
+// Run applies every Guardrail, Agent and Tool resource in s, then follows
+// changes to them until stop is closed.
+func (e *Engine) Run(s ResourceStore, stop <-chan struct{}) {
+	guardrailEvents := s.Watch(models.KindGuardrail)
+	agentEvents := s.Watch(models.KindAgent)
+	toolEvents := s.Watch(models.KindTool)
+
+	for _, kind := range followedKinds {
+		resources, err := s.List(kind, "")
+		if err != nil {
+			e.logger.Error("failed to list resources", "kind", kind, "error", err)
+			continue
+		}
+		for _, res := range resources {
+			if err := e.Apply(res); err != nil {
+				e.logger.Warn("invalid guardrail resource", "resource", res.Key(), "error", err)
+			}
+		}
+	}
+
+	for {
+		var ev store.ResourceEvent
+		select {
+		case ev = <-guardrailEvents:
+		case ev = <-agentEvents:
+		case ev = <-toolEvents:
+		case <-stop:
+			return
+		}
+		if ev.Resource == nil {
+			continue
+		}
+		if ev.Type == store.EventDeleted {
+			e.RemoveResource(ev.Resource)
+			continue
+		}
+		if err := e.Apply(ev.Resource); err != nil {
+			e.logger.Warn("invalid guardrail resource", "resource", ev.Resource.Key(), "error", err)
+		}
+	}
+}
+
+// RemoveResource drops the guardrails built from res.
+func (e *Engine) RemoveResource(res *models.GenericResource) {
+	switch res.Kind {
+	case models.KindGuardrail:
+		e.Remove(res.Metadata.Name)
+	case models.KindAgent:
+		e.Remove(outputSchemaID(res))
+		e.Remove(toolAllowlistID(res))
+	case models.KindTool:
+		e.Remove(outputSchemaID(res))
+		e.Remove(inputSchemaID(res))
+	}
+}
+
+// applyDeclared registers the guardrails an Agent or Tool resource declares
+// for itself, each scoped to that agent or tool: an agent's output schema
+// and the tools it may call, a tool's input and output schemas.
+func (e *Engine) applyDeclared(res *models.GenericResource) error {
+	declared := make(map[string]Guardrail) // id -> guardrail, nil when not declared
+	scope := scopedGuardrail{namespace: res.Metadata.Namespace}
+
+	switch res.Kind {
+	case models.KindAgent:
+		var spec models.AgentSpec
+		if err := decodeConfig(res.Spec, &spec); err != nil {
+			return fmt.Errorf("decode agent spec: %w", err)
+		}
+		scope.agent = res.Metadata.Name
+
+		declared[outputSchemaID(res)] = nil
+		if _, ok := spec.Config["outputSchema"]; ok {
+			g, err := NewSchemaValidationFromAgent(spec, spec.Config["repairOutput"] == "true")
+			if err != nil {
+				return err
+			}
+			declared[outputSchemaID(res)] = g
+		}
+		declared[toolAllowlistID(res)] = NewToolAllowlistFromAgents(map[string]models.AgentSpec{res.Metadata.Name: spec})
+	case models.KindTool:
+		var spec models.ToolSpec
+		if err := decodeConfig(res.Spec, &spec); err != nil {
+			return fmt.Errorf("decode tool spec: %w", err)
+		}
+		scope.tool = res.Metadata.Name
+
+		declared[outputSchemaID(res)] = nil
+		if spec.Schema.Output != nil {
+			g, err := NewSchemaValidationFromTool(spec, spec.Config["repairOutput"] == "true")
+			if err != nil {
+				return err
+			}
+			declared[outputSchemaID(res)] = g
+		}
+		declared[inputSchemaID(res)] = nil
+		if spec.Schema.Input != nil {
+			g, err := NewToolArgsValidation(map[string]models.ToolSpec{res.Metadata.Name: spec})
+			if err != nil {
+				return err
+			}
+			declared[inputSchemaID(res)] = g
+		}
+	}
+
+	for id, g := range declared {
+		if g == nil {
+			e.Remove(id)
+			continue
+		}
+		scoped := scope
+		scoped.id, scoped.Guardrail = id, g
+		e.Register(&scoped)
+	}
+	return nil
+}
+
+func outputSchemaID(res *models.GenericResource) string {
+	return res.Key() + "/output-schema"
+}
+
+func inputSchemaID(res *models.GenericResource) string {
+	return res.Key() + "/input-schema"
+}
+
+func toolAllowlistID(res *models.GenericResource) string {
+	return res.Key() + "/tool-allowlist"
+}
+
+// scopedGuardrail limits a guardrail built from an Agent or Tool resource to
+// the checks of that agent or tool.
+type scopedGuardrail struct {
+	Guardrail
+	id        string
+	namespace string
+	agent     string
+	tool      string
+}
+
+func (g *scopedGuardrail) ID() string { return g.id }
+
+func (g *scopedGuardrail) Applies(input CheckInput) bool {
+	if input.Namespace != g.namespace {
+		return false
+	}
+	return (g.agent == "" || input.AgentName == g.agent) && (g.tool == "" || input.ToolName == g.tool)
+}
+
+func (g *scopedGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	result := g.Guardrail.Check(ctx, input)
+	result.GuardrailID = g.id
+	return result
+}
@@ -0,0 +1,142 @@
+package guardrails
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+)
+
+func newTestEngine() *Engine {
+	return NewEngine(observability.NewMetricsRegistry(), observability.NewLogger("test"))
+}
+
+func findResult(results []CheckResult, id string) (CheckResult, bool) {
+	for _, r := range results {
+		if r.GuardrailID == id {
+			return r, true
+		}
+	}
+	return CheckResult{}, false
+}
+
+func TestAgentOutputSchemaIsScopedToAgent(t *testing.T) {
+	e := newTestEngine()
+	agent := &models.GenericResource{
+		Kind:     models.KindAgent,
+		Metadata: models.Metadata{Name: "summarizer", Namespace: "default"},
+		Spec: map[string]interface{}{
+			"runtime": "python",
+			"config":  map[string]interface{}{"outputSchema": `{"type":"object","required":["summary"]}`},
+		},
+	}
+	if err := e.Apply(agent); err != nil {
+		t.Fatal(err)
+	}
+	id := outputSchemaID(agent)
+
+	results, _ := e.RunPost(context.Background(), CheckInput{AgentName: "summarizer", Namespace: "default", Output: `{"title":"x"}`})
+	if r, ok := findResult(results, id); !ok || r.Passed {
+		t.Fatalf("output schema result = %+v (found %v), want a failure", r, ok)
+	}
+
+	results, _ = e.RunPost(context.Background(), CheckInput{AgentName: "other", Namespace: "default", Output: `{"title":"x"}`})
+	if _, ok := findResult(results, id); ok {
+		t.Fatal("output schema of summarizer ran for another agent")
+	}
+
+	e.RemoveResource(agent)
+	results, _ = e.RunPost(context.Background(), CheckInput{AgentName: "summarizer", Namespace: "default", Output: `{"title":"x"}`})
+	if _, ok := findResult(results, id); ok {
+		t.Fatal("output schema still runs after the agent was removed")
+	}
+}
+
+func TestToolSchemaWithRefIsRejected(t *testing.T) {
+	e := newTestEngine()
+	tool := &models.GenericResource{
+		Kind:     models.KindTool,
+		Metadata: models.Metadata{Name: "search", Namespace: "default"},
+		Spec: map[string]interface{}{
+			"type":   "http",
+			"schema": map[string]interface{}{"output": map[string]interface{}{"$ref": "#/defs/result"}},
+		},
+	}
+	if err := e.Apply(tool); err == nil {
+		t.Fatal("Apply accepted a tool output schema using $ref")
+	}
+}
+
+func TestToolInputSchemaValidatesArgs(t *testing.T) {
+	e := newTestEngine()
+	tool := &models.GenericResource{
+		Kind:     models.KindTool,
+		Metadata: models.Metadata{Name: "search", Namespace: "default"},
+		Spec: map[string]interface{}{
+			"type": "http",
+			"schema": map[string]interface{}{"input": map[string]interface{}{
+				"type":       "object",
+				"required":   []interface{}{"query"},
+				"properties": map[string]interface{}{"query": map[string]interface{}{"type": "string"}},
+			}},
+		},
+	}
+	if err := e.Apply(tool); err != nil {
+		t.Fatal(err)
+	}
+	id := inputSchemaID(tool)
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]interface{}
+		want bool // passed; ignored when the guardrail should not run
+		runs bool
+	}{
+		{"valid", "search", map[string]interface{}{"query": "pipes"}, true, true},
+		{"missing required", "search", map[string]interface{}{}, false, true},
+		{"wrong type", "search", map[string]interface{}{"query": 3}, false, true},
+		{"other tool", "fetch", map[string]interface{}{}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, _ := e.RunTool(context.Background(), CheckInput{AgentName: "a", Namespace: "default", ToolName: tt.tool, ToolArgs: tt.args})
+			r, ok := findResult(results, id)
+			if ok != tt.runs {
+				t.Fatalf("input schema ran = %v, want %v", ok, tt.runs)
+			}
+			if ok && r.Passed != tt.want {
+				t.Fatalf("passed = %v, want %v: %s", r.Passed, tt.want, r.Message)
+			}
+		})
+	}
+
+	e.RemoveResource(tool)
+	results, _ := e.RunTool(context.Background(), CheckInput{AgentName: "a", Namespace: "default", ToolName: "search"})
+	if _, ok := findResult(results, id); ok {
+		t.Fatal("input schema still runs after the tool was removed")
+	}
+}
+
+func TestAgentToolsAreAllowlisted(t *testing.T) {
+	e := newTestEngine()
+	agent := &models.GenericResource{
+		Kind:     models.KindAgent,
+		Metadata: models.Metadata{Name: "researcher", Namespace: "default"},
+		Spec:     map[string]interface{}{"runtime": "python", "tools": []interface{}{"search"}},
+	}
+	if err := e.Apply(agent); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.RunTool(context.Background(), CheckInput{AgentName: "researcher", Namespace: "default", ToolName: "search"}); err != nil {
+		t.Fatalf("declared tool: %v", err)
+	}
+	if _, err := e.RunTool(context.Background(), CheckInput{AgentName: "researcher", Namespace: "default", ToolName: "shell"}); err == nil {
+		t.Fatal("undeclared tool was allowed")
+	}
+	if _, err := e.RunTool(context.Background(), CheckInput{AgentName: "other", Namespace: "default", ToolName: "shell"}); err != nil {
+		t.Fatalf("allowlist of researcher applied to another agent: %v", err)
+	}
+}
@@ -1,11 +1,56 @@
 package guardrails
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/schema"
 )
 
+// SchemaValidationGuardrail validates model output against a JSON Schema.
+// Without Schema it falls back to input.Metadata["outputSchema"], and
+// ExpectedFields is treated as a list of required top-level keys.
+// With Repair, JSON is extracted from fenced code blocks or surrounding
+// prose before validation.
 type SchemaValidationGuardrail struct {
 	ExpectedFields []string
+	Schema         map[string]interface{}
+	Repair         bool
+
+	once     sync.Once
+	compiled *schema.Schema // Schema and ExpectedFields, compiled on first use
+	err      error
+}
+
+func NewSchemaValidationFromTool(tool models.ToolSpec, repair bool) (*SchemaValidationGuardrail, error) {
+	g := &SchemaValidationGuardrail{Schema: tool.Schema.Output, Repair: repair}
+	if _, err := g.compile(); err != nil {
+		return nil, fmt.Errorf("tool output schema: %w", err)
+	}
+	return g, nil
+}
+
+// NewSchemaValidationFromAgent reads the JSON Schema stored as a string
+// under the agent's "outputSchema" config key.
+func NewSchemaValidationFromAgent(agent models.AgentSpec, repair bool) (*SchemaValidationGuardrail, error) {
+	raw, ok := agent.Config["outputSchema"]
+	if !ok {
+		return nil, fmt.Errorf("agent config has no outputSchema")
+	}
+	var s map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return nil, fmt.Errorf("parse outputSchema: %w", err)
+	}
+	g := &SchemaValidationGuardrail{Schema: s, Repair: repair}
+	if _, err := g.compile(); err != nil {
+		return nil, fmt.Errorf("outputSchema: %w", err)
+	}
+	return g, nil
 }
 
 func (g *SchemaValidationGuardrail) ID() string {
@@ -20,7 +65,7 @@ func (g *SchemaValidationGuardrail) Priority() int {
 	return 50
 }
 
-func (g *SchemaValidationGuardrail) Check(input CheckInput) CheckResult {
+func (g *SchemaValidationGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
 	if input.Output == "" {
 		return CheckResult{
 			Passed:      false,
@@ -30,28 +75,118 @@ func (g *SchemaValidationGuardrail) Check(input CheckInput) CheckResult {
 		}
 	}
 
-	if len(g.ExpectedFields) == 0 {
+	s, err := g.schemaFor(input)
+	if err != nil {
+		return CheckResult{
+			Passed:      false,
+			GuardrailID: g.ID(),
+			Message:     "invalid schema: " + err.Error(),
+			Action:      "warn",
+		}
+	}
+	if s == nil {
 		return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "no schema to validate"}
 	}
-	var parsed map[string]interface{}
-	if err := json.Unmarshal([]byte(input.Output), &parsed); err != nil {
+
+	output := input.Output
+	if g.Repair {
+		output = extractJSON(output)
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
 		return CheckResult{
 			Passed:      false,
 			GuardrailID: g.ID(),
-			Message:     "output is not valid JSON",
+			Message:     "output is not valid JSON: " + err.Error(),
 			Action:      "warn",
 		}
 	}
 
-	for _, field := range g.ExpectedFields {
-		if _, ok := parsed[field]; !ok {
-			return CheckResult{
-				Passed:      false,
-				GuardrailID: g.ID(),
-				Message:     "missing required field: " + field,
-				Action:      "warn",
-			}
+	if err := ctx.Err(); err != nil {
+		return CheckResult{GuardrailID: g.ID(), Err: err}
+	}
+	if errs := s.Validate(parsed); len(errs) > 0 {
+		return CheckResult{
+			Passed:      false,
+			GuardrailID: g.ID(),
+			Message:     "output does not match schema: " + summarizeErrors(errs, 5),
+			Action:      "warn",
 		}
 	}
 	return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "schema valid"}
 }
+
+// schemaFor returns the compiled static schema or, without one, compiles
+// the schema the caller passed in input.Metadata.
+func (g *SchemaValidationGuardrail) schemaFor(input CheckInput) (*schema.Schema, error) {
+	if g.Schema != nil || len(g.ExpectedFields) > 0 {
+		return g.compile()
+	}
+	s, _ := input.Metadata["outputSchema"].(map[string]interface{})
+	if s == nil {
+		return nil, nil
+	}
+	return schema.Compile(s)
+}
+
+func (g *SchemaValidationGuardrail) compile() (*schema.Schema, error) {
+	g.once.Do(func() {
+		if s := g.combined(); s != nil {
+			g.compiled, g.err = schema.Compile(s)
+		}
+	})
+	return g.compiled, g.err
+}
+
+// combined adds ExpectedFields to Schema as required top-level keys.
+func (g *SchemaValidationGuardrail) combined() map[string]interface{} {
+	s := g.Schema
+	if len(g.ExpectedFields) == 0 {
+		return s
+	}
+
+	required := make([]interface{}, 0, len(g.ExpectedFields))
+	for _, f := range g.ExpectedFields {
+		required = append(required, f)
+	}
+	fields := map[string]interface{}{"type": "object", "required": required}
+	if s == nil {
+		return fields
+	}
+	return map[string]interface{}{"allOf": []interface{}{s, fields}}
+}
+
+func summarizeErrors(errs []schema.ValidationError, max int) string {
+	parts := make([]string, 0, max)
+	for i, e := range errs {
+		if i == max {
+			parts = append(parts, fmt.Sprintf("and %d more", len(errs)-max))
+			break
+		}
+		parts = append(parts, e.Field+": "+e.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+var fencedBlock = regexp.MustCompile("(?s)```(?:json|JSON)?\\s*\\n?(.*?)```")
+
+// extractJSON pulls a JSON document out of a fenced code block or, failing
+// that, takes the outermost object or array in the text.
+func extractJSON(s string) string {
+	if m := fencedBlock.FindStringSubmatch(s); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	start := strings.IndexAny(s, "{[")
+	if start < 0 {
+		return s
+	}
+	closer := byte('}')
+	if s[start] == '[' {
+		closer = ']'
+	}
+	end := strings.LastIndexByte(s, closer)
+	if end < start {
+		return s
+	}
+	return s[start : end+1]
+}
@@ -0,0 +1,134 @@
+package guardrails
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+)
+
+const (
+	maxShadowSamples = 20
+	// maxShadowInflight bounds the executions tracked per guardrail. Past
+	// it the oldest are counted as finished, as if they had been released.
+	maxShadowInflight = 10000
+)
+
+// shadowReport tracks shadow verdicts in memory for engines without a
+// store; with one, the report is computed from the persisted verdicts.
+type shadowReport struct {
+	mu    sync.Mutex
+	stats map[string]*shadowEntry
+}
+
+type shadowEntry struct {
+	models.ShadowStats
+	inflight map[string]bool // execution ID -> violated; folded into totals on release
+	order    []string        // inflight execution IDs, oldest first
+}
+
+func newShadowReport() *shadowReport {
+	return &shadowReport{stats: make(map[string]*shadowEntry)}
+}
+
+func (r *shadowReport) record(input CheckInput, result CheckResult, enforcedFailed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.stats[result.GuardrailID]
+	if !ok {
+		e = &shadowEntry{ShadowStats: models.ShadowStats{GuardrailID: result.GuardrailID}, inflight: make(map[string]bool)}
+		r.stats[result.GuardrailID] = e
+	}
+	e.Checks++
+	violated := e.inflight[input.ExecutionID]
+	if !result.Passed {
+		violated = true
+		e.Violations++
+		switch result.Action {
+		case "block":
+			e.WouldBlock++
+		case "escalate":
+			e.WouldEscalate++
+		}
+		if enforcedFailed {
+			e.OverlapWithEnforced++
+		}
+		e.Samples = append(e.Samples, models.ShadowSample{
+			ExecutionID: input.ExecutionID,
+			Step:        input.StepIndex,
+			Phase:       string(input.Phase),
+			Action:      result.Action,
+			Message:     result.Message,
+			Timestamp:   time.Now().UTC(),
+		})
+		if len(e.Samples) > maxShadowSamples {
+			e.Samples = e.Samples[len(e.Samples)-maxShadowSamples:]
+		}
+	}
+	if input.ExecutionID == "" {
+		return
+	}
+	if _, tracked := e.inflight[input.ExecutionID]; !tracked {
+		e.order = append(e.order, input.ExecutionID)
+		for len(e.inflight) >= maxShadowInflight {
+			e.finish(e.order[0])
+			e.order = e.order[1:]
+		}
+	}
+	e.inflight[input.ExecutionID] = violated
+}
+
+// finish folds an execution into the totals.
+func (e *shadowEntry) finish(executionID string) {
+	violated, ok := e.inflight[executionID]
+	if !ok {
+		return
+	}
+	e.Executions++
+	if violated {
+		e.ViolatingExecutions++
+	}
+	delete(e.inflight, executionID)
+}
+
+func (r *shadowReport) release(executionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.stats {
+		if _, ok := e.inflight[executionID]; !ok {
+			continue
+		}
+		e.finish(executionID)
+		for i, id := range e.order {
+			if id == executionID {
+				e.order = append(e.order[:i], e.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (r *shadowReport) snapshot() []models.ShadowStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]models.ShadowStats, 0, len(r.stats))
+	for _, e := range r.stats {
+		s := e.ShadowStats
+		s.Samples = append([]models.ShadowSample(nil), e.Samples...)
+		for _, violated := range e.inflight {
+			s.Executions++
+			if violated {
+				s.ViolatingExecutions++
+			}
+		}
+		if s.Checks > 0 {
+			s.ViolationRate = float64(s.Violations) / float64(s.Checks)
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GuardrailID < out[j].GuardrailID })
+	return out
+}
@@ -1,6 +1,9 @@
 package guardrails
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 type TokenLimitGuardrail struct {
 	MaxTokens int
@@ -18,14 +21,14 @@ func (g *TokenLimitGuardrail) Priority() int {
 	return 90
 }
 
-func (g *TokenLimitGuardrail) Check(input CheckInput) CheckResult {
+func (g *TokenLimitGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
 	if input.TokenCount > g.MaxTokens {
 		return CheckResult{
-			Passed : false,
+			Passed:      false,
 			GuardrailID: g.ID(),
-			Message: fmt.Sprintf("token count %d exceeds limit %d", input.TokenCount, g.MaxTokens),
-			Action: "block",
+			Message:     fmt.Sprintf("token count %d exceeds limit %d", input.TokenCount, g.MaxTokens),
+			Action:      "block",
 		}
 	}
 	return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "within token limit"}
-}
\ No newline at end of file
+}
@@ -0,0 +1,152 @@
+package guardrails
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/schema"
+)
+
+// ToolAllowlistGuardrail restricts which tools each agent may call. The "*"
+// entry applies to agents without their own list.
+type ToolAllowlistGuardrail struct {
+	Allowed map[string][]string // agent -> tool names
+}
+
+// NewToolAllowlistFromAgents allows each agent exactly the tools declared
+// in its spec.
+func NewToolAllowlistFromAgents(agents map[string]models.AgentSpec) *ToolAllowlistGuardrail {
+	allowed := make(map[string][]string, len(agents))
+	for name, spec := range agents {
+		allowed[name] = spec.Tools
+	}
+	return &ToolAllowlistGuardrail{Allowed: allowed}
+}
+
+func (g *ToolAllowlistGuardrail) ID() string    { return "tool-allowlist" }
+func (g *ToolAllowlistGuardrail) Phase() Phase  { return PhaseTool }
+func (g *ToolAllowlistGuardrail) Priority() int { return 100 }
+
+func (g *ToolAllowlistGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	tools, ok := g.Allowed[input.AgentName]
+	if !ok {
+		tools, ok = g.Allowed["*"]
+	}
+	if !ok {
+		return g.deny(fmt.Sprintf("agent %s has no tool allowlist", input.AgentName))
+	}
+	for _, t := range tools {
+		if t == input.ToolName || t == "*" {
+			return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "tool allowed"}
+		}
+	}
+	return g.deny(fmt.Sprintf("tool %s is not allowed for agent %s", input.ToolName, input.AgentName))
+}
+
+func (g *ToolAllowlistGuardrail) deny(msg string) CheckResult {
+	return CheckResult{Passed: false, GuardrailID: g.ID(), Message: msg, Action: "block"}
+}
+
+// DomainAllowlistGuardrail restricts the destinations HTTP tools may reach.
+// Entries match a host exactly or, as "*.example.com", any subdomain.
+type DomainAllowlistGuardrail struct {
+	Domains    []string
+	HTTPSOnly  bool
+	AllowOther bool // let non-URL targets such as commands through
+}
+
+func (g *DomainAllowlistGuardrail) ID() string    { return "domain-allowlist" }
+func (g *DomainAllowlistGuardrail) Phase() Phase  { return PhaseTool }
+func (g *DomainAllowlistGuardrail) Priority() int { return 95 }
+
+func (g *DomainAllowlistGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	u, err := url.Parse(input.ToolTarget)
+	if err != nil || u.Host == "" {
+		if g.AllowOther {
+			return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "target is not a URL"}
+		}
+		return g.deny(fmt.Sprintf("tool %s target %q is not an allowed URL", input.ToolName, input.ToolTarget))
+	}
+	if u.Scheme != "https" && (g.HTTPSOnly || u.Scheme != "http") {
+		return g.deny(fmt.Sprintf("tool %s uses disallowed scheme %q", input.ToolName, u.Scheme))
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, d := range g.Domains {
+		d = strings.ToLower(d)
+		if host == d || (strings.HasPrefix(d, "*.") && strings.HasSuffix(host, d[1:])) {
+			return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "destination allowed"}
+		}
+	}
+	return g.deny(fmt.Sprintf("tool %s destination %s is not in the domain allowlist", input.ToolName, host))
+}
+
+func (g *DomainAllowlistGuardrail) deny(msg string) CheckResult {
+	return CheckResult{Passed: false, GuardrailID: g.ID(), Message: msg, Action: "block"}
+}
+
+// ToolArgsValidationGuardrail validates tool arguments against the tool's
+// input JSON Schema. Tools without an entry fall back to the schema in
+// input.Metadata["toolInputSchema"].
+type ToolArgsValidationGuardrail struct {
+	Schemas map[string]*schema.Schema // tool name -> compiled input schema
+}
+
+// NewToolArgsValidation compiles the input schema declared by each tool.
+func NewToolArgsValidation(tools map[string]models.ToolSpec) (*ToolArgsValidationGuardrail, error) {
+	schemas := make(map[string]*schema.Schema, len(tools))
+	for name, spec := range tools {
+		if spec.Schema.Input == nil {
+			continue
+		}
+		s, err := schema.Compile(spec.Schema.Input)
+		if err != nil {
+			return nil, fmt.Errorf("tool %s: schema.input: %w", name, err)
+		}
+		schemas[name] = s
+	}
+	return &ToolArgsValidationGuardrail{Schemas: schemas}, nil
+}
+
+func (g *ToolArgsValidationGuardrail) ID() string    { return "tool-args-validation" }
+func (g *ToolArgsValidationGuardrail) Phase() Phase  { return PhaseTool }
+func (g *ToolArgsValidationGuardrail) Priority() int { return 90 }
+
+func (g *ToolArgsValidationGuardrail) Check(ctx context.Context, input CheckInput) CheckResult {
+	s, ok := g.Schemas[input.ToolName]
+	if !ok {
+		if raw, _ := input.Metadata["toolInputSchema"].(map[string]interface{}); raw != nil {
+			var err error
+			if s, err = schema.Compile(raw); err != nil {
+				return CheckResult{Passed: false, GuardrailID: g.ID(), Message: "invalid input schema: " + err.Error(), Action: "block"}
+			}
+		}
+	}
+	if s == nil {
+		return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "no input schema for tool " + input.ToolName}
+	}
+
+	// Round-trip so Go ints and structs compare like decoded JSON.
+	var args interface{} = map[string]interface{}{}
+	if input.ToolArgs != nil {
+		data, err := json.Marshal(input.ToolArgs)
+		if err != nil {
+			return CheckResult{Passed: false, GuardrailID: g.ID(), Message: "tool arguments are not JSON-encodable: " + err.Error(), Action: "block"}
+		}
+		json.Unmarshal(data, &args)
+	}
+
+	if errs := s.Validate(args); len(errs) > 0 {
+		return CheckResult{
+			Passed:      false,
+			GuardrailID: g.ID(),
+			Message:     fmt.Sprintf("invalid arguments for tool %s: %s", input.ToolName, summarizeErrors(errs, 5)),
+			Action:      "block",
+		}
+	}
+	return CheckResult{Passed: true, GuardrailID: g.ID(), Message: "tool arguments valid"}
+}
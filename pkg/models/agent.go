@@ -15,4 +15,6 @@ type ModelConfig struct {
 	Name        string  `yaml:"name" json:"name"`
 	Temperature float64 `yaml:"temperature" json:"temperature"`
 	MaxTokens   int     `yaml:"maxTokens" json:"maxTokens"`
+	// Pricing overrides the server price table for this agent's model.
+	Pricing *ModelPrice `yaml:"pricing,omitempty" json:"pricing,omitempty"`
 }
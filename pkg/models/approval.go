@@ -0,0 +1,38 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrApprovalDecided is returned when deciding an approval that another
+// reviewer or the timeout already decided.
+var ErrApprovalDecided = errors.New("approval already decided")
+
+type ApprovalState string
+
+const (
+	ApprovalPending  ApprovalState = "Pending"
+	ApprovalApproved ApprovalState = "Approved"
+	ApprovalRejected ApprovalState = "Rejected"
+)
+
+type ApprovalRequest struct {
+	ID              string        `json:"id"`
+	ExecutionID     string        `json:"executionId"`
+	GuardrailID     string        `json:"guardrailId"`
+	Step            int           `json:"step"`
+	Message         string        `json:"message"`
+	State           ApprovalState `json:"state"`
+	DefaultDecision ApprovalState `json:"defaultDecision"`
+	CreatedAt       time.Time     `json:"createdAt"`
+	ExpiresAt       time.Time     `json:"expiresAt"`
+	DecidedAt       *time.Time    `json:"decidedAt,omitempty"`
+	DecidedBy       string        `json:"decidedBy,omitempty"`
+	Reason          string        `json:"reason,omitempty"`
+}
+
+type EscalationPolicy struct {
+	Timeout         string `yaml:"timeout" json:"timeout"`
+	DefaultDecision string `yaml:"defaultDecision" json:"defaultDecision"`
+}
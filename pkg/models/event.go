@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+type EventType string
+
+const (
+	EventNormal  EventType = "Normal"
+	EventWarning EventType = "Warning"
+)
+
+// ObjectReference names the resource or execution an event is about. For
+// executions Kind is Execution and Name is the execution ID.
+type ObjectReference struct {
+	Kind      ResourceKind `json:"kind"`
+	Namespace string       `json:"namespace,omitempty"`
+	Name      string       `json:"name"`
+}
+
+func (o ObjectReference) String() string {
+	return string(o.Kind) + "/" + o.Name
+}
+
+func ReferenceTo(r *GenericResource) ObjectReference {
+	return ObjectReference{Kind: r.Kind, Namespace: r.Metadata.Namespace, Name: r.Metadata.Name}
+}
+
+func ExecutionReference(exec *ExecutionRecord) ObjectReference {
+	return ObjectReference{Kind: KindExecution, Namespace: exec.Namespace, Name: exec.ID}
+}
+
+// Event is a user-visible record of something that happened to an object.
+// Repeats of the same object, type, reason and message are folded into
+// one event by bumping Count and LastSeen.
+type Event struct {
+	ID             string          `json:"id"`
+	InvolvedObject ObjectReference `json:"involvedObject"`
+	Type           EventType       `json:"type"`
+	Reason         string          `json:"reason"`
+	Message        string          `json:"message"`
+	Source         string          `json:"source,omitempty"` // component that reported it
+	Count          int             `json:"count"`
+	FirstSeen      time.Time       `json:"firstSeen"`
+	LastSeen       time.Time       `json:"lastSeen"`
+}
+
+// EventQuery filters events; zero fields match everything. Results are
+// ordered by LastSeen, newest first.
+type EventQuery struct {
+	Kind      ResourceKind
+	Namespace string
+	Name      string
+	Type      EventType
+	Since     time.Time
+	Limit     int
+}
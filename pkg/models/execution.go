@@ -13,6 +13,10 @@ const (
 	ExecRetrying  ExecutionState = "Retrying"
 )
 
+func (s ExecutionState) IsTerminal() bool {
+	return s == ExecFailed || s == ExecCompleted
+}
+
 type ExecutionSpec struct {
 	AgentName    string            `yaml:"agentName" json:"agentName"`
 	PipelineName string            `yaml:"pipelineName,omitempty" json:"pipelineName,omitempty"`
@@ -22,27 +26,33 @@ type ExecutionSpec struct {
 }
 
 type ExecutionRecord struct {
-	ID           string                 `json:"id"`
-	AgentName    string                 `json:"agentName"`
-	PipelineName string                 `json:"pipelineName,omitempty"`
-	Namespace    string                 `json:"namespace"`
-	State        ExecutionState         `json:"state"`
-	Input        map[string]string      `json:"input"`
-	Output       map[string]interface{} `json:"output,omitempty"`
-	CurrentStep  int                    `json:"currentStep"`
-	TotalSteps   int                    `json:"totalSteps"`
-	Checkpoint   []byte                 `json:"checkpoint,omitempty"`
-	RetryCount   int                    `json:"retryCount"`
-	MaxRetries   int                    `json:"maxRetries"`
-	Priority     int                    `json:"priority"`
-	Error        string                 `json:"error,omitempty"`
-	Logs         []ExecutionLog         `json:"logs,omitempty"`
-	TokensUsed   int64                  `json:"tokensUsed"`
-	LatencyMs    int64                  `json:"latencyMs"`
-	CreatedAt    time.Time              `json:"createdAt"`
-	UpdatedAt    time.Time              `json:"updatedAt"`
-	StartedAt    *time.Time             `json:"startedAt,omitempty"`
-	CompletedAt  *time.Time             `json:"completedAt,omitempty"`
+	ID               string                 `json:"id"`
+	AgentName        string                 `json:"agentName"`
+	PipelineName     string                 `json:"pipelineName,omitempty"`
+	PipelineRunID    string                 `json:"pipelineRunId,omitempty"`
+	Namespace        string                 `json:"namespace"`
+	State            ExecutionState         `json:"state"`
+	Input            map[string]string      `json:"input"`
+	Output           map[string]interface{} `json:"output,omitempty"`
+	CurrentStep      int                    `json:"currentStep"`
+	TotalSteps       int                    `json:"totalSteps"`
+	Checkpoint       []byte                 `json:"checkpoint,omitempty"`
+	RetryCount       int                    `json:"retryCount"`
+	MaxRetries       int                    `json:"maxRetries"`
+	Priority         int                    `json:"priority"`
+	Error            string                 `json:"error,omitempty"`
+	Logs             []ExecutionLog         `json:"logs,omitempty"`
+	Verdicts         []GuardrailVerdict     `json:"verdicts,omitempty"`
+	ApprovalID       string                 `json:"approvalId,omitempty"`
+	TokensUsed       int64                  `json:"tokensUsed"`
+	PromptTokens     int64                  `json:"promptTokens"`
+	CompletionTokens int64                  `json:"completionTokens"`
+	Cost             float64                `json:"cost"`
+	LatencyMs        int64                  `json:"latencyMs"`
+	CreatedAt        time.Time              `json:"createdAt"`
+	UpdatedAt        time.Time              `json:"updatedAt"`
+	StartedAt        *time.Time             `json:"startedAt,omitempty"`
+	CompletedAt      *time.Time             `json:"completedAt,omitempty"`
 }
 
 type ExecutionLog struct {
@@ -1,10 +1,81 @@
 package models
 
+import "time"
+
 type GuardrailSpec struct {
-	Description string                 `yaml:"description" json:"description"`
-	Type        string                 `yaml:"type" json:"type"`
-	Phase       string                 `yaml:"phase" json:"phase"`
-	Config      map[string]interface{} `yaml:"config" json:"config"`
-	Action      string                 `yaml:"action" json:"action"`
-	Priority    int                    `yaml:"priority" json:"priority"`
-}
\ No newline at end of file
+	Description   string                 `yaml:"description" json:"description"`
+	Type          string                 `yaml:"type" json:"type"`
+	Phase         string                 `yaml:"phase" json:"phase"`
+	Config        map[string]interface{} `yaml:"config" json:"config"`
+	Action        string                 `yaml:"action" json:"action"`
+	Priority      int                    `yaml:"priority" json:"priority"`
+	Mode          string                 `yaml:"mode,omitempty" json:"mode,omitempty"` // enforce (default) or shadow
+	Timeout       string                 `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	FailurePolicy string                 `yaml:"failurePolicy,omitempty" json:"failurePolicy,omitempty"` // open or closed
+	Escalation    *EscalationPolicy      `yaml:"escalation,omitempty" json:"escalation,omitempty"`
+}
+
+type GuardrailVerdict struct {
+	ExecutionID string    `json:"executionId"`
+	GuardrailID string    `json:"guardrailId"`
+	AgentName   string    `json:"agentName,omitempty"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Phase       string    `json:"phase"`
+	Step        int       `json:"step"`
+	Passed      bool      `json:"passed"`
+	Action      string    `json:"action,omitempty"`
+	Message     string    `json:"message"`
+	Shadow      bool      `json:"shadow,omitempty"`
+	LatencyMs   float64   `json:"latencyMs"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// ViolationQuery selects failed guardrail verdicts for aggregation. Window
+// splits [Since, Until) into buckets; zero means a single bucket. GroupBy
+// takes any of guardrail, agent, namespace, action and phase.
+type ViolationQuery struct {
+	Since     time.Time
+	Until     time.Time
+	Window    time.Duration
+	GroupBy   []string
+	Namespace string
+	Agent     string
+	Guardrail string
+	Shadow    bool // include shadow verdicts
+	Limit     int
+}
+
+type ViolationStat struct {
+	BucketStart time.Time `json:"bucketStart"`
+	GuardrailID string    `json:"guardrailId,omitempty"`
+	AgentName   string    `json:"agentName,omitempty"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Action      string    `json:"action,omitempty"`
+	Phase       string    `json:"phase,omitempty"`
+	Count       int64     `json:"count"`
+	Executions  int64     `json:"executions"`
+}
+
+// ShadowStats summarizes what a shadow guardrail would have done had it
+// been enforced.
+type ShadowStats struct {
+	GuardrailID         string         `json:"guardrailId"`
+	Checks              int64          `json:"checks"`
+	Violations          int64          `json:"violations"`
+	WouldBlock          int64          `json:"wouldBlock"`
+	WouldEscalate       int64          `json:"wouldEscalate"`
+	Executions          int64          `json:"executions"`
+	ViolatingExecutions int64          `json:"violatingExecutions"`
+	OverlapWithEnforced int64          `json:"overlapWithEnforced"` // violations where an enforced guardrail also failed
+	ViolationRate       float64        `json:"violationRate"`
+	Samples             []ShadowSample `json:"samples,omitempty"`
+}
+
+type ShadowSample struct {
+	ExecutionID string    `json:"executionId"`
+	Step        int       `json:"step"`
+	Phase       string    `json:"phase"`
+	Action      string    `json:"action"`
+	Message     string    `json:"message"`
+	Timestamp   time.Time `json:"timestamp"`
+}
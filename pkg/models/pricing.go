@@ -0,0 +1,36 @@
+package models
+
+type ModelPrice struct {
+	PromptPer1K     float64 `yaml:"promptPer1k" json:"promptPer1k"`
+	CompletionPer1K float64 `yaml:"completionPer1k" json:"completionPer1k"`
+}
+
+// PriceTable is keyed by "provider/model" or by the bare model name.
+type PriceTable map[string]ModelPrice
+
+func (t PriceTable) Lookup(provider, model string) (ModelPrice, bool) {
+	if p, ok := t[provider+"/"+model]; ok {
+		return p, true
+	}
+	p, ok := t[model]
+	return p, ok
+}
+
+// Price returns the price of model: the agent's own pricing when set,
+// otherwise the table entry.
+func (t PriceTable) Price(model ModelConfig) (ModelPrice, bool) {
+	if model.Pricing != nil {
+		return *model.Pricing, true
+	}
+	return t.Lookup(model.Provider, model.Name)
+}
+
+// Cost prices a call to model. ok is false when the model has no price, in
+// which case the cost is 0.
+func (t PriceTable) Cost(model ModelConfig, promptTokens, completionTokens int64) (cost float64, ok bool) {
+	p, ok := t.Price(model)
+	if !ok {
+		return 0, false
+	}
+	return float64(promptTokens)/1000*p.PromptPer1K + float64(completionTokens)/1000*p.CompletionPer1K, true
+}
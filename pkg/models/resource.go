@@ -13,6 +13,7 @@ const (
 	KindGuardrail ResourceKind = "Guardrail"
 	KindPipeline  ResourceKind = "Pipeline"
 	KindExecution ResourceKind = "Execution"
+	KindSLO       ResourceKind = "SLO"
 )
 
 func ParseResourceKind(s string) (ResourceKind, error) {
@@ -27,6 +28,8 @@ func ParseResourceKind(s string) (ResourceKind, error) {
 		return KindPipeline, nil
 	case "Execution":
 		return KindExecution, nil
+	case "SLO":
+		return KindSLO, nil
 	default:
 		return "", fmt.Errorf("unknown resource kind: %s", s)
 	}
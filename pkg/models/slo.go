@@ -0,0 +1,87 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SLOSuccessRatio = "success-ratio"
+	SLOLatency      = "latency"
+)
+
+// SLOLatencyBuckets are the bounds, in milliseconds, of the histogram that
+// latency SLOs are measured against. A latency threshold must be one of
+// them.
+var SLOLatencyBuckets = []float64{100, 250, 500, 1000, 2000, 2500, 5000, 10000, 15000, 30000, 60000, 120000, 300000, 600000}
+
+// SLOSpec sets an objective for one agent or pipeline in the resource's
+// namespace.
+type SLOSpec struct {
+	Description string         `yaml:"description,omitempty" json:"description,omitempty"`
+	Agent       string         `yaml:"agent,omitempty" json:"agent,omitempty"`
+	Pipeline    string         `yaml:"pipeline,omitempty" json:"pipeline,omitempty"`
+	Objective   SLOObjective   `yaml:"objective" json:"objective"`
+	Window      string         `yaml:"window,omitempty" json:"window,omitempty"` // compliance period, default 30d
+	BurnRates   []BurnRateRule `yaml:"burnRates,omitempty" json:"burnRates,omitempty"`
+	Alerting    SLOAlerting    `yaml:"alerting,omitempty" json:"alerting,omitempty"`
+}
+
+// SLOObjective is either a success ratio (target 0.99: 99% of executions
+// complete) or a latency percentile (percentile 0.95 and threshold 2s: 95%
+// of executions finish within 2s).
+type SLOObjective struct {
+	Type       string  `yaml:"type" json:"type"`
+	Target     float64 `yaml:"target,omitempty" json:"target,omitempty"`
+	Percentile float64 `yaml:"percentile,omitempty" json:"percentile,omitempty"`
+	Threshold  string  `yaml:"threshold,omitempty" json:"threshold,omitempty"`
+}
+
+// BurnRateRule alerts when the error budget burns at least Factor times
+// faster than sustainable over both the Long and the Short window. Without
+// a factor, it is derived from BudgetFraction.
+type BurnRateRule struct {
+	Long           string  `yaml:"long" json:"long"`
+	Short          string  `yaml:"short" json:"short"`
+	Factor         float64 `yaml:"factor,omitempty" json:"factor,omitempty"`
+	BudgetFraction float64 `yaml:"budgetFraction,omitempty" json:"budgetFraction,omitempty"` // share of the budget spent in Long
+	Severity       string  `yaml:"severity,omitempty" json:"severity,omitempty"`             // page or ticket
+}
+
+type SLOAlerting struct {
+	Webhook string            `yaml:"webhook,omitempty" json:"webhook,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+}
+
+// SLOAlert is sent to webhooks when a burn-rate rule starts or stops
+// firing.
+type SLOAlert struct {
+	SLO           ObjectReference `json:"slo"`
+	Target        ObjectReference `json:"target"`
+	State         string          `json:"state"` // firing or resolved
+	Severity      string          `json:"severity"`
+	Objective     string          `json:"objective"`
+	LongWindow    string          `json:"longWindow"`
+	ShortWindow   string          `json:"shortWindow"`
+	Factor        float64         `json:"factor"`
+	LongBurnRate  float64         `json:"longBurnRate"`
+	ShortBurnRate float64         `json:"shortBurnRate"`
+	SLI           float64         `json:"sli"` // over the long window
+	Message       string          `json:"message"`
+	StartsAt      time.Time       `json:"startsAt"`
+	Timestamp     time.Time       `json:"timestamp"`
+}
+
+// ParseDuration is time.ParseDuration that also accepts whole days, such
+// as 7d or 30d, which SLO windows and reports commonly use.
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
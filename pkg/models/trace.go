@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// SpanRecord is a finished span as stored for the trace viewer.
+type SpanRecord struct {
+	TraceID       string            `json:"traceId"`
+	SpanID        string            `json:"spanId"`
+	ParentID      string            `json:"parentId,omitempty"`
+	ExecutionID   string            `json:"executionId,omitempty"`
+	Operation     string            `json:"operation"`
+	StartTime     time.Time         `json:"startTime"`
+	EndTime       time.Time         `json:"endTime"`
+	DurationMs    float64           `json:"durationMs"`
+	Status        string            `json:"status"`
+	StatusMessage string            `json:"statusMessage,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	Events        []SpanEventRecord `json:"events,omitempty"`
+}
+
+type SpanEventRecord struct {
+	Name       string            `json:"name"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// TraceNode is a span with its children, ordered by start time. OffsetMs is
+// the start relative to the beginning of the trace and SelfMs the time not
+// covered by any child.
+type TraceNode struct {
+	SpanRecord
+	OffsetMs float64      `json:"offsetMs"`
+	SelfMs   float64      `json:"selfMs"`
+	Children []*TraceNode `json:"children,omitempty"`
+}
+
+// ExecutionTrace is the span tree of one execution. Spans whose parent was
+// not recorded, such as the caller's, are roots.
+type ExecutionTrace struct {
+	ExecutionID string       `json:"executionId"`
+	TraceID     string       `json:"traceId,omitempty"`
+	StartTime   time.Time    `json:"startTime"`
+	DurationMs  float64      `json:"durationMs"`
+	SpanCount   int          `json:"spanCount"`
+	Roots       []*TraceNode `json:"roots"`
+}
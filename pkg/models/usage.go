@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// UsageRecord is the token usage and cost of one model call.
+type UsageRecord struct {
+	ID               int64     `json:"id,omitempty"`
+	ExecutionID      string    `json:"executionId"`
+	AgentName        string    `json:"agentName"`
+	PipelineName     string    `json:"pipelineName,omitempty"`
+	Namespace        string    `json:"namespace"`
+	Step             int       `json:"step"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int64     `json:"promptTokens"`
+	CompletionTokens int64     `json:"completionTokens"`
+	Cost             float64   `json:"cost"`
+	Priced           bool      `json:"priced"` // false when the model had no price, so Cost is 0
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+func (u UsageRecord) TotalTokens() int64 {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// UsageQuery selects usage records for aggregation. Window splits
+// [Since, Until) into buckets; zero means a single bucket. GroupBy takes
+// any of execution, agent, pipeline, namespace, provider and model.
+type UsageQuery struct {
+	Since       time.Time
+	Until       time.Time
+	Window      time.Duration
+	GroupBy     []string
+	Namespace   string
+	Agent       string
+	Pipeline    string
+	ExecutionID string
+	Limit       int
+}
+
+type UsageStat struct {
+	BucketStart      time.Time `json:"bucketStart"`
+	ExecutionID      string    `json:"executionId,omitempty"`
+	AgentName        string    `json:"agentName,omitempty"`
+	PipelineName     string    `json:"pipelineName,omitempty"`
+	Namespace        string    `json:"namespace,omitempty"`
+	Provider         string    `json:"provider,omitempty"`
+	Model            string    `json:"model,omitempty"`
+	Calls            int64     `json:"calls"`
+	Executions       int64     `json:"executions"`
+	PromptTokens     int64     `json:"promptTokens"`
+	CompletionTokens int64     `json:"completionTokens"`
+	TotalTokens      int64     `json:"totalTokens"`
+	Cost             float64   `json:"cost"`
+	UnpricedCalls    int64     `json:"unpricedCalls,omitempty"`
+}
+
+// BudgetCharge adds usage to one budget key. A non-zero MaxTokens or
+// MaxCost makes the charge conditional: it is refused when the key would
+// go past the limit.
+type BudgetCharge struct {
+	Key       string
+	Tokens    int64
+	Cost      float64
+	MaxTokens int64
+	MaxCost   float64
+}
+
+// Exceeds reports whether usage is past the charge's limits.
+func (c BudgetCharge) Exceeds(u BudgetUsage) bool {
+	return (c.MaxTokens > 0 && u.Tokens > c.MaxTokens) || (c.MaxCost > 0 && u.Cost > c.MaxCost)
+}
+
+type BudgetUsage struct {
+	Tokens int64   `json:"tokens"`
+	Cost   float64 `json:"cost"`
+}
@@ -0,0 +1,73 @@
+package observability
+
+import (
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+// ResourceWatcher is the part of the store PruneDeleted follows.
+type ResourceWatcher interface {
+	List(kind models.ResourceKind, namespace string) ([]*models.GenericResource, error)
+	Watch(kind models.ResourceKind) <-chan store.ResourceEvent
+}
+
+// namespacedKinds are the kinds whose series are labelled by namespace. A
+// namespace with none of them left is gone.
+var namespacedKinds = []models.ResourceKind{models.KindAgent, models.KindPipeline, models.KindTool, models.KindGuardrail}
+
+// PruneDeleted removes the series of agents, pipelines and guardrails as
+// they are deleted, and every series of a namespace once its last resource
+// is deleted, until stop is closed.
+func (r *MetricsRegistry) PruneDeleted(s ResourceWatcher, stop <-chan struct{}) {
+	agents := s.Watch(models.KindAgent)
+	pipelines := s.Watch(models.KindPipeline)
+	tools := s.Watch(models.KindTool)
+	guardrails := s.Watch(models.KindGuardrail)
+	for {
+		var ev store.ResourceEvent
+		select {
+		case ev = <-agents:
+		case ev = <-pipelines:
+		case ev = <-tools:
+		case ev = <-guardrails:
+		case <-stop:
+			return
+		}
+		if ev.Type != store.EventDeleted || ev.Resource == nil {
+			continue
+		}
+		r.Forget(ev.Resource)
+		if ns := ev.Resource.Metadata.Namespace; ns != "" && namespaceEmpty(s, ns) {
+			r.DeleteMatching(map[string]string{"namespace": ns})
+		}
+	}
+}
+
+// Forget removes the series labelled with a deleted resource and returns
+// how many were removed. Agents and pipelines are matched within their
+// namespace, both by an agent label and by the kind and name labels the
+// SLO metrics use; guardrails by their guardrail label.
+func (r *MetricsRegistry) Forget(res *models.GenericResource) int {
+	name, ns := res.Metadata.Name, res.Metadata.Namespace
+	switch res.Kind {
+	case models.KindAgent:
+		return r.DeleteMatching(map[string]string{"namespace": ns, "agent": name}) +
+			r.DeleteMatching(map[string]string{"namespace": ns, "kind": "agent", "name": name})
+	case models.KindPipeline:
+		return r.DeleteMatching(map[string]string{"namespace": ns, "pipeline": name}) +
+			r.DeleteMatching(map[string]string{"namespace": ns, "kind": "pipeline", "name": name})
+	case models.KindGuardrail:
+		return r.DeleteMatching(map[string]string{"guardrail": name})
+	}
+	return 0
+}
+
+func namespaceEmpty(s ResourceWatcher, namespace string) bool {
+	for _, kind := range namespacedKinds {
+		resources, err := s.List(kind, namespace)
+		if err != nil || len(resources) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package observability
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+type fakeWatcher struct {
+	mu        sync.Mutex
+	resources map[models.ResourceKind][]*models.GenericResource
+	watches   map[models.ResourceKind]chan store.ResourceEvent
+}
+
+func newFakeWatcher() *fakeWatcher {
+	w := &fakeWatcher{
+		resources: make(map[models.ResourceKind][]*models.GenericResource),
+		watches:   make(map[models.ResourceKind]chan store.ResourceEvent),
+	}
+	for _, kind := range namespacedKinds {
+		w.watches[kind] = make(chan store.ResourceEvent)
+	}
+	return w
+}
+
+func (w *fakeWatcher) List(kind models.ResourceKind, namespace string) ([]*models.GenericResource, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var out []*models.GenericResource
+	for _, res := range w.resources[kind] {
+		if res.Metadata.Namespace == namespace {
+			out = append(out, res)
+		}
+	}
+	return out, nil
+}
+
+func (w *fakeWatcher) Watch(kind models.ResourceKind) <-chan store.ResourceEvent {
+	return w.watches[kind]
+}
+
+func (w *fakeWatcher) add(kind models.ResourceKind, namespace, name string) *models.GenericResource {
+	res := &models.GenericResource{Kind: kind, Metadata: models.Metadata{Name: name, Namespace: namespace}}
+	w.mu.Lock()
+	w.resources[kind] = append(w.resources[kind], res)
+	w.mu.Unlock()
+	return res
+}
+
+// delete removes res and sends its event; the send returns once
+// PruneDeleted has received it.
+func (w *fakeWatcher) delete(res *models.GenericResource) {
+	w.mu.Lock()
+	kept := w.resources[res.Kind][:0]
+	for _, r := range w.resources[res.Kind] {
+		if r != res {
+			kept = append(kept, r)
+		}
+	}
+	w.resources[res.Kind] = kept
+	w.mu.Unlock()
+	w.watches[res.Kind] <- store.ResourceEvent{Type: store.EventDeleted, Resource: res}
+}
+
+func TestPruneDeletedResources(t *testing.T) {
+	r := NewMetricsRegistry()
+	violations := r.CounterVec("guardrail.violations", "guardrail", "agent", "namespace")
+	executions := r.CounterVec("slo.executions", "namespace", "kind", "name")
+	usage := r.CounterVec("usage.tokens", "namespace", "agent")
+	queued := r.GaugeVec("queue.depth", "namespace")
+	for _, ns := range []string{"team", "other"} {
+		queued.WithLabelValues(ns).Set(1)
+		for _, agent := range []string{"a", "b"} {
+			violations.WithLabelValues("pii", agent, ns).Inc()
+			executions.WithLabelValues(ns, "agent", agent).Inc()
+			usage.WithLabelValues(ns, agent).Inc()
+		}
+	}
+	executions.WithLabelValues("team", "pipeline", "p").Inc()
+
+	w := newFakeWatcher()
+	a := w.add(models.KindAgent, "team", "a")
+	b := w.add(models.KindAgent, "team", "b")
+	p := w.add(models.KindPipeline, "team", "p")
+	w.add(models.KindAgent, "other", "a")
+	w.add(models.KindAgent, "other", "b")
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.PruneDeleted(w, stop)
+		close(done)
+	}()
+
+	series := func() int {
+		return violations.Len() + executions.Len() + usage.Len() + queued.Len()
+	}
+	has := func(v *metricVec, values ...string) bool {
+		_, key := v.key(values)
+		v.mu.RLock()
+		defer v.mu.RUnlock()
+		_, ok := v.series[key]
+		return ok
+	}
+
+	w.delete(a)
+	w.delete(p)
+	// A further delete is only received after the previous ones are handled.
+	w.delete(w.add(models.KindTool, "scratch", "t"))
+	if got := series(); got != 11 {
+		t.Fatalf("after deleting agent a and pipeline p: %d series, want 11", got)
+	}
+	if !has(violations.metricVec, "pii", "a", "other") || !has(queued.metricVec, "team") {
+		t.Fatal("pruned series of resources that still exist")
+	}
+
+	w.delete(b)
+	w.delete(w.add(models.KindTool, "scratch", "t"))
+	if got := series(); got != 7 {
+		t.Fatalf("after emptying namespace team: %d series, want 7", got)
+	}
+	if has(queued.metricVec, "team") {
+		t.Fatal("namespace series kept after its last resource was deleted")
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("PruneDeleted did not return after stop")
+	}
+}
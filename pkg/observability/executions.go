@@ -0,0 +1,93 @@
+package observability
+
+import (
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+// ExecutionLatencyBuckets are the bucket bounds, in milliseconds, of the
+// execution and step latency histograms.
+var ExecutionLatencyBuckets = ExponentialBuckets(10, 2.5, 12)
+
+// staleStepAfter is how long a step may be seen running without another
+// event before it is forgotten. Its execution was lost, or the event that
+// would end the step was; timing it from a late event would be wrong.
+const staleStepAfter = 6 * time.Hour
+
+// stepMark is the step an execution was last seen running and since when.
+type stepMark struct {
+	step  int
+	since time.Time
+}
+
+// RecordLatencies records execution and step latency from execution events
+// until events is closed. Pass it the store's WatchExecutions channel.
+//
+// A step is timed from the event that shows the execution running it to
+// the event that shows it on another step or finished. Time spent paused
+// or waiting to retry is not counted. Steps of deleted executions, and
+// steps with no event for staleStepAfter, are forgotten without being
+// timed.
+func (r *MetricsRegistry) RecordLatencies(events <-chan store.ExecutionEvent) {
+	running := make(map[string]stepMark)
+	var swept time.Time
+	for ev := range events {
+		exec := ev.Execution
+		if ev.Type == store.EventDeleted {
+			delete(running, exec.ID)
+			continue
+		}
+		if now := exec.UpdatedAt; now.Sub(swept) >= staleStepAfter {
+			for id, mark := range running {
+				if now.Sub(mark.since) >= staleStepAfter {
+					delete(running, id)
+				}
+			}
+			swept = now
+		}
+
+		mark, wasRunning := running[exec.ID]
+		if wasRunning && exec.UpdatedAt.Sub(mark.since) >= staleStepAfter {
+			delete(running, exec.ID)
+			wasRunning = false
+		}
+		if wasRunning && (exec.State != models.ExecRunning || exec.CurrentStep != mark.step) {
+			r.observeLatency("step", exec, exec.UpdatedAt.Sub(mark.since))
+			delete(running, exec.ID)
+			wasRunning = false
+		}
+		switch {
+		case exec.State.IsTerminal():
+			if latency, ok := executionLatency(exec); ok {
+				r.observeLatency("execution", exec, latency)
+			}
+		case exec.State == models.ExecRunning && !wasRunning:
+			running[exec.ID] = stepMark{step: exec.CurrentStep, since: exec.UpdatedAt}
+		}
+	}
+}
+
+// observeLatency records d in the <what>.latency.ms histogram and the
+// <what>.latency.quantiles.ms summary, labelled by namespace and agent.
+func (r *MetricsRegistry) observeLatency(what string, exec *models.ExecutionRecord, d time.Duration) {
+	if d < 0 {
+		return
+	}
+	ms := float64(d.Microseconds()) / 1000
+	r.HistogramVecWithBuckets(what+".latency.ms", ExecutionLatencyBuckets, "namespace", "agent").
+		WithLabelValues(exec.Namespace, exec.AgentName).Observe(ms)
+	r.SummaryVec(what+".latency.quantiles.ms", SummaryOpts{}, "namespace", "agent").
+		WithLabelValues(exec.Namespace, exec.AgentName).Observe(ms)
+}
+
+func executionLatency(exec *models.ExecutionRecord) (time.Duration, bool) {
+	if exec.LatencyMs > 0 {
+		return time.Duration(exec.LatencyMs) * time.Millisecond, true
+	}
+	if exec.StartedAt != nil && exec.CompletedAt != nil {
+		return exec.CompletedAt.Sub(*exec.StartedAt), true
+	}
+	return 0, false
+}
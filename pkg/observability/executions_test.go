@@ -0,0 +1,109 @@
+package observability
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+func TestRecordLatencies(t *testing.T) {
+	r := NewMetricsRegistry()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+	started, completed := at(0), at(900)
+	event := func(state models.ExecutionState, step, ms int) store.ExecutionEvent {
+		exec := &models.ExecutionRecord{ID: "e1", AgentName: "a", Namespace: "default", State: state, CurrentStep: step, UpdatedAt: at(ms)}
+		if state.IsTerminal() {
+			exec.StartedAt, exec.CompletedAt = &started, &completed
+		}
+		return store.ExecutionEvent{Type: store.EventUpdated, Execution: exec}
+	}
+
+	events := make(chan store.ExecutionEvent, 10)
+	events <- event(models.ExecRunning, 0, 0)
+	events <- event(models.ExecRunning, 1, 100)
+	events <- event(models.ExecPaused, 1, 300)   // step 1 ran 200ms
+	events <- event(models.ExecRunning, 1, 5000) // the pause is not counted
+	events <- event(models.ExecCompleted, 1, 5400)
+	close(events)
+	r.RecordLatencies(events)
+
+	steps := r.HistogramVecWithBuckets("step.latency.ms", ExecutionLatencyBuckets, "namespace", "agent").
+		WithLabelValues("default", "a")
+	if count, sum, _ := steps.Snapshot(); count != 3 || sum != 100+200+400 {
+		t.Errorf("step latency: %d observations summing to %v, want 3 summing to 700", count, sum)
+	}
+	execs := r.HistogramVecWithBuckets("execution.latency.ms", ExecutionLatencyBuckets, "namespace", "agent").
+		WithLabelValues("default", "a")
+	if count, sum, _ := execs.Snapshot(); count != 1 || sum != 900 {
+		t.Errorf("execution latency: %d observations summing to %v, want one of 900", count, sum)
+	}
+	if count, _, _ := r.SummaryVec("step.latency.quantiles.ms", SummaryOpts{}, "namespace", "agent").
+		WithLabelValues("default", "a").Snapshot(); count != 3 {
+		t.Errorf("step latency summary has %d observations, want 3", count)
+	}
+}
+
+func TestRecordLatenciesForgetsSteps(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(typ store.EventType, state models.ExecutionState, step int, at time.Duration) store.ExecutionEvent {
+		return store.ExecutionEvent{Type: typ, Execution: &models.ExecutionRecord{
+			ID: "e1", AgentName: "a", Namespace: "default", State: state, CurrentStep: step, UpdatedAt: t0.Add(at),
+		}}
+	}
+	for _, tc := range []struct {
+		name   string
+		events []store.ExecutionEvent
+	}{
+		{"deleted execution", []store.ExecutionEvent{
+			event(store.EventUpdated, models.ExecRunning, 0, 0),
+			event(store.EventDeleted, models.ExecRunning, 0, time.Second),
+			event(store.EventUpdated, models.ExecRunning, 1, 2*time.Second),
+		}},
+		{"late event", []store.ExecutionEvent{
+			event(store.EventUpdated, models.ExecRunning, 0, 0),
+			event(store.EventUpdated, models.ExecRunning, 1, staleStepAfter+time.Second),
+		}},
+	} {
+		r := NewMetricsRegistry()
+		events := make(chan store.ExecutionEvent, len(tc.events))
+		for _, ev := range tc.events {
+			events <- ev
+		}
+		close(events)
+		r.RecordLatencies(events)
+
+		steps := r.HistogramVecWithBuckets("step.latency.ms", ExecutionLatencyBuckets, "namespace", "agent").
+			WithLabelValues("default", "a")
+		if count, sum, _ := steps.Snapshot(); count != 0 {
+			t.Errorf("%s: %d step observations summing to %v, want none", tc.name, count, sum)
+		}
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := NewHistogram([]float64{10, 20, 30})
+	if q := h.Quantile(0.5); !math.IsNaN(q) {
+		t.Errorf("empty histogram quantile = %v, want NaN", q)
+	}
+	h.Observe(15)
+	h.Observe(18)
+	h.Observe(25)
+	h.Observe(26)
+	for _, tc := range []struct {
+		q, want float64
+	}{
+		{0, 10}, // lower bound of the first occupied bucket, not of the first bucket
+		{0.25, 15},
+		{0.5, 20},
+		{1, 30},
+		{-1, 10},
+	} {
+		if got := h.Quantile(tc.q); got != tc.want {
+			t.Errorf("Quantile(%v) = %v, want %v", tc.q, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,530 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+)
+
+// SpanExporter sends finished spans somewhere durable.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+type BatchOptions struct {
+	MaxQueueSize  int           // spans buffered before new ones are dropped, default 2048
+	MaxBatchSize  int           // spans per export call, default 512
+	BatchInterval time.Duration // flush at least this often, default 5s
+	ExportTimeout time.Duration // per export call, default 30s
+}
+
+// BatchProcessor queues ended spans and exports them in batches from a
+// background goroutine, so ending a span never waits on the network.
+type BatchProcessor struct {
+	exporter SpanExporter
+	opts     BatchOptions
+	logger   *Logger
+
+	queue   chan *Span
+	flushCh chan chan struct{}
+	stopCh  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	mu      sync.Mutex
+	dropped int64
+}
+
+func NewBatchProcessor(exporter SpanExporter, logger *Logger, opts BatchOptions) *BatchProcessor {
+	if opts.MaxQueueSize <= 0 {
+		opts.MaxQueueSize = 2048
+	}
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = 512
+	}
+	if opts.BatchInterval <= 0 {
+		opts.BatchInterval = 5 * time.Second
+	}
+	if opts.ExportTimeout <= 0 {
+		opts.ExportTimeout = 30 * time.Second
+	}
+	p := &BatchProcessor{
+		exporter: exporter,
+		opts:     opts,
+		logger:   logger.With("exporter"),
+		queue:    make(chan *Span, opts.MaxQueueSize),
+		flushCh:  make(chan chan struct{}),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *BatchProcessor) OnEnd(span *Span) {
+	select {
+	case p.queue <- span:
+	default:
+		p.mu.Lock()
+		p.dropped++
+		p.mu.Unlock()
+	}
+}
+
+// Dropped returns how many spans were discarded because the queue was full.
+func (p *BatchProcessor) Dropped() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
+
+// ForceFlush exports everything queued so far.
+func (p *BatchProcessor) ForceFlush(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case p.flushCh <- ack:
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *BatchProcessor) Shutdown(ctx context.Context) error {
+	p.once.Do(func() { close(p.stopCh) })
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.exporter.Shutdown(ctx)
+}
+
+func (p *BatchProcessor) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.opts.BatchInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, p.opts.MaxBatchSize)
+	drain := func() {
+		for {
+			select {
+			case s := <-p.queue:
+				batch = append(batch, s)
+				if len(batch) >= p.opts.MaxBatchSize {
+					p.export(batch)
+					batch = batch[:0]
+				}
+			default:
+				if len(batch) > 0 {
+					p.export(batch)
+					batch = batch[:0]
+				}
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-p.queue:
+			batch = append(batch, s)
+			if len(batch) >= p.opts.MaxBatchSize {
+				p.export(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			drain()
+		case ack := <-p.flushCh:
+			drain()
+			close(ack)
+		case <-p.stopCh:
+			drain()
+			return
+		}
+	}
+}
+
+func (p *BatchProcessor) export(batch []*Span) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.ExportTimeout)
+	defer cancel()
+	spans := append([]*Span(nil), batch...)
+	if err := p.exporter.ExportSpans(ctx, spans); err != nil {
+		p.logger.Warn("span export failed", "spans", len(spans), "error", err.Error())
+	}
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP/HTTP
+// with JSON encoding.
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	headers     map[string]string
+	client      *http.Client
+}
+
+// NewOTLPExporter posts to endpoint, e.g. http://localhost:4318/v1/traces.
+func NewOTLPExporter(endpoint, serviceName string, headers map[string]string) *OTLPExporter {
+	if endpoint == "" {
+		endpoint = "http://localhost:4318/v1/traces"
+	}
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		headers:     headers,
+		client:      &http.Client{},
+	}
+}
+
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(otlpRequest(e.serviceName, spans))
+	if err != nil {
+		return err
+	}
+
+	if err := PostJSON(ctx, e.client, e.endpoint, e.headers, body); err != nil {
+		return fmt.Errorf("otlp export: %w", err)
+	}
+	return nil
+}
+
+// PostJSON posts a JSON body to url. A throttling or unavailable receiver
+// (429, 502, 503 or 504) is retried once after a second; any other
+// response outside 2xx is an error.
+func PostJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode < 300:
+			return nil
+		case attempt == 0 && retryable(resp.StatusCode):
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		default:
+			return fmt.Errorf("receiver returned %s", resp.Status)
+		}
+	}
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// FileExporter writes one JSON span per line, for local debugging or for
+// shipping with a log collector.
+type FileExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+	f  *os.File
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{w: f, f: f}, nil
+}
+
+// NewWriterExporter writes spans to w, which is not closed on Shutdown.
+func NewWriterExporter(w io.Writer) *FileExporter {
+	return &FileExporter{w: w}
+}
+
+func (e *FileExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		s.mu.Lock()
+		err := enc.Encode(s)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *FileExporter) Shutdown(ctx context.Context) error {
+	if e.f == nil {
+		return nil
+	}
+	return e.f.Close()
+}
+
+// TraceConfig selects the exporters ConfigureTracing registers. With
+// neither set, spans are only kept by processors registered elsewhere.
+type TraceConfig struct {
+	ServiceName  string
+	OTLPEndpoint string            // OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces
+	OTLPHeaders  map[string]string // sent with every export, e.g. for auth
+	File         string            // one JSON span per line
+}
+
+// TraceConfigFromEnv reads PIPE_OTLP_ENDPOINT, PIPE_OTLP_HEADERS (comma
+// separated key=value pairs) and PIPE_TRACE_FILE.
+func TraceConfigFromEnv() (TraceConfig, error) {
+	cfg := TraceConfig{
+		ServiceName:  "pipe-server",
+		OTLPEndpoint: os.Getenv("PIPE_OTLP_ENDPOINT"),
+		File:         os.Getenv("PIPE_TRACE_FILE"),
+	}
+	if v := os.Getenv("PIPE_OTLP_HEADERS"); v != "" {
+		cfg.OTLPHeaders = make(map[string]string)
+		for _, pair := range strings.Split(v, ",") {
+			k, val, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(k) == "" {
+				return cfg, fmt.Errorf("PIPE_OTLP_HEADERS: want key=value pairs, got %q", pair)
+			}
+			cfg.OTLPHeaders[strings.TrimSpace(k)] = strings.TrimSpace(val)
+		}
+	}
+	return cfg, nil
+}
+
+// ConfigureTracing registers a BatchProcessor on t for each exporter cfg
+// names. Tracer.Shutdown flushes them.
+func ConfigureTracing(t *Tracer, cfg TraceConfig, logger *Logger) error {
+	if cfg.File != "" {
+		exporter, err := NewFileExporter(cfg.File)
+		if err != nil {
+			return fmt.Errorf("trace file: %w", err)
+		}
+		t.RegisterProcessor(NewBatchProcessor(exporter, logger, BatchOptions{}))
+	}
+	if cfg.OTLPEndpoint != "" {
+		exporter := NewOTLPExporter(cfg.OTLPEndpoint, cfg.ServiceName, cfg.OTLPHeaders)
+		t.RegisterProcessor(NewBatchProcessor(exporter, logger, BatchOptions{}))
+	}
+	return nil
+}
+
+// SpanStore is the part of the store the StoreExporter needs.
+type SpanStore interface {
+	AppendSpans(spans []models.SpanRecord) error
+	DeleteSpansBefore(t time.Time) (int64, error)
+}
+
+// StoreExporter keeps the spans of executions in the local store so the
+// trace viewer can show them without a collector. Spans not tagged with an
+// execution, such as health checks and scrapes, are left to the other
+// exporters.
+type StoreExporter struct {
+	store  SpanStore
+	logger *Logger
+}
+
+func NewStoreExporter(store SpanStore, logger *Logger) *StoreExporter {
+	return &StoreExporter{store: store, logger: logger.With("spans")}
+}
+
+func (e *StoreExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	records := make([]models.SpanRecord, 0, len(spans))
+	for _, s := range spans {
+		if r := s.Record(); r.ExecutionID != "" {
+			records = append(records, r)
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return e.store.AppendSpans(records)
+}
+
+// Prune deletes spans started longer than ttl ago. Run it periodically;
+// StartPruning does so in the background.
+func (e *StoreExporter) Prune(ttl time.Duration) {
+	n, err := e.store.DeleteSpansBefore(time.Now().UTC().Add(-ttl))
+	if err != nil {
+		e.logger.Error("failed to prune spans", "error", err)
+		return
+	}
+	if n > 0 {
+		e.logger.Debug("pruned spans", "count", n)
+	}
+}
+
+// StartPruning prunes every interval until stop is closed.
+func (e *StoreExporter) StartPruning(ttl, interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.Prune(ttl)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (e *StoreExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// The types below mirror the OTLP/JSON trace request. IDs are hex strings
+// and 64-bit integers are decimal strings, as the protocol requires.
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 0 unset, 1 ok, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func otlpRequest(serviceName string, spans []*Span) otlpTraceRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		o := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Operation,
+			Kind:              otlpSpanKind(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Tags),
+			Status:            otlpStatus{Message: s.StatusMessage},
+		}
+		switch s.Status {
+		case SpanStatusOK:
+			o.Status.Code = 1
+		case SpanStatusError:
+			o.Status.Code = 2
+		}
+		for _, ev := range s.Events {
+			o.Events = append(o.Events, otlpEvent{
+				TimeUnixNano: strconv.FormatInt(ev.Timestamp.UnixNano(), 10),
+				Name:         ev.Name,
+				Attributes:   otlpAttributes(ev.Attributes),
+			})
+		}
+		s.mu.Unlock()
+		out = append(out, o)
+	}
+
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]string{"service.name": serviceName})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/Promptonauts/pipe"}, Spans: out}},
+	}}}
+}
+
+// otlpSpanKind maps a SpanKind constant onto the OTLP enum.
+func otlpSpanKind(kind string) int {
+	switch kind {
+	case SpanKindServer:
+		return 2
+	case SpanKindClient:
+		return 3
+	case SpanKindProducer:
+		return 4
+	case SpanKindConsumer:
+		return 5
+	}
+	return 1
+}
+
+func otlpAttributes(m map[string]string) []otlpKeyValue {
+	if len(m) == 0 {
+		return nil
+	}
+	kv := make([]otlpKeyValue, 0, len(m))
+	for k, v := range m {
+		kv = append(kv, otlpKeyValue{Key: k, Value: otlpValue{StringValue: v}})
+	}
+	return kv
+}
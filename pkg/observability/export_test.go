@@ -0,0 +1,191 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+)
+
+// collectorStub is an in-process OTLP/HTTP collector. It answers the first
+// `unavailable` requests with 503.
+type collectorStub struct {
+	mu          sync.Mutex
+	requests    int
+	unavailable int
+	spans       []otlpSpan
+	service     string
+}
+
+func (c *collectorStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests++
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if c.unavailable > 0 {
+		c.unavailable--
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+	var req otlpTraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, rs := range req.ResourceSpans {
+		for _, kv := range rs.Resource.Attributes {
+			if kv.Key == "service.name" {
+				c.service = kv.Value.StringValue
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestOTLPExportToCollector(t *testing.T) {
+	collector := &collectorStub{unavailable: 1}
+	cs := httptest.NewServer(collector)
+	defer cs.Close()
+
+	tracer := NewTracer(NewLogger("test"))
+	exporter := NewOTLPExporter(cs.URL+"/v1/traces", "pipe-test", map[string]string{"Authorization": "Bearer token"})
+	bp := NewBatchProcessor(exporter, NewLogger("test"), BatchOptions{BatchInterval: time.Hour})
+	tracer.RegisterProcessor(bp)
+
+	// A tool endpoint traced by a server span, called through a traced client.
+	tool := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracer.Start(Extract(r.Context(), r.Header), "tool")
+		span.SetKind(SpanKindServer)
+		span.End()
+	}))
+	defer tool.Close()
+
+	ctx, root := tracer.Start(context.Background(), "execution")
+	client := &http.Client{Transport: NewTransport(nil, tracer)}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, tool.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	root.RecordError(errors.New("step failed"))
+	root.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if collector.requests != 2 {
+		t.Errorf("collector got %d requests, want a 503 then a retry", collector.requests)
+	}
+	if collector.service != "pipe-test" {
+		t.Errorf("service.name = %q", collector.service)
+	}
+	byName := make(map[string]otlpSpan)
+	for _, s := range collector.spans {
+		byName[s.Name] = s
+	}
+	exec, call, server := byName["execution"], byName["HTTP GET"], byName["tool"]
+	if len(collector.spans) != 3 || exec.SpanID == "" || call.SpanID == "" || server.SpanID == "" {
+		t.Fatalf("collector spans = %+v", collector.spans)
+	}
+	if exec.Kind != 1 || call.Kind != 3 || server.Kind != 2 {
+		t.Errorf("kinds: execution %d, client %d, server %d; want 1, 3, 2", exec.Kind, call.Kind, server.Kind)
+	}
+	if call.ParentSpanID != exec.SpanID || server.ParentSpanID != call.SpanID {
+		t.Errorf("parents: client %q (want %q), server %q (want %q)", call.ParentSpanID, exec.SpanID, server.ParentSpanID, call.SpanID)
+	}
+	if call.TraceID != exec.TraceID || server.TraceID != exec.TraceID {
+		t.Error("spans are not in one trace")
+	}
+	if exec.Status.Code != 2 || exec.Status.Message != "step failed" || len(exec.Events) != 1 {
+		t.Errorf("execution status = %+v, events %d", exec.Status, len(exec.Events))
+	}
+}
+
+func TestConfigureTracingFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	t.Setenv("PIPE_TRACE_FILE", path)
+	t.Setenv("PIPE_OTLP_HEADERS", "Authorization=Bearer token, X-Tenant=pipe")
+	cfg, err := TraceConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OTLPHeaders["Authorization"] != "Bearer token" || cfg.OTLPHeaders["X-Tenant"] != "pipe" {
+		t.Errorf("headers = %v", cfg.OTLPHeaders)
+	}
+
+	tracer := NewTracer(NewLogger("test"))
+	if err := ConfigureTracing(tracer, cfg, NewLogger("test")); err != nil {
+		t.Fatal(err)
+	}
+	_, span := tracer.Start(context.Background(), "execution")
+	span.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Span
+	if err := json.Unmarshal(data, &got); err != nil || got.Operation != "execution" || got.SpanID != span.SpanID {
+		t.Fatalf("trace file = %s (%v)", data, err)
+	}
+
+	t.Setenv("PIPE_OTLP_HEADERS", "no-equals")
+	if _, err := TraceConfigFromEnv(); err == nil {
+		t.Error("malformed PIPE_OTLP_HEADERS accepted")
+	}
+}
+
+type spanStoreStub struct {
+	spans []models.SpanRecord
+}
+
+func (s *spanStoreStub) AppendSpans(spans []models.SpanRecord) error {
+	s.spans = append(s.spans, spans...)
+	return nil
+}
+
+func (s *spanStoreStub) DeleteSpansBefore(t time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestStoreExporterKeepsExecutionSpans(t *testing.T) {
+	tracer := NewTracer(NewLogger("test"))
+	_, health := tracer.Start(context.Background(), "GET /healthz")
+	ctx, exec := tracer.Start(context.Background(), "execution")
+	exec.SetTag(AttrExecutionID, "e1")
+	_, step := tracer.Start(ctx, "step")
+
+	store := &spanStoreStub{}
+	if err := NewStoreExporter(store, NewLogger("test")).ExportSpans(context.Background(), []*Span{health, exec, step}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.spans) != 2 || store.spans[0].SpanID != exec.SpanID || store.spans[1].SpanID != step.SpanID {
+		t.Errorf("stored %+v, want the execution span and its child", store.spans)
+	}
+}
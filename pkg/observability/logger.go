@@ -1,21 +1,69 @@
 package observability
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelOff
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "OFF"
+	}
+}
+
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	case "off", "none":
+		return LevelOff, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
 type Logger struct {
 	component string
+	fields    map[string]interface{} // added to every line, e.g. trace and span IDs
+	core      *logCore
 }
 
+// NewLogger returns a logger for component that shares the process-wide
+// levels, sinks and sampling set with ConfigureLogging.
 func NewLogger(component string) *Logger {
-	return &Logger{component: component}
+	return &Logger{component: component, core: defaultCore}
 }
 
-type logEntry struct {
+type LogEntry struct {
 	Timestamp string                 `json:"timestamp"`
 	Level     string                 `json:"level"`
 	Component string                 `json:"component"`
@@ -23,36 +71,79 @@ type logEntry struct {
 	Fields    map[string]interface{} `json:"fields,omitempty"`
 }
 
-func (l *Logger) log(level, msg string, fields map[string]interface{}) {
-	entry := logEntry{
+func (l *Logger) log(level Level, msg string, fields map[string]interface{}) {
+	if !l.core.enabled(l.component, level) {
+		return
+	}
+	if level < LevelWarn && !l.core.sample(l.component, msg) {
+		return
+	}
+	if len(l.fields) > 0 {
+		merged := make(map[string]interface{}, len(l.fields)+len(fields))
+		for k, v := range l.fields {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			merged[k] = v
+		}
+		fields = merged
+	}
+	l.core.write(LogEntry{
 		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
-		Level:     level,
+		Level:     level.String(),
 		Component: l.component,
 		Message:   msg,
 		Fields:    fields,
-	}
-	data, _ := json.Marshal(entry)
-	fmt.Fprintln(os.Stderr, string(data))
+	})
 }
 
 func (l *Logger) Info(msg string, kv ...interface{}) {
-	l.log("INFO", msg, toMap(kv))
+	l.log(LevelInfo, msg, toMap(kv))
 }
 
 func (l *Logger) Error(msg string, kv ...interface{}) {
-	l.log("ERROR", msg, toMap(kv))
+	l.log(LevelError, msg, toMap(kv))
 }
 
 func (l *Logger) Warn(msg string, kv ...interface{}) {
-	l.log("WARN", msg, toMap(kv))
+	l.log(LevelWarn, msg, toMap(kv))
 }
 
 func (l *Logger) Debug(msg string, kv ...interface{}) {
-	l.log("DEBUG", msg, toMap(kv))
+	l.log(LevelDebug, msg, toMap(kv))
+}
+
+// Enabled reports whether lines at level would be written, so callers can
+// skip building expensive fields.
+func (l *Logger) Enabled(level Level) bool {
+	return l.core.enabled(l.component, level)
 }
 
 func (l *Logger) With(component string) *Logger {
-	return &Logger{component: l.component + "." + component}
+	return &Logger{component: l.component + "." + component, fields: l.fields, core: l.core}
+}
+
+// WithFields returns a logger that adds kv to every line.
+func (l *Logger) WithFields(kv ...interface{}) *Logger {
+	fields := make(map[string]interface{}, len(l.fields)+len(kv)/2)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for k, v := range toMap(kv) {
+		fields[k] = v
+	}
+	return &Logger{component: l.component, fields: fields, core: l.core}
+}
+
+// WithContext returns a logger that tags every line with the trace and
+// span IDs of the span in ctx, or of the remote parent when there is no
+// local span yet.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return l
+	}
+	return l.WithFields("traceId", sc.TraceID, "spanId", sc.SpanID)
 }
 
 func toMap(kv []interface{}) map[string]interface{} {
@@ -69,3 +160,254 @@ func toMap(kv []interface{}) map[string]interface{} {
 	}
 	return m
 }
+
+// LogSampling limits repetitive Debug and Info lines: per component and
+// message, the first Initial lines in each Tick are written and after that
+// only every Thereafter-th. Warnings and errors are never sampled.
+type LogSampling struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration
+}
+
+// logCore holds the state shared by a logger and everything derived from
+// it with With.
+type logCore struct {
+	mu        sync.RWMutex
+	level     Level
+	overrides map[string]Level // component pattern -> level
+	cache     map[string]Level // resolved level per component
+	sinks     []Sink
+	sampling  *LogSampling
+
+	sampleMu sync.Mutex
+	counts   map[string]*sampleCount
+	dropped  int64
+}
+
+type sampleCount struct {
+	start time.Time
+	n     int
+}
+
+var defaultCore = newLogCore()
+
+func newLogCore() *logCore {
+	return &logCore{
+		level:     LevelInfo,
+		overrides: map[string]Level{},
+		cache:     map[string]Level{},
+		sinks:     []Sink{NewWriterSink(os.Stderr, FormatJSON)},
+		counts:    map[string]*sampleCount{},
+	}
+}
+
+func (c *logCore) enabled(component string, level Level) bool {
+	c.mu.RLock()
+	min, ok := c.cache[component]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		min = c.resolve(component)
+		c.cache[component] = min
+		c.mu.Unlock()
+	}
+	return level >= min && level < LevelOff
+}
+
+// resolve picks the most specific override for component. A pattern
+// matches when its dot-separated segments appear in order in the
+// component name, so "guardrails" matches "pipe-server.guardrails" and
+// "pipe-server.guardrails.plugin". Must be called with c.mu held.
+func (c *logCore) resolve(component string) Level {
+	level, best := c.level, 0
+	parts := strings.Split(component, ".")
+	for pattern, l := range c.overrides {
+		pp := strings.Split(pattern, ".")
+		if len(pp) > best && containsSegments(parts, pp) {
+			level, best = l, len(pp)
+		}
+	}
+	return level
+}
+
+func containsSegments(parts, pattern []string) bool {
+	for i := 0; i+len(pattern) <= len(parts); i++ {
+		match := true
+		for j := range pattern {
+			if parts[i+j] != pattern[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *logCore) sample(component, msg string) bool {
+	c.mu.RLock()
+	s := c.sampling
+	c.mu.RUnlock()
+	if s == nil || s.Initial <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	key := component + "\xff" + msg
+	c.sampleMu.Lock()
+	defer c.sampleMu.Unlock()
+	sc, ok := c.counts[key]
+	if !ok || now.Sub(sc.start) >= s.Tick {
+		if len(c.counts) > 10000 {
+			c.counts = map[string]*sampleCount{}
+		}
+		sc = &sampleCount{start: now}
+		c.counts[key] = sc
+	}
+	sc.n++
+	if sc.n <= s.Initial || (s.Thereafter > 0 && (sc.n-s.Initial)%s.Thereafter == 0) {
+		return true
+	}
+	c.dropped++
+	return false
+}
+
+func (c *logCore) write(e LogEntry) {
+	c.mu.RLock()
+	sinks := c.sinks
+	c.mu.RUnlock()
+	for _, s := range sinks {
+		if err := s.Write(e); err != nil {
+			fmt.Fprintf(os.Stderr, "log sink failed: %v\n", err)
+		}
+	}
+}
+
+// SetLogLevel sets the level for components without an override.
+func SetLogLevel(level Level) {
+	c := defaultCore
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.level = level
+	c.cache = map[string]Level{}
+}
+
+// SetLogLevels applies a spec such as "info,guardrails=debug,store=warn".
+// A bare level sets the default; component=level pairs add or replace
+// overrides, and component=default removes one.
+func SetLogLevels(spec string) error {
+	def, overrides, remove, err := parseLevelSpec(spec)
+	if err != nil {
+		return err
+	}
+	c := defaultCore
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if def != nil {
+		c.level = *def
+	}
+	for k, v := range overrides {
+		c.overrides[k] = v
+	}
+	for _, k := range remove {
+		delete(c.overrides, k)
+	}
+	c.cache = map[string]Level{}
+	return nil
+}
+
+func parseLevelSpec(spec string) (def *Level, overrides map[string]Level, remove []string, err error) {
+	overrides = map[string]Level{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		component, value, found := strings.Cut(item, "=")
+		if !found {
+			l, err := ParseLevel(item)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			def = &l
+			continue
+		}
+		component = strings.TrimSpace(component)
+		if component == "" {
+			return nil, nil, nil, fmt.Errorf("missing component in %q", item)
+		}
+		if strings.TrimSpace(value) == "default" {
+			remove = append(remove, component)
+			continue
+		}
+		l, err := ParseLevel(value)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: %w", component, err)
+		}
+		overrides[component] = l
+	}
+	return def, overrides, remove, nil
+}
+
+// LogLevels returns the default level and the overrides as a spec that
+// SetLogLevels accepts.
+func LogLevels() (def Level, overrides map[string]Level) {
+	c := defaultCore
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	overrides = make(map[string]Level, len(c.overrides))
+	for k, v := range c.overrides {
+		overrides[k] = v
+	}
+	return c.level, overrides
+}
+
+// FormatLogLevels renders levels like the spec SetLogLevels takes.
+func FormatLogLevels(def Level, overrides map[string]Level) string {
+	parts := []string{strings.ToLower(def.String())}
+	keys := make([]string, 0, len(overrides))
+	for k := range overrides {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, k+"="+strings.ToLower(overrides[k].String()))
+	}
+	return strings.Join(parts, ",")
+}
+
+// SetLogSinks replaces where log lines go. With no sinks, logging is off.
+func SetLogSinks(sinks ...Sink) {
+	c := defaultCore
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sinks = sinks
+}
+
+// SetLogSampling enables sampling of Debug and Info lines; nil disables it.
+func SetLogSampling(s *LogSampling) {
+	c := defaultCore
+	c.mu.Lock()
+	if s != nil && s.Tick <= 0 {
+		cp := *s
+		cp.Tick = time.Second
+		s = &cp
+	}
+	c.sampling = s
+	c.mu.Unlock()
+
+	c.sampleMu.Lock()
+	c.counts = map[string]*sampleCount{}
+	c.sampleMu.Unlock()
+}
+
+// SampledLogLines returns how many lines sampling has dropped.
+func SampledLogLines() int64 {
+	c := defaultCore
+	c.sampleMu.Lock()
+	defer c.sampleMu.Unlock()
+	return c.dropped
+}
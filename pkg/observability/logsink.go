@@ -0,0 +1,268 @@
+package observability
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives every log line that passes the level and sampling checks.
+type Sink interface {
+	Write(e LogEntry) error
+}
+
+type LogFormat string
+
+const (
+	FormatJSON LogFormat = "json"
+	FormatText LogFormat = "text"
+)
+
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch LogFormat(strings.ToLower(s)) {
+	case FormatJSON, "":
+		return FormatJSON, nil
+	case FormatText, "console":
+		return FormatText, nil
+	}
+	return FormatJSON, fmt.Errorf("unknown log format %q", s)
+}
+
+// WriterSink formats lines onto an io.Writer.
+type WriterSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format LogFormat
+}
+
+func NewWriterSink(w io.Writer, format LogFormat) *WriterSink {
+	return &WriterSink{w: w, format: format}
+}
+
+func (s *WriterSink) Write(e LogEntry) error {
+	var line []byte
+	if s.format == FormatText {
+		line = formatText(e)
+	} else {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		line = append(data, '\n')
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(line)
+	return err
+}
+
+// Close closes the underlying writer if it is a file or a RotatingFile.
+func (s *WriterSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok && s.w != os.Stderr && s.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
+
+// formatText renders a line for people: time, level, component, message
+// and then the fields as sorted key=value pairs.
+func formatText(e LogEntry) []byte {
+	var b strings.Builder
+	ts := e.Timestamp
+	if t, err := time.Parse(time.RFC3339Nano, e.Timestamp); err == nil {
+		ts = t.Format("2006-01-02T15:04:05.000Z07:00")
+	}
+	fmt.Fprintf(&b, "%s %-5s %s: %s", ts, e.Level, e.Component, e.Message)
+
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := fmt.Sprint(e.Fields[k])
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		b.WriteString(" " + k + "=" + v)
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// RotatingFile is an io.WriteCloser that renames the file to path.1 once
+// it reaches MaxSize bytes, shifting older backups up and deleting any
+// past MaxBackups.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64 // bytes, default 100 MiB
+	MaxBackups int   // default 5
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = 100 << 20
+	}
+	if maxBackups <= 0 {
+		maxBackups = 5
+	}
+	r := &RotatingFile{Path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if r.size > 0 && r.size+int64(len(p)) > r.MaxSize {
+		if rotateErr = r.rotate(); rotateErr != nil {
+			rotateErr = fmt.Errorf("rotate %s: %w", r.Path, rotateErr)
+			if r.f == nil {
+				return 0, rotateErr
+			}
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	// The line was written, but the caller should hear that backups are
+	// not being shifted.
+	return n, rotateErr
+}
+
+// rotate shifts the backups and reopens Path. Backups that cannot be
+// removed or renamed are reported, but Path is reopened regardless so
+// logging goes on; r.f is nil afterwards only if reopening failed.
+func (r *RotatingFile) rotate() error {
+	var errs []error
+	if err := r.f.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	r.f = nil
+	if err := os.Remove(fmt.Sprintf("%s.%d", r.Path, r.MaxBackups)); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	for i := r.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", r.Path, i), fmt.Sprintf("%s.%d", r.Path, i+1)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	if err := os.Rename(r.Path, r.Path+".1"); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	if err := r.open(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// LogConfig is the logging setup of a process.
+type LogConfig struct {
+	Levels     string    // e.g. "info,guardrails=debug,store=warn"
+	Format     LogFormat // json (default) or text
+	File       string    // also write to this file, rotated; stderr only when empty
+	MaxSizeMB  int
+	MaxBackups int
+	Sampling   *LogSampling
+}
+
+// LogConfigFromEnv reads PIPE_LOG_LEVEL, PIPE_LOG_FORMAT, PIPE_LOG_FILE,
+// PIPE_LOG_MAX_SIZE_MB, PIPE_LOG_MAX_BACKUPS and PIPE_LOG_SAMPLING
+// ("initial/thereafter", e.g. "100/100").
+func LogConfigFromEnv() (LogConfig, error) {
+	cfg := LogConfig{
+		Levels: os.Getenv("PIPE_LOG_LEVEL"),
+		File:   os.Getenv("PIPE_LOG_FILE"),
+	}
+	var err error
+	if cfg.Format, err = ParseLogFormat(os.Getenv("PIPE_LOG_FORMAT")); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("PIPE_LOG_MAX_SIZE_MB"); v != "" {
+		if _, err := fmt.Sscan(v, &cfg.MaxSizeMB); err != nil {
+			return cfg, fmt.Errorf("PIPE_LOG_MAX_SIZE_MB: %w", err)
+		}
+	}
+	if v := os.Getenv("PIPE_LOG_MAX_BACKUPS"); v != "" {
+		if _, err := fmt.Sscan(v, &cfg.MaxBackups); err != nil {
+			return cfg, fmt.Errorf("PIPE_LOG_MAX_BACKUPS: %w", err)
+		}
+	}
+	if v := os.Getenv("PIPE_LOG_SAMPLING"); v != "" {
+		s := &LogSampling{Tick: time.Second}
+		if _, err := fmt.Sscanf(v, "%d/%d", &s.Initial, &s.Thereafter); err != nil {
+			return cfg, fmt.Errorf("PIPE_LOG_SAMPLING: want initial/thereafter, got %q", v)
+		}
+		cfg.Sampling = s
+	}
+	return cfg, nil
+}
+
+// ConfigureLogging applies cfg to every logger. The returned function
+// closes the log file, if any.
+func ConfigureLogging(cfg LogConfig) (func() error, error) {
+	if err := SetLogLevels(cfg.Levels); err != nil {
+		return nil, err
+	}
+	sinks := []Sink{NewWriterSink(os.Stderr, cfg.Format)}
+	closeFn := func() error { return nil }
+	if cfg.File != "" {
+		rf, err := NewRotatingFile(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		// Files are read by collectors, so they are always JSON.
+		sinks = append(sinks, NewWriterSink(rf, FormatJSON))
+		closeFn = rf.Close
+	}
+	SetLogSinks(sinks...)
+	SetLogSampling(cfg.Sampling)
+	return closeFn, nil
+}
@@ -0,0 +1,56 @@
+package observability
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe.log")
+	rf, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		if data, _ := os.ReadFile(file); string(data) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), data, want)
+		}
+	}
+}
+
+func TestRotatingFileReportsBackupErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe.log")
+	rf, err := NewRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	// A non-empty directory where the backup goes can be neither removed
+	// nor replaced.
+	if err := os.MkdirAll(filepath.Join(path+".1", "keep"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	rf.Write([]byte("first line\n"))
+	n, err := rf.Write([]byte("second\n"))
+	if err == nil || !strings.Contains(err.Error(), "rotate") {
+		t.Fatalf("rotation error = %v, want it reported", err)
+	}
+	if n != len("second\n") {
+		t.Errorf("wrote %d bytes, want the line written despite the failed rotation", n)
+	}
+	if _, err := rf.Write([]byte("x")); err == nil {
+		t.Error("later writes hide that the file is still not rotating")
+	}
+	if data, _ := os.ReadFile(path); !strings.HasSuffix(string(data), "second\nx") {
+		t.Errorf("log = %q, want lines appended after the failed rotation", data)
+	}
+}
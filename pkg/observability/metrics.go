@@ -1,6 +1,10 @@
 package observability
 
 import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
@@ -41,17 +45,61 @@ func (g *Gauge) Value() int64 {
 	return atomic.LoadInt64(&g.value)
 }
 
+// DefaultBuckets suit latencies recorded in milliseconds.
+var DefaultBuckets = []float64{1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// LinearBuckets returns n upper bounds starting at start, width apart.
+func LinearBuckets(start, width float64, n int) []float64 {
+	b := make([]float64, n)
+	for i := range b {
+		b[i] = start + float64(i)*width
+	}
+	return b
+}
+
+// ExponentialBuckets returns n upper bounds starting at start, each factor
+// times the previous one.
+func ExponentialBuckets(start, factor float64, n int) []float64 {
+	b := make([]float64, n)
+	for i := range b {
+		b[i] = start
+		start *= factor
+	}
+	return b
+}
+
+// Histogram counts observations into fixed buckets, so its memory does not
+// grow with the number of observations. The zero value uses DefaultBuckets.
 type Histogram struct {
 	mu     sync.Mutex
-	values []float64
+	bounds []float64 // sorted upper bounds; +Inf is implicit
+	counts []int64   // len(bounds)+1, not cumulative
 	sum    float64
 	count  int64
 }
 
+func NewHistogram(bounds []float64) *Histogram {
+	h := &Histogram{}
+	h.init(bounds)
+	return h
+}
+
+func (h *Histogram) init(bounds []float64) {
+	if len(bounds) == 0 {
+		bounds = DefaultBuckets
+	}
+	h.bounds = append([]float64(nil), bounds...)
+	sort.Float64s(h.bounds)
+	h.counts = make([]int64, len(h.bounds)+1)
+}
+
 func (h *Histogram) Observe(v float64) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.values = append(h.values, v)
+	if h.counts == nil {
+		h.init(nil)
+	}
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
 	h.sum += v
 	h.count++
 }
@@ -65,19 +113,145 @@ func (h *Histogram) Snapshot() (count int64, sum float64, avg float64) {
 	return h.count, h.sum, h.sum / float64(h.count)
 }
 
+// Buckets returns the upper bounds and the cumulative count of observations
+// at or below each; the last count, for +Inf, equals the total.
+func (h *Histogram) Buckets() (bounds []float64, cumulative []int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.counts == nil {
+		h.init(nil)
+	}
+	bounds = append([]float64(nil), h.bounds...)
+	cumulative = make([]int64, len(h.counts))
+	var total int64
+	for i, c := range h.counts {
+		total += c
+		cumulative[i] = total
+	}
+	return bounds, cumulative
+}
+
+// Quantile estimates the q-quantile by interpolating linearly inside the
+// first non-empty bucket that reaches it, so Quantile(0) is the lower bound
+// of the lowest occupied bucket. Values in the +Inf bucket report the
+// highest finite bound.
+func (h *Histogram) Quantile(q float64) float64 {
+	bounds, cumulative := h.Buckets()
+	total := cumulative[len(cumulative)-1]
+	if total == 0 {
+		return math.NaN()
+	}
+	rank := math.Min(math.Max(q, 0), 1) * float64(total)
+	for i, c := range cumulative {
+		lower, prev := 0.0, int64(0)
+		if i > 0 {
+			lower, prev = bounds[i-1], cumulative[i-1]
+		}
+		if float64(c) < rank || c == prev {
+			continue
+		}
+		if i == len(bounds) {
+			return bounds[len(bounds)-1]
+		}
+		return lower + (bounds[i]-lower)*(rank-float64(prev))/float64(c-prev)
+	}
+	return bounds[len(bounds)-1]
+}
+
+type LabelPair struct {
+	Name  string
+	Value string
+}
+
+func formatLabels(pairs []LabelPair) string {
+	parts := make([]string, len(pairs))
+	for i, p := range pairs {
+		parts[i] = fmt.Sprintf("%s=%q", p.Name, p.Value)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
 type MetricsRegistry struct {
-	mu         sync.RWMutex
-	counters   map[string]*Counter
-	gauges     map[string]*Gauge
-	histograms map[string]*Histogram
+	mu            sync.RWMutex
+	counters      map[string]*Counter
+	counterVecs   map[string]*CounterVec
+	gauges        map[string]*Gauge
+	gaugeVecs     map[string]*GaugeVec
+	histograms    map[string]*Histogram
+	histogramVecs map[string]*HistogramVec
+	summaries     map[string]*Summary
+	summaryVecs   map[string]*SummaryVec
+	help          map[string]string
+	vecLimit      int
+
+	// Names registered so far by exposition family, and the registrations
+	// refused because their family was taken; see claim.
+	owners    map[string]registration
+	conflicts map[registration]registration
+}
+
+type registration struct {
+	name string
+	kind string // counter, counterVec, gauge, ... as registered
 }
 
 func NewMetricsRegistry() *MetricsRegistry {
 	return &MetricsRegistry{
-		counters:   make(map[string]*Counter),
-		gauges:     make(map[string]*Gauge),
-		histograms: make(map[string]*Histogram),
+		counters:      make(map[string]*Counter),
+		counterVecs:   make(map[string]*CounterVec),
+		gauges:        make(map[string]*Gauge),
+		gaugeVecs:     make(map[string]*GaugeVec),
+		histograms:    make(map[string]*Histogram),
+		histogramVecs: make(map[string]*HistogramVec),
+		summaries:     make(map[string]*Summary),
+		summaryVecs:   make(map[string]*SummaryVec),
+		help:          make(map[string]string),
+		vecLimit:      DefaultCardinalityLimit,
+		owners:        make(map[string]registration),
+		conflicts:     make(map[registration]registration),
+	}
+}
+
+// claim records a new registration under its exposition family. Distinct
+// registry names can map to one family, such as "x.total" and "x" for
+// counters, as can one name registered as two types. The first
+// registration keeps the family; later ones still work but are not
+// exported, and are reported by Conflicts. Must be called with r.mu held.
+func (r *MetricsRegistry) claim(name, kind string) {
+	reg := registration{name: name, kind: kind}
+	family := familyName(name, kind)
+	if owner, ok := r.owners[family]; ok && owner != reg {
+		r.conflicts[reg] = owner
+		return
+	}
+	r.owners[family] = reg
+}
+
+// exported reports whether the registration owns its family.
+func (r *MetricsRegistry) exported(name, kind string) bool {
+	_, refused := r.conflicts[registration{name: name, kind: kind}]
+	return !refused
+}
+
+// Conflicts describes the registrations that are not exported because
+// their family was already taken, sorted.
+func (r *MetricsRegistry) Conflicts() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, 0, len(r.conflicts))
+	for reg, owner := range r.conflicts {
+		out = append(out, fmt.Sprintf("%s (%s) collides with %s (%s) as %s",
+			reg.name, reg.kind, owner.name, owner.kind, familyName(reg.name, reg.kind)))
 	}
+	sort.Strings(out)
+	return out
+}
+
+// SetHelp sets the HELP text exposed for the metric registered as name.
+func (r *MetricsRegistry) SetHelp(name, help string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.help[name] = help
 }
 
 func (r *MetricsRegistry) Counter(name string) *Counter {
@@ -88,6 +262,7 @@ func (r *MetricsRegistry) Counter(name string) *Counter {
 	}
 	c := &Counter{}
 	r.counters[name] = c
+	r.claim(name, "counter")
 	return c
 }
 
@@ -99,6 +274,7 @@ func (r *MetricsRegistry) Gauge(name string) *Gauge {
 	}
 	g := &Gauge{}
 	r.gauges[name] = g
+	r.claim(name, "gauge")
 	return g
 }
 
@@ -110,11 +286,26 @@ func (r *MetricsRegistry) Histogram(name string) *Histogram {
 	}
 	h := &Histogram{}
 	r.histograms[name] = h
+	r.claim(name, "histogram")
 	return h
 }
 
-func (r *MetricsRegistry) Snapshot() map[string]interface{} {
+// HistogramWithBuckets is Histogram with explicit upper bounds. The bounds
+// only apply when the histogram is created.
+func (r *MetricsRegistry) HistogramWithBuckets(name string, bounds []float64) *Histogram {
 	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.histograms[name]; ok {
+		return h
+	}
+	h := NewHistogram(bounds)
+	r.histograms[name] = h
+	r.claim(name, "histogram")
+	return h
+}
+
+func (r *MetricsRegistry) Snapshot() map[string]interface{} {
+	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	result := make(map[string]interface{})
@@ -122,15 +313,51 @@ func (r *MetricsRegistry) Snapshot() map[string]interface{} {
 	for name, c := range r.counters {
 		result["counter."+name] = c.Value()
 	}
+	for name, v := range r.counterVecs {
+		v.each(func(labels []LabelPair, c *Counter) {
+			result["counter."+name+formatLabels(labels)] = c.Value()
+		})
+	}
 
 	for name, g := range r.gauges {
 		result["gauge."+name] = g.Value()
 	}
+	for name, v := range r.gaugeVecs {
+		v.each(func(labels []LabelPair, g *Gauge) {
+			result["gauge."+name+formatLabels(labels)] = g.Value()
+		})
+	}
 	for name, h := range r.histograms {
 		count, sum, avg := h.Snapshot()
 		result["histogram."+name+".count"] = count
 		result["histogram."+name+".sum"] = sum
 		result["histogram."+name+".avg"] = avg
 	}
+	for name, v := range r.histogramVecs {
+		v.each(func(labels []LabelPair, h *Histogram) {
+			count, sum, avg := h.Snapshot()
+			l := formatLabels(labels)
+			result["histogram."+name+".count"+l] = count
+			result["histogram."+name+".sum"+l] = sum
+			result["histogram."+name+".avg"+l] = avg
+		})
+	}
+	for name, s := range r.summaries {
+		summarySnapshot(result, name, "", s)
+	}
+	for name, v := range r.summaryVecs {
+		v.each(func(labels []LabelPair, s *Summary) {
+			summarySnapshot(result, name, formatLabels(labels), s)
+		})
+	}
 	return result
 }
+
+func summarySnapshot(result map[string]interface{}, name, labels string, s *Summary) {
+	count, sum, quantiles := s.Snapshot()
+	result["summary."+name+".count"+labels] = count
+	result["summary."+name+".sum"+labels] = sum
+	for i, q := range s.Objectives() {
+		result[fmt.Sprintf("summary.%s.p%g%s", name, q*100, labels)] = quantiles[i]
+	}
+}
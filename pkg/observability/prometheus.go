@@ -0,0 +1,307 @@
+package observability
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+type metricFamily struct {
+	name    string // sanitized, without the _total suffix for counters
+	kind    string // counter, gauge or summary
+	help    string
+	samples []metricSample
+}
+
+type metricSample struct {
+	suffix string
+	labels []LabelPair
+	value  float64
+}
+
+// Handler serves the registry for scraping. Clients asking for
+// application/openmetrics-text get OpenMetrics, everyone else the
+// Prometheus text format.
+func (r *MetricsRegistry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		openMetrics := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", openMetricsContentType)
+		} else {
+			w.Header().Set("Content-Type", prometheusContentType)
+		}
+		if req.Method == http.MethodHead {
+			return
+		}
+		if openMetrics {
+			r.WriteOpenMetrics(w)
+		} else {
+			r.WritePrometheus(w)
+		}
+	})
+}
+
+// WritePrometheus writes every metric in the Prometheus text exposition
+// format, version 0.0.4.
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	return r.write(w, false)
+}
+
+// WriteOpenMetrics writes every metric in the OpenMetrics 1.0 text format,
+// terminated by "# EOF".
+func (r *MetricsRegistry) WriteOpenMetrics(w io.Writer) error {
+	return r.write(w, true)
+}
+
+func (r *MetricsRegistry) write(w io.Writer, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.families() {
+		name := f.name
+		if f.kind == "counter" && !openMetrics {
+			name += "_total"
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.kind)
+		for _, s := range f.samples {
+			bw.WriteString(f.name)
+			bw.WriteString(s.suffix)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range s.labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", sanitizeLabelName(l.Name), escapeLabelValue(l.Value))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatFloat(s.value))
+			bw.WriteByte('\n')
+		}
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+// families collects a consistent, sorted view of the registry. Registry
+// names such as "guardrail.checks.total" become "guardrail_checks" with a
+// _total counter sample.
+func (r *MetricsRegistry) families() []metricFamily {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byName := make(map[string]*metricFamily)
+	family := func(registered, kind string) *metricFamily {
+		name := familyName(registered, kind)
+		f, ok := byName[name]
+		if !ok {
+			help := r.help[registered]
+			if help == "" {
+				help = registered
+			}
+			f = &metricFamily{name: name, kind: kind, help: help}
+			byName[name] = f
+		}
+		return f
+	}
+
+	for name, c := range r.counters {
+		if !r.exported(name, "counter") {
+			continue
+		}
+		f := family(name, "counter")
+		f.samples = append(f.samples, metricSample{suffix: "_total", value: float64(c.Value())})
+	}
+	for name, v := range r.counterVecs {
+		if !r.exported(name, "counterVec") {
+			continue
+		}
+		f := family(name, "counter")
+		v.each(func(labels []LabelPair, c *Counter) {
+			f.samples = append(f.samples, metricSample{suffix: "_total", labels: labels, value: float64(c.Value())})
+		})
+	}
+	for name, g := range r.gauges {
+		if !r.exported(name, "gauge") {
+			continue
+		}
+		f := family(name, "gauge")
+		f.samples = append(f.samples, metricSample{value: float64(g.Value())})
+	}
+	for name, v := range r.gaugeVecs {
+		if !r.exported(name, "gaugeVec") {
+			continue
+		}
+		f := family(name, "gauge")
+		v.each(func(labels []LabelPair, g *Gauge) {
+			f.samples = append(f.samples, metricSample{labels: labels, value: float64(g.Value())})
+		})
+	}
+	for name, h := range r.histograms {
+		if !r.exported(name, "histogram") {
+			continue
+		}
+		f := family(name, "histogram")
+		f.samples = append(f.samples, histogramSamples(nil, h)...)
+	}
+	for name, v := range r.histogramVecs {
+		if !r.exported(name, "histogramVec") {
+			continue
+		}
+		f := family(name, "histogram")
+		v.each(func(labels []LabelPair, h *Histogram) {
+			f.samples = append(f.samples, histogramSamples(labels, h)...)
+		})
+	}
+	for name, s := range r.summaries {
+		if !r.exported(name, "summary") {
+			continue
+		}
+		f := family(name, "summary")
+		f.samples = append(f.samples, summarySamples(nil, s)...)
+	}
+	for name, v := range r.summaryVecs {
+		if !r.exported(name, "summaryVec") {
+			continue
+		}
+		f := family(name, "summary")
+		v.each(func(labels []LabelPair, s *Summary) {
+			f.samples = append(f.samples, summarySamples(labels, s)...)
+		})
+	}
+
+	out := make([]metricFamily, 0, len(byName))
+	for _, f := range byName {
+		sort.SliceStable(f.samples, func(i, j int) bool {
+			return seriesKey(f.samples[i].labels) < seriesKey(f.samples[j].labels)
+		})
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// familyName is the exposition family a registration lands in: the
+// sanitized name, without _total for counters.
+func familyName(registered, kind string) string {
+	name := sanitizeMetricName(registered)
+	if kind == "counter" || kind == "counterVec" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	return name
+}
+
+// seriesKey orders samples by series while keeping the bucket and quantile
+// samples of one series together and in order.
+func seriesKey(labels []LabelPair) string {
+	n := len(labels)
+	if n > 0 && (labels[n-1].Name == "le" || labels[n-1].Name == "quantile") {
+		labels = labels[:n-1]
+	}
+	return formatLabels(labels)
+}
+
+// histogramSamples returns cumulative _bucket samples with an le label,
+// then _count and _sum.
+func histogramSamples(labels []LabelPair, h *Histogram) []metricSample {
+	bounds, cumulative := h.Buckets()
+	count, sum, _ := h.Snapshot()
+	out := make([]metricSample, 0, len(cumulative)+2)
+	for i, c := range cumulative {
+		le := math.Inf(1)
+		if i < len(bounds) {
+			le = bounds[i]
+		}
+		out = append(out, metricSample{
+			suffix: "_bucket",
+			labels: withLabel(labels, "le", formatFloat(le)),
+			value:  float64(c),
+		})
+	}
+	return append(out,
+		metricSample{suffix: "_count", labels: labels, value: float64(count)},
+		metricSample{suffix: "_sum", labels: labels, value: sum},
+	)
+}
+
+func summarySamples(labels []LabelPair, s *Summary) []metricSample {
+	count, sum, quantiles := s.Snapshot()
+	out := make([]metricSample, 0, len(quantiles)+2)
+	for i, q := range s.Objectives() {
+		out = append(out, metricSample{labels: withLabel(labels, "quantile", formatFloat(q)), value: quantiles[i]})
+	}
+	return append(out,
+		metricSample{suffix: "_count", labels: labels, value: float64(count)},
+		metricSample{suffix: "_sum", labels: labels, value: sum},
+	)
+}
+
+func withLabel(labels []LabelPair, name, value string) []LabelPair {
+	out := make([]LabelPair, 0, len(labels)+1)
+	out = append(out, labels...)
+	return append(out, LabelPair{Name: name, Value: value})
+}
+
+// sanitizeMetricName maps a registry name onto [a-zA-Z_:][a-zA-Z0-9_:]*.
+func sanitizeMetricName(name string) string {
+	return sanitizeName(name, true)
+}
+
+// sanitizeLabelName maps a label name onto [a-zA-Z_][a-zA-Z0-9_]*.
+func sanitizeLabelName(name string) string {
+	return sanitizeName(name, false)
+}
+
+func sanitizeName(name string, allowColon bool) string {
+	var b strings.Builder
+	for i, r := range name {
+		ok := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(i > 0 && r >= '0' && r <= '9') || (allowColon && r == ':')
+		if !ok {
+			if i == 0 && r >= '0' && r <= '9' {
+				b.WriteByte('_')
+				b.WriteRune(r)
+				continue
+			}
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
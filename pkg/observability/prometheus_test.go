@@ -0,0 +1,373 @@
+package observability
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+type parsedSample struct {
+	name   string
+	labels map[string]string
+	key    string // labels as written, without le and quantile
+	value  float64
+}
+
+type parsedFamily struct {
+	name    string
+	kind    string
+	samples []parsedSample
+}
+
+// parseExposition parses the text format strictly: every family has one
+// HELP and one TYPE before its samples, families appear once, samples are
+// named after their family, and no series repeats. Histograms must have
+// increasing le bounds ending in +Inf with cumulative counts matching
+// _count. OpenMetrics output must end with "# EOF".
+func parseExposition(text string, openMetrics bool) (map[string]*parsedFamily, error) {
+	families := make(map[string]*parsedFamily)
+	series := make(map[string]bool)
+	var cur *parsedFamily
+	eof := false
+
+	sc := bufio.NewScanner(strings.NewReader(text))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if eof {
+			return nil, fmt.Errorf("line %d: content after # EOF", n)
+		}
+		switch {
+		case line == "# EOF":
+			if !openMetrics {
+				return nil, fmt.Errorf("line %d: # EOF in Prometheus format", n)
+			}
+			eof = true
+		case strings.HasPrefix(line, "# HELP "):
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "# HELP "), " ")
+			if !openMetrics {
+				name = strings.TrimSuffix(name, "_total")
+			}
+			if _, dup := families[name]; dup {
+				return nil, fmt.Errorf("line %d: family %s repeated", n, name)
+			}
+			cur = &parsedFamily{name: name}
+			families[name] = cur
+		case strings.HasPrefix(line, "# TYPE "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# TYPE "))
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: malformed TYPE", n)
+			}
+			name := fields[0]
+			if fields[1] == "counter" {
+				if openMetrics == strings.HasSuffix(name, "_total") {
+					return nil, fmt.Errorf("line %d: counter family %s", n, name)
+				}
+				name = strings.TrimSuffix(name, "_total")
+			}
+			if cur == nil || cur.name != name || cur.kind != "" {
+				return nil, fmt.Errorf("line %d: TYPE %s without its HELP", n, name)
+			}
+			switch fields[1] {
+			case "counter", "gauge", "histogram", "summary":
+				cur.kind = fields[1]
+			default:
+				return nil, fmt.Errorf("line %d: unknown type %s", n, fields[1])
+			}
+		case strings.HasPrefix(line, "#"):
+			return nil, fmt.Errorf("line %d: unexpected comment %q", n, line)
+		default:
+			if cur == nil || cur.kind == "" {
+				return nil, fmt.Errorf("line %d: sample before TYPE", n)
+			}
+			s, err := parseSample(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			if !sampleBelongs(cur, s) {
+				return nil, fmt.Errorf("line %d: sample %s in %s family %s", n, s.name, cur.kind, cur.name)
+			}
+			id := s.name + "{" + s.key + "}" + s.labels["le"] + "/" + s.labels["quantile"]
+			if series[id] {
+				return nil, fmt.Errorf("line %d: series %s repeated", n, id)
+			}
+			series[id] = true
+			cur.samples = append(cur.samples, s)
+		}
+	}
+	if openMetrics && !eof {
+		return nil, fmt.Errorf("missing # EOF")
+	}
+	for _, f := range families {
+		if f.kind == "histogram" {
+			if err := checkBuckets(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return families, nil
+}
+
+func sampleBelongs(f *parsedFamily, s parsedSample) bool {
+	suffix, ok := strings.CutPrefix(s.name, f.name)
+	if !ok {
+		return false
+	}
+	_, le := s.labels["le"]
+	_, quantile := s.labels["quantile"]
+	switch f.kind {
+	case "counter":
+		return suffix == "_total"
+	case "gauge":
+		return suffix == ""
+	case "histogram":
+		return (suffix == "_bucket") == le && (suffix == "_bucket" || suffix == "_count" || suffix == "_sum")
+	case "summary":
+		return (suffix == "") == quantile && (suffix == "" || suffix == "_count" || suffix == "_sum")
+	}
+	return false
+}
+
+func parseSample(line string) (parsedSample, error) {
+	s := parsedSample{labels: make(map[string]string)}
+	i := strings.IndexAny(line, "{ ")
+	if i < 0 {
+		return s, fmt.Errorf("no value in %q", line)
+	}
+	s.name = line[:i]
+	if !metricNameRE.MatchString(s.name) {
+		return s, fmt.Errorf("invalid metric name %q", s.name)
+	}
+	rest := line[i:]
+	var key []string
+	if rest[0] == '{' {
+		rest = rest[1:]
+		for !strings.HasPrefix(rest, "}") {
+			eq := strings.Index(rest, `="`)
+			if eq < 0 {
+				return s, fmt.Errorf("malformed labels in %q", line)
+			}
+			name := rest[:eq]
+			if !labelNameRE.MatchString(name) {
+				return s, fmt.Errorf("invalid label name %q", name)
+			}
+			if _, dup := s.labels[name]; dup {
+				return s, fmt.Errorf("label %s repeated", name)
+			}
+			var value strings.Builder
+			j := eq + 2
+			for ; j < len(rest) && rest[j] != '"'; j++ {
+				if rest[j] != '\\' {
+					value.WriteByte(rest[j])
+					continue
+				}
+				j++
+				if j == len(rest) {
+					break
+				}
+				switch rest[j] {
+				case '\\', '"':
+					value.WriteByte(rest[j])
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					return s, fmt.Errorf("invalid escape \\%c", rest[j])
+				}
+			}
+			if j >= len(rest) {
+				return s, fmt.Errorf("unterminated label value in %q", line)
+			}
+			s.labels[name] = value.String()
+			if name != "le" && name != "quantile" {
+				key = append(key, rest[:j+1])
+			}
+			rest = rest[j+1:]
+			if strings.HasPrefix(rest, ",") {
+				rest = rest[1:]
+			} else if !strings.HasPrefix(rest, "}") {
+				return s, fmt.Errorf("malformed labels in %q", line)
+			}
+		}
+		rest = rest[1:]
+	}
+	s.key = strings.Join(key, ",")
+	value, ok := strings.CutPrefix(rest, " ")
+	if !ok || strings.Contains(value, " ") {
+		return s, fmt.Errorf("malformed value in %q", line)
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid value %q", value)
+	}
+	s.value = v
+	return s, nil
+}
+
+func checkBuckets(f *parsedFamily) error {
+	type series struct {
+		last, prev float64
+		count      float64
+		inf, seen  bool
+	}
+	bySeries := make(map[string]*series)
+	get := func(key string) *series {
+		if bySeries[key] == nil {
+			bySeries[key] = &series{prev: math.Inf(-1)}
+		}
+		return bySeries[key]
+	}
+	for _, s := range f.samples {
+		ser := get(s.key)
+		switch s.name {
+		case f.name + "_bucket":
+			le, err := strconv.ParseFloat(s.labels["le"], 64)
+			if err != nil || le <= ser.prev || ser.inf {
+				return fmt.Errorf("%s{%s}: le %q out of order", f.name, s.key, s.labels["le"])
+			}
+			if s.value < ser.last {
+				return fmt.Errorf("%s{%s}: buckets not cumulative", f.name, s.key)
+			}
+			ser.prev, ser.last, ser.inf = le, s.value, math.IsInf(le, 1)
+		case f.name + "_count":
+			ser.count, ser.seen = s.value, true
+		}
+	}
+	for key, ser := range bySeries {
+		if !ser.inf || !ser.seen || ser.last != ser.count {
+			return fmt.Errorf("%s{%s}: +Inf bucket missing or not equal to _count", f.name, key)
+		}
+	}
+	return nil
+}
+
+func populatedRegistry() *MetricsRegistry {
+	r := NewMetricsRegistry()
+	r.SetHelp("executions.total", "Executions started.\nBy namespace.")
+	r.Counter("executions.total").Add(3)
+	r.CounterVec("guardrail.violations", "guardrail", "agent").With(map[string]string{"guardrail": "pii", "agent": `say "hi"\n`}).Inc()
+	r.Gauge("workers.busy").Set(2)
+	r.GaugeVec("queue.depth", "namespace").With(map[string]string{"namespace": "default"}).Set(4)
+	h := r.HistogramWithBuckets("step.latency.seconds", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(5)
+	r.HistogramVecWithBuckets("guardrail.latency.seconds", []float64{0.01}, "guardrail").With(map[string]string{"guardrail": "pii"}).Observe(0.001)
+	r.Summary("execution.duration.seconds").Observe(1.5)
+	r.SummaryVec("model.latency.seconds", SummaryOpts{}, "model").With(map[string]string{"model": "gpt"}).Observe(0.2)
+	return r
+}
+
+func TestExpositionParsesStrictly(t *testing.T) {
+	want := map[string]string{
+		"executions":                 "counter",
+		"guardrail_violations":       "counter",
+		"workers_busy":               "gauge",
+		"queue_depth":                "gauge",
+		"step_latency_seconds":       "histogram",
+		"guardrail_latency_seconds":  "histogram",
+		"execution_duration_seconds": "summary",
+		"model_latency_seconds":      "summary",
+	}
+	for _, openMetrics := range []bool{false, true} {
+		var b strings.Builder
+		r := populatedRegistry()
+		if openMetrics {
+			r.WriteOpenMetrics(&b)
+		} else {
+			r.WritePrometheus(&b)
+		}
+		families, err := parseExposition(b.String(), openMetrics)
+		if err != nil {
+			t.Fatalf("openMetrics=%v: %v\n%s", openMetrics, err, b.String())
+		}
+		if len(families) != len(want) {
+			t.Errorf("openMetrics=%v: got %d families, want %d", openMetrics, len(families), len(want))
+		}
+		for name, kind := range want {
+			if f := families[name]; f == nil || f.kind != kind {
+				t.Errorf("openMetrics=%v: family %s missing or not a %s", openMetrics, name, kind)
+			}
+		}
+		v := families["guardrail_violations"].samples[0]
+		if v.labels["agent"] != `say "hi"\n` {
+			t.Errorf("label value round-tripped as %q", v.labels["agent"])
+		}
+	}
+}
+
+func TestCollidingRegistrationsAreNotExported(t *testing.T) {
+	r := NewMetricsRegistry()
+	r.CounterVec("guardrail.violations", "guardrail").With(map[string]string{"guardrail": "pii"}).Add(2)
+	r.Counter("guardrail.violations.total").Add(2)
+	r.Gauge("queue.depth").Set(1)
+	r.Histogram("queue.depth").Observe(1)
+
+	conflicts := r.Conflicts()
+	if len(conflicts) != 2 {
+		t.Fatalf("conflicts = %q, want 2", conflicts)
+	}
+
+	var b strings.Builder
+	r.WritePrometheus(&b)
+	families, err := parseExposition(b.String(), false)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, b.String())
+	}
+	var total float64
+	for _, s := range families["guardrail_violations"].samples {
+		total += s.value
+	}
+	if total != 2 {
+		t.Errorf("sum(guardrail_violations_total) = %v, want 2", total)
+	}
+	if f := families["queue_depth"]; f.kind != "gauge" || len(f.samples) != 1 {
+		t.Errorf("queue_depth exported as %s with %d samples", f.kind, len(f.samples))
+	}
+
+	// Registering the same name and type again is a lookup, not a conflict.
+	r.Counter("guardrail.violations.total")
+	if n := len(r.Conflicts()); n != 2 {
+		t.Errorf("conflicts grew to %d on a repeated registration", n)
+	}
+}
+
+func TestHandlerNegotiatesFormat(t *testing.T) {
+	srv := httptest.NewServer(populatedRegistry().Handler())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+	}{
+		{"", prometheusContentType},
+		{"application/openmetrics-text; version=1.0.0", openMetricsContentType},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.Header.Set("Accept", tc.accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			b.WriteString(sc.Text() + "\n")
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Content-Type"); got != tc.contentType {
+			t.Errorf("Accept %q: Content-Type = %q", tc.accept, got)
+		}
+		if _, err := parseExposition(b.String(), tc.contentType == openMetricsContentType); err != nil {
+			t.Errorf("Accept %q: %v", tc.accept, err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package observability
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID    string
+	SpanID     string
+	Sampled    bool
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+// ParseTraceparent parses a W3C traceparent header such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(h string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, fmt.Errorf("traceparent: expected 4 fields, got %d", len(parts))
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || !isHex(version) || version == "ff" {
+		return SpanContext{}, fmt.Errorf("traceparent: invalid version %q", version)
+	}
+	if version == "00" && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("traceparent: version 00 has exactly 4 fields")
+	}
+	if len(traceID) != 32 || !isHex(traceID) || traceID == strings.Repeat("0", 32) {
+		return SpanContext{}, fmt.Errorf("traceparent: invalid trace id %q", traceID)
+	}
+	if len(spanID) != 16 || !isHex(spanID) || spanID == strings.Repeat("0", 16) {
+		return SpanContext{}, fmt.Errorf("traceparent: invalid parent id %q", spanID)
+	}
+	if len(flags) != 2 || !isHex(flags) {
+		return SpanContext{}, fmt.Errorf("traceparent: invalid flags %q", flags)
+	}
+	b, _ := hex.DecodeString(flags)
+	return SpanContext{TraceID: traceID, SpanID: spanID, Sampled: b[0]&1 == 1}, nil
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-" + flags
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// SpanContext returns the propagation context of the span. A span is
+// sampled unless it continues a parent that was not.
+func (s *Span) SpanContext() SpanContext {
+	return SpanContext{TraceID: s.TraceID, SpanID: s.SpanID, Sampled: !s.unsampled, TraceState: s.traceState}
+}
+
+type remoteContextKey struct{}
+
+// ContextWithRemoteSpanContext marks sc as the parent for the next span
+// started from ctx, e.g. one received in an incoming request.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the local span's context if there is one,
+// otherwise the remote parent's.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext(), true
+	}
+	sc, ok := ctx.Value(remoteContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// ContextWithTraceparent sets a stored traceparent, such as one saved with
+// queued work, as the remote parent. Invalid values leave
+// ctx unchanged.
+func ContextWithTraceparent(ctx context.Context, traceparent, tracestate string) context.Context {
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	sc.TraceState = tracestate
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Extract reads traceparent and tracestate from h. Invalid headers are
+// ignored, as the specification requires, and a new trace is started.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		return ctx
+	}
+	sc.TraceState = strings.Join(h.Values(TracestateHeader), ",")
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Inject writes the traceparent and tracestate of the current span in ctx
+// into h.
+func Inject(ctx context.Context, h http.Header) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// Transport is an http.RoundTripper that records a client span for each
+// request and propagates it to the server via traceparent.
+type Transport struct {
+	Base   http.RoundTripper // http.DefaultTransport when nil
+	Tracer *Tracer           // when nil, the tracer of the span in the request context
+}
+
+func NewTransport(base http.RoundTripper, tracer *Tracer) *Transport {
+	return &Transport{Base: base, Tracer: tracer}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+	tracer := t.Tracer
+	if current := SpanFromContext(ctx); tracer == nil && current != nil {
+		tracer = current.tracer
+	}
+	var span *Span
+	if tracer != nil {
+		ctx, span = tracer.Start(ctx, "HTTP "+req.Method)
+		span.SetKind(SpanKindClient)
+		span.SetTag("http.method", req.Method)
+		span.SetTag("http.url", req.URL.Redacted())
+		span.SetTag("server.address", req.URL.Host)
+	}
+
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+
+	resp, err := base.RoundTrip(req)
+	if span != nil {
+		switch {
+		case err != nil:
+			span.RecordError(err)
+		case resp.StatusCode >= 500:
+			span.SetTag("http.status_code", fmt.Sprint(resp.StatusCode))
+			span.SetStatus(SpanStatusError, resp.Status)
+		default:
+			span.SetTag("http.status_code", fmt.Sprint(resp.StatusCode))
+		}
+		span.End()
+	}
+	return resp, err
+}
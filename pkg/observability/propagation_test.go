@@ -0,0 +1,97 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		valid  bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+	} {
+		_, err := ParseTraceparent(tc.header)
+		if (err == nil) != tc.valid {
+			t.Errorf("ParseTraceparent(%q) error = %v, want valid=%v", tc.header, err, tc.valid)
+		}
+	}
+}
+
+func TestTraceContextRoundTrip(t *testing.T) {
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tracer := NewTracer(NewLogger("test"))
+
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	// An incoming request's context is continued by a span, and the span
+	// is propagated to the next hop through a traced client.
+	in := http.Header{}
+	in.Set(TraceparentHeader, parent)
+	in.Add(TracestateHeader, "vendor=a")
+	in.Add(TracestateHeader, "other=b")
+	ctx, span := tracer.Start(Extract(context.Background(), in), "handle")
+
+	client := &http.Client{Transport: NewTransport(nil, nil)}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	span.End()
+
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentID != "00f067aa0ba902b7" {
+		t.Fatalf("span %s/%s did not continue the remote parent", span.TraceID, span.ParentID)
+	}
+	out, err := ParseTraceparent(received.Get(TraceparentHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.TraceID != span.TraceID || out.SpanID == span.SpanID || out.SpanID == "00f067aa0ba902b7" || !out.Sampled {
+		t.Errorf("propagated %+v; want the trace of span %s with the client span as parent", out, span.SpanID)
+	}
+	if got := received.Get(TracestateHeader); got != "vendor=a,other=b" {
+		t.Errorf("tracestate = %q", got)
+	}
+
+	// A stored traceparent resumes the same trace.
+	stored := span.SpanContext().Traceparent()
+	_, resumed := tracer.Start(ContextWithTraceparent(context.Background(), stored, ""), "resume")
+	if resumed.TraceID != span.TraceID || resumed.ParentID != span.SpanID {
+		t.Errorf("resumed span %s/%s, want parent %s/%s", resumed.TraceID, resumed.ParentID, span.TraceID, span.SpanID)
+	}
+}
+
+func TestUnsampledParentIsPropagated(t *testing.T) {
+	tracer := NewTracer(NewLogger("test"))
+	in := http.Header{}
+	in.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span := tracer.Start(Extract(context.Background(), in), "handle")
+	_, child := tracer.Start(ctx, "child")
+
+	out := http.Header{}
+	Inject(ContextWithSpan(context.Background(), child), out)
+	if got := out.Get(TraceparentHeader); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-"+child.SpanID+"-00" {
+		t.Errorf("traceparent = %q, want the unsampled flag of %s's parent", got, span.SpanID)
+	}
+
+	_, root := tracer.Start(context.Background(), "root")
+	if !root.SpanContext().Sampled {
+		t.Error("new trace root is not sampled")
+	}
+}
@@ -0,0 +1,179 @@
+package observability
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+var DefaultObjectives = []float64{0.5, 0.9, 0.99}
+
+type SummaryOpts struct {
+	Objectives []float64     // quantiles to report, default DefaultObjectives
+	MaxAge     time.Duration // sliding window, default 10m
+	AgeBuckets int           // window is rotated in this many steps, default 5
+	SampleSize int           // reservoir size per age bucket, default 1000
+}
+
+// Summary reports quantiles over a sliding window in constant memory. The
+// window is split into AgeBuckets sub-windows, each keeping a uniform
+// reservoir sample of at most SampleSize observations; the oldest
+// sub-window is dropped as time moves on. Sum and count cover the whole
+// lifetime, as Prometheus expects.
+type Summary struct {
+	mu      sync.Mutex
+	opts    SummaryOpts
+	buckets []reservoir
+	head    int
+	headEnd time.Time
+	sum     float64
+	count   int64
+	now     func() time.Time
+	rng     *rand.Rand
+}
+
+type reservoir struct {
+	values []float64
+	seen   int64
+}
+
+func NewSummary(opts SummaryOpts) *Summary {
+	if len(opts.Objectives) == 0 {
+		opts.Objectives = DefaultObjectives
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 10 * time.Minute
+	}
+	if opts.AgeBuckets <= 0 {
+		opts.AgeBuckets = 5
+	}
+	if opts.SampleSize <= 0 {
+		opts.SampleSize = 1000
+	}
+	s := &Summary{
+		opts:    opts,
+		buckets: make([]reservoir, opts.AgeBuckets),
+		now:     time.Now,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	s.headEnd = s.now().Add(s.step())
+	return s
+}
+
+func (s *Summary) step() time.Duration {
+	return s.opts.MaxAge / time.Duration(s.opts.AgeBuckets)
+}
+
+// rotate advances the head past expired sub-windows. Must be called with
+// s.mu held.
+func (s *Summary) rotate(now time.Time) {
+	for i := 0; !now.Before(s.headEnd); i++ {
+		if i == len(s.buckets) {
+			// Idle for longer than the whole window: start over.
+			s.headEnd = now.Add(s.step())
+			return
+		}
+		s.head = (s.head + 1) % len(s.buckets)
+		s.buckets[s.head] = reservoir{values: s.buckets[s.head].values[:0]}
+		s.headEnd = s.headEnd.Add(s.step())
+	}
+}
+
+func (s *Summary) Observe(v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotate(s.now())
+	s.sum += v
+	s.count++
+
+	b := &s.buckets[s.head]
+	b.seen++
+	if len(b.values) < s.opts.SampleSize {
+		b.values = append(b.values, v)
+	} else if j := s.rng.Int63n(b.seen); j < int64(s.opts.SampleSize) {
+		b.values[j] = v
+	}
+}
+
+// Quantile returns the q-quantile of the observations in the window, or
+// NaN when the window is empty. Each sample is weighted by how many
+// observations it stands for in its sub-window.
+func (s *Summary) Quantile(q float64) float64 {
+	return s.Quantiles([]float64{q})[0]
+}
+
+func (s *Summary) Quantiles(qs []float64) []float64 {
+	s.mu.Lock()
+	s.rotate(s.now())
+	type weighted struct{ v, w float64 }
+	var samples []weighted
+	var total float64
+	for _, b := range s.buckets {
+		if len(b.values) == 0 {
+			continue
+		}
+		w := float64(b.seen) / float64(len(b.values))
+		for _, v := range b.values {
+			samples = append(samples, weighted{v, w})
+		}
+		total += float64(b.seen)
+	}
+	s.mu.Unlock()
+
+	out := make([]float64, len(qs))
+	if len(samples) == 0 {
+		for i := range out {
+			out[i] = math.NaN()
+		}
+		return out
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].v < samples[j].v })
+	for i, q := range qs {
+		rank := q * total
+		var acc float64
+		out[i] = samples[len(samples)-1].v
+		for _, smp := range samples {
+			acc += smp.w
+			if acc >= rank {
+				out[i] = smp.v
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Objectives returns the quantiles this summary reports.
+func (s *Summary) Objectives() []float64 {
+	return s.opts.Objectives
+}
+
+// Snapshot returns the lifetime count and sum and the objective quantiles
+// over the current window.
+func (s *Summary) Snapshot() (count int64, sum float64, quantiles []float64) {
+	quantiles = s.Quantiles(s.opts.Objectives)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count, s.sum, quantiles
+}
+
+// Summary returns the summary registered under name with default options.
+func (r *MetricsRegistry) Summary(name string) *Summary {
+	return r.SummaryWithOpts(name, SummaryOpts{})
+}
+
+// SummaryWithOpts is Summary with explicit options. The options only apply
+// when the summary is created.
+func (r *MetricsRegistry) SummaryWithOpts(name string, opts SummaryOpts) *Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.summaries[name]; ok {
+		return s
+	}
+	s := NewSummary(opts)
+	r.summaries[name] = s
+	r.claim(name, "summary")
+	return s
+}
@@ -1,56 +1,267 @@
 package observability
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
 	"time"
+)
+
+// AttrExecutionID tags spans with the execution they belong to. Child
+// spans started with Tracer.Start inherit it.
+const AttrExecutionID = "execution.id"
+
+// Span kinds, as in OpenTelemetry. Spans are internal unless SetKind says
+// otherwise.
+const (
+	SpanKindInternal = "internal"
+	SpanKindServer   = "server"
+	SpanKindClient   = "client"
+	SpanKindProducer = "producer"
+	SpanKindConsumer = "consumer"
+)
 
-	"github.com/google/uuid"
+const (
+	SpanStatusUnset = "unset"
+	SpanStatusOK    = "ok"
+	SpanStatusError = "error"
 )
 
 type Span struct {
-	TraceID   string            `json:"traceID"`
-	SpanID    string            `json:"spanID"`
-	ParentID  string            `json:"parentID,omitempty"`
-	Operation string            `json:"operation"`
-	StartTime time.Time         `json:"startTime"`
-	EndTime   time.Time         `json:"endTime,omitempty"`
-	Duration  time.Duration     `json:"duration,omitempty"`
-	Tags      map[string]string `json:"tags,omitempty"`
-	Status    string            `json:"status"`
-	Events    []SpanEvent       `json:"events,omitempty"`
+	TraceID       string            `json:"traceID"`
+	SpanID        string            `json:"spanID"`
+	ParentID      string            `json:"parentID,omitempty"`
+	Operation     string            `json:"operation"`
+	Kind          string            `json:"kind,omitempty"`
+	StartTime     time.Time         `json:"startTime"`
+	EndTime       time.Time         `json:"endTime,omitempty"`
+	Duration      time.Duration     `json:"duration,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	Status        string            `json:"status"`
+	StatusMessage string            `json:"statusMessage,omitempty"`
+	Events        []SpanEvent       `json:"events,omitempty"`
+
+	mu         sync.Mutex
+	tracer     *Tracer
+	ended      bool
+	traceState string
+	unsampled  bool // the remote parent was not sampled
 }
 
 type SpanEvent struct {
-	Name      string    `json:"name"`
-	Timestamp time.Time `json:"timestamp"`
+	Name       string            `json:"name"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// SetTag sets a span attribute.
+func (s *Span) SetTag(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Tags[key] = value
+}
+
+// SetKind sets the span kind, one of the SpanKind constants.
+func (s *Span) SetKind(kind string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Kind = kind
+}
+
+func (s *Span) AddEvent(name string, attrs map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Events = append(s.Events, SpanEvent{Name: name, Timestamp: time.Now().UTC(), Attributes: attrs})
+}
+
+// SetStatus records the outcome: SpanStatusOK, SpanStatusError or any
+// legacy status string, which is exported as unset.
+func (s *Span) SetStatus(status, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Status = status
+	s.StatusMessage = message
+}
+
+// RecordError marks the span as failed and adds an exception event.
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.AddEvent("exception", map[string]string{"exception.message": err.Error()})
+	s.SetStatus(SpanStatusError, err.Error())
+}
+
+// End finishes the span and hands it to the tracer's processors. Calls
+// after the first are ignored.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now().UTC()
+	s.Duration = s.EndTime.Sub(s.StartTime)
+	if s.Status == "started" {
+		s.Status = SpanStatusUnset
+	}
+	s.mu.Unlock()
+
+	if s.tracer != nil {
+		s.tracer.finish(s)
+	}
+}
+
+// SpanProcessor receives every span once it has ended.
+type SpanProcessor interface {
+	OnEnd(span *Span)
+	Shutdown(ctx context.Context) error
 }
 
 type Tracer struct {
 	logger *Logger
+
+	mu         sync.RWMutex
+	processors []SpanProcessor
 }
 
 func NewTracer(logger *Logger) *Tracer {
 	return &Tracer{logger: logger.With("tracer")}
 }
 
+// RegisterProcessor adds a processor, typically a BatchProcessor wrapping
+// an exporter.
+func (t *Tracer) RegisterProcessor(p SpanProcessor) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.processors = append(t.processors, p)
+}
+
+// Shutdown flushes and stops every processor.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	processors := t.processors
+	t.processors = nil
+	t.mu.Unlock()
+
+	var firstErr error
+	for _, p := range processors {
+		if err := p.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span as the current span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// Start begins a span that is a child of the span in ctx (or of a remote
+// parent extracted from a request), or a new trace root, and returns a
+// context carrying it.
+func (t *Tracer) Start(ctx context.Context, operation string) (context.Context, *Span) {
+	var traceID, parentID string
+	parent, ok := SpanContextFromContext(ctx)
+	if ok {
+		traceID, parentID = parent.TraceID, parent.SpanID
+	}
+	span := t.newSpan(operation, traceID, parentID)
+	span.traceState = parent.TraceState
+	span.unsampled = ok && !parent.Sampled
+	if local := SpanFromContext(ctx); local != nil {
+		local.mu.Lock()
+		if id := local.Tags[AttrExecutionID]; id != "" {
+			span.Tags[AttrExecutionID] = id
+		}
+		local.mu.Unlock()
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// StartSpan begins a root span in the given trace, or a new trace when
+// traceID is empty. Prefer Start, which links parents through the context.
 func (t *Tracer) StartSpan(operation string, traceID string) *Span {
+	return t.newSpan(operation, traceID, "")
+}
+
+func (t *Tracer) newSpan(operation, traceID, parentID string) *Span {
+	traceID = normalizeTraceID(traceID)
 	if traceID == "" {
-		traceID = uuid.New().String()
+		traceID = newTraceID()
 	}
 	span := &Span{
 		TraceID:   traceID,
-		SpanID:    uuid.New().String(),
+		SpanID:    newSpanID(),
+		ParentID:  parentID,
 		Operation: operation,
 		StartTime: time.Now().UTC(),
 		Status:    "started",
 		Tags:      make(map[string]string),
+		tracer:    t,
 	}
-	t.logger.Debug("span started", "traceID", traceID, "spanID", span.SpanID, "op", operation)
+	t.logger.Debug("span started", "traceID", traceID, "spanID", span.SpanID, "parentID", parentID, "op", operation)
 	return span
 }
 
 func (t *Tracer) EndSpan(span *Span, status string) {
-	span.EndTime = time.Now().UTC()
-	span.Duration = span.EndTime.Sub(span.StartTime)
-	span.Status = status
-	t.logger.Debug("span ended", "traceId", span.TraceID, "spanId", span.SpanID, "op", span.Operation, "durationMs", span.Duration.Milliseconds(), "status", status)
+	span.SetStatus(status, "")
+	span.End()
+}
+
+func (t *Tracer) finish(span *Span) {
+	t.logger.Debug("span ended", "traceId", span.TraceID, "spanId", span.SpanID, "op", span.Operation, "durationMs", span.Duration.Milliseconds(), "status", span.Status)
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, p := range t.processors {
+		p.OnEnd(span)
+	}
+}
+
+// newTraceID and newSpanID return W3C trace context identifiers: 16 and 8
+// random bytes, hex encoded and never all zero.
+func newTraceID() string {
+	return randomHex(16)
+}
+
+func newSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	for {
+		rand.Read(b)
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+// normalizeTraceID accepts a W3C trace ID or a UUID, which is the same 16
+// bytes with dashes, and returns the 32 lowercase hex digit form.
+func normalizeTraceID(id string) string {
+	id = strings.ToLower(strings.ReplaceAll(id, "-", ""))
+	if len(id) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(id); err != nil || id == strings.Repeat("0", 32) {
+		return ""
+	}
+	return id
 }
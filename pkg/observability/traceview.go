@@ -0,0 +1,200 @@
+package observability
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+)
+
+// Record returns a copy of the span for storage.
+func (s *Span) Record() models.SpanRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := models.SpanRecord{
+		TraceID:       s.TraceID,
+		SpanID:        s.SpanID,
+		ParentID:      s.ParentID,
+		ExecutionID:   s.Tags[AttrExecutionID],
+		Operation:     s.Operation,
+		StartTime:     s.StartTime,
+		EndTime:       s.EndTime,
+		DurationMs:    float64(s.Duration.Microseconds()) / 1000,
+		Status:        s.Status,
+		StatusMessage: s.StatusMessage,
+	}
+	if len(s.Tags) > 0 {
+		r.Tags = make(map[string]string, len(s.Tags))
+		for k, v := range s.Tags {
+			r.Tags[k] = v
+		}
+	}
+	for _, ev := range s.Events {
+		r.Events = append(r.Events, models.SpanEventRecord{Name: ev.Name, Timestamp: ev.Timestamp, Attributes: ev.Attributes})
+	}
+	return r
+}
+
+// BuildExecutionTrace arranges spans into a tree. Spans whose parent is
+// missing become roots, so a trace continued from a caller still renders.
+func BuildExecutionTrace(executionID string, spans []models.SpanRecord) *models.ExecutionTrace {
+	trace := &models.ExecutionTrace{ExecutionID: executionID, SpanCount: len(spans), Roots: []*models.TraceNode{}}
+	if len(spans) == 0 {
+		return trace
+	}
+
+	nodes := make(map[string]*models.TraceNode, len(spans))
+	var start, end time.Time
+	for i := range spans {
+		sp := spans[i]
+		nodes[sp.SpanID] = &models.TraceNode{SpanRecord: sp}
+		if start.IsZero() || sp.StartTime.Before(start) {
+			start = sp.StartTime
+		}
+		if sp.EndTime.After(end) {
+			end = sp.EndTime
+		}
+	}
+	trace.StartTime = start
+	trace.DurationMs = msBetween(start, end)
+	trace.TraceID = spans[0].TraceID
+
+	for i := range spans {
+		n := nodes[spans[i].SpanID]
+		n.OffsetMs = msBetween(start, n.StartTime)
+		if parent, ok := nodes[n.ParentID]; ok && parent != n {
+			parent.Children = append(parent.Children, n)
+		} else {
+			trace.Roots = append(trace.Roots, n)
+		}
+	}
+
+	var finish func(ns []*models.TraceNode)
+	finish = func(ns []*models.TraceNode) {
+		sort.SliceStable(ns, func(i, j int) bool { return ns[i].StartTime.Before(ns[j].StartTime) })
+		for _, n := range ns {
+			finish(n.Children)
+			n.SelfMs = math.Max(0, n.DurationMs-coveredMs(n.Children))
+		}
+	}
+	finish(trace.Roots)
+	return trace
+}
+
+// coveredMs is the length of the union of the children's intervals, so
+// concurrent children are not counted twice.
+func coveredMs(children []*models.TraceNode) float64 {
+	var total, curStart, curEnd float64
+	open := false
+	for _, c := range children { // sorted by start
+		s, e := c.OffsetMs, c.OffsetMs+c.DurationMs
+		switch {
+		case !open:
+			curStart, curEnd, open = s, e, true
+		case s > curEnd:
+			total += curEnd - curStart
+			curStart, curEnd = s, e
+		case e > curEnd:
+			curEnd = e
+		}
+	}
+	if open {
+		total += curEnd - curStart
+	}
+	return total
+}
+
+func msBetween(a, b time.Time) float64 {
+	return float64(b.Sub(a).Microseconds()) / 1000
+}
+
+// RenderWaterfall writes trace as an indented span list with a timeline
+// bar per span, width characters wide. Failed spans are drawn with '!'.
+func RenderWaterfall(w io.Writer, trace *models.ExecutionTrace, width int) {
+	if width < 10 {
+		width = 10
+	}
+	fmt.Fprintf(w, "execution %s  trace %s  %s  %d spans\n", trace.ExecutionID, trace.TraceID, FormatMs(trace.DurationMs), trace.SpanCount)
+	if len(trace.Roots) == 0 {
+		fmt.Fprintln(w, "(no spans recorded)")
+		return
+	}
+
+	type row struct {
+		label string
+		node  *models.TraceNode
+	}
+	var rows []row
+	var walk func(ns []*models.TraceNode, depth int)
+	walk = func(ns []*models.TraceNode, depth int) {
+		for _, n := range ns {
+			rows = append(rows, row{strings.Repeat("  ", depth) + n.Operation, n})
+			walk(n.Children, depth+1)
+		}
+	}
+	walk(trace.Roots, 0)
+
+	labelWidth := len("OPERATION")
+	for _, r := range rows {
+		if len(r.label) > labelWidth {
+			labelWidth = len(r.label)
+		}
+	}
+	if labelWidth > 48 {
+		labelWidth = 48
+	}
+
+	fmt.Fprintf(w, "%-*s  %9s  %9s  %s\n", labelWidth, "OPERATION", "START", "DURATION", "TIMELINE")
+	for _, r := range rows {
+		label := r.label
+		if len(label) > labelWidth {
+			label = label[:labelWidth-3] + "..."
+		}
+		fmt.Fprintf(w, "%-*s  %9s  %9s  |%s|\n", labelWidth, label,
+			"+"+FormatMs(r.node.OffsetMs), FormatMs(r.node.DurationMs),
+			timelineBar(r.node, trace.DurationMs, width))
+	}
+}
+
+func timelineBar(n *models.TraceNode, totalMs float64, width int) string {
+	from, to := 0, width
+	if totalMs > 0 {
+		from = int(n.OffsetMs / totalMs * float64(width))
+		to = int(math.Ceil((n.OffsetMs + n.DurationMs) / totalMs * float64(width)))
+	}
+	if from >= width {
+		from = width - 1
+	}
+	if to <= from {
+		to = from + 1
+	}
+	if to > width {
+		to = width
+	}
+	fill := "="
+	if n.Status == SpanStatusError {
+		fill = "!"
+	}
+	return strings.Repeat(" ", from) + strings.Repeat(fill, to-from) + strings.Repeat(" ", width-to)
+}
+
+// FormatMs renders a duration in milliseconds compactly, e.g. 850us,
+// 12.4ms or 3.21s.
+func FormatMs(ms float64) string {
+	switch {
+	case ms < 1:
+		return fmt.Sprintf("%.0fus", ms*1000)
+	case ms < 100:
+		return fmt.Sprintf("%.1fms", ms)
+	case ms < 1000:
+		return fmt.Sprintf("%.0fms", ms)
+	case ms < 60000:
+		return fmt.Sprintf("%.2fs", ms/1000)
+	default:
+		return time.Duration(ms * float64(time.Millisecond)).Round(time.Second).String()
+	}
+}
@@ -0,0 +1,343 @@
+package observability
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultCardinalityLimit caps the label sets a vector tracks. Further
+	// label sets share a single series whose values are all OverflowLabelValue.
+	DefaultCardinalityLimit = 1000
+	OverflowLabelValue      = "__overflow__"
+
+	overflowMetric = "metrics.cardinality.overflow.total"
+)
+
+// metricVec holds the series of one labelled family. The typed vectors below
+// wrap it so callers get *Counter, *Gauge or *Histogram back.
+type metricVec struct {
+	name       string
+	labels     []string
+	newMetric  func() interface{}
+	onOverflow func()
+
+	mu     sync.RWMutex
+	limit  int
+	series map[string]*vecSeries
+}
+
+type vecSeries struct {
+	values []string
+	metric interface{}
+}
+
+func newMetricVec(name string, labels []string, limit int, newMetric func() interface{}, onOverflow func()) *metricVec {
+	return &metricVec{
+		name:       name,
+		labels:     append([]string(nil), labels...),
+		newMetric:  newMetric,
+		onOverflow: onOverflow,
+		limit:      limit,
+		series:     make(map[string]*vecSeries),
+	}
+}
+
+func (v *metricVec) key(values []string) ([]string, string) {
+	if len(values) != len(v.labels) {
+		padded := make([]string, len(v.labels))
+		copy(padded, values)
+		values = padded
+	}
+	return values, strings.Join(values, "\xff")
+}
+
+func (v *metricVec) get(values []string) interface{} {
+	values, key := v.key(values)
+
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s.metric
+	}
+
+	v.mu.Lock()
+	if s, ok := v.series[key]; ok {
+		v.mu.Unlock()
+		return s.metric
+	}
+	overflowed := false
+	if v.limit > 0 && len(v.series) >= v.limit {
+		overflowed = true
+		values = make([]string, len(v.labels))
+		for i := range values {
+			values[i] = OverflowLabelValue
+		}
+		values, key = v.key(values)
+	}
+	s, ok = v.series[key]
+	if !ok {
+		s = &vecSeries{values: append([]string(nil), values...), metric: v.newMetric()}
+		v.series[key] = s
+	}
+	v.mu.Unlock()
+
+	// Outside v.mu: the hook takes the registry lock, which exposition
+	// holds while walking vectors.
+	if overflowed && v.onOverflow != nil {
+		v.onOverflow()
+	}
+	return s.metric
+}
+
+func (v *metricVec) valuesOf(labels map[string]string) []string {
+	values := make([]string, len(v.labels))
+	for i, name := range v.labels {
+		values[i] = labels[name]
+	}
+	return values
+}
+
+// SetLimit changes the cardinality limit; 0 disables it. Existing series
+// are kept.
+func (v *metricVec) SetLimit(n int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.limit = n
+}
+
+// Len returns the number of series, including the overflow series.
+func (v *metricVec) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.series)
+}
+
+// DeleteLabelValues removes the series with exactly these label values.
+func (v *metricVec) DeleteLabelValues(values ...string) bool {
+	_, key := v.key(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.series[key]; !ok {
+		return false
+	}
+	delete(v.series, key)
+	return true
+}
+
+// Delete removes the series with exactly these labels.
+func (v *metricVec) Delete(labels map[string]string) bool {
+	return v.DeleteLabelValues(v.valuesOf(labels)...)
+}
+
+// DeletePartialMatch removes every series whose labels include all of the
+// given pairs, e.g. {"agent": "summarizer"} once that agent is deleted. It
+// returns the number of series removed.
+func (v *metricVec) DeletePartialMatch(labels map[string]string) int {
+	idx := make(map[int]string, len(labels))
+	for name, value := range labels {
+		found := false
+		for i, l := range v.labels {
+			if l == name {
+				idx[i] = value
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	n := 0
+	for key, s := range v.series {
+		match := true
+		for i, value := range idx {
+			if s.values[i] != value {
+				match = false
+				break
+			}
+		}
+		if match {
+			delete(v.series, key)
+			n++
+		}
+	}
+	return n
+}
+
+// each calls fn for every series with its label pairs in declaration order.
+func (v *metricVec) each(fn func(labels []LabelPair, metric interface{})) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, s := range v.series {
+		pairs := make([]LabelPair, len(v.labels))
+		for i, name := range v.labels {
+			pairs[i] = LabelPair{Name: name, Value: s.values[i]}
+		}
+		fn(pairs, s.metric)
+	}
+}
+
+// CounterVec is a family of counters sharing a name and partitioned by
+// label values.
+type CounterVec struct {
+	*metricVec
+}
+
+// WithLabelValues returns the counter for the given label values, in the
+// order the labels were declared. Missing values are treated as empty.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.get(values).(*Counter)
+}
+
+func (v *CounterVec) With(labels map[string]string) *Counter {
+	return v.get(v.valuesOf(labels)).(*Counter)
+}
+
+func (v *CounterVec) each(fn func(labels []LabelPair, c *Counter)) {
+	v.metricVec.each(func(labels []LabelPair, m interface{}) { fn(labels, m.(*Counter)) })
+}
+
+type GaugeVec struct {
+	*metricVec
+}
+
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.get(values).(*Gauge)
+}
+
+func (v *GaugeVec) With(labels map[string]string) *Gauge {
+	return v.get(v.valuesOf(labels)).(*Gauge)
+}
+
+func (v *GaugeVec) each(fn func(labels []LabelPair, g *Gauge)) {
+	v.metricVec.each(func(labels []LabelPair, m interface{}) { fn(labels, m.(*Gauge)) })
+}
+
+type HistogramVec struct {
+	*metricVec
+}
+
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.get(values).(*Histogram)
+}
+
+func (v *HistogramVec) With(labels map[string]string) *Histogram {
+	return v.get(v.valuesOf(labels)).(*Histogram)
+}
+
+func (v *HistogramVec) each(fn func(labels []LabelPair, h *Histogram)) {
+	v.metricVec.each(func(labels []LabelPair, m interface{}) { fn(labels, m.(*Histogram)) })
+}
+
+type SummaryVec struct {
+	*metricVec
+}
+
+func (v *SummaryVec) WithLabelValues(values ...string) *Summary {
+	return v.get(values).(*Summary)
+}
+
+func (v *SummaryVec) With(labels map[string]string) *Summary {
+	return v.get(v.valuesOf(labels)).(*Summary)
+}
+
+func (v *SummaryVec) each(fn func(labels []LabelPair, s *Summary)) {
+	v.metricVec.each(func(labels []LabelPair, m interface{}) { fn(labels, m.(*Summary)) })
+}
+
+// CounterVec returns the labelled counter family registered under name,
+// creating it with the given label names on first use.
+func (r *MetricsRegistry) CounterVec(name string, labels ...string) *CounterVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.counterVecs[name]; ok {
+		return v
+	}
+	v := &CounterVec{newMetricVec(name, labels, r.vecLimit, func() interface{} { return &Counter{} }, r.overflowed)}
+	r.counterVecs[name] = v
+	r.claim(name, "counterVec")
+	return v
+}
+
+func (r *MetricsRegistry) GaugeVec(name string, labels ...string) *GaugeVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.gaugeVecs[name]; ok {
+		return v
+	}
+	v := &GaugeVec{newMetricVec(name, labels, r.vecLimit, func() interface{} { return &Gauge{} }, r.overflowed)}
+	r.gaugeVecs[name] = v
+	r.claim(name, "gaugeVec")
+	return v
+}
+
+func (r *MetricsRegistry) HistogramVec(name string, labels ...string) *HistogramVec {
+	return r.HistogramVecWithBuckets(name, nil, labels...)
+}
+
+func (r *MetricsRegistry) HistogramVecWithBuckets(name string, bounds []float64, labels ...string) *HistogramVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.histogramVecs[name]; ok {
+		return v
+	}
+	v := &HistogramVec{newMetricVec(name, labels, r.vecLimit, func() interface{} { return NewHistogram(bounds) }, r.overflowed)}
+	r.histogramVecs[name] = v
+	r.claim(name, "histogramVec")
+	return v
+}
+
+func (r *MetricsRegistry) SummaryVec(name string, opts SummaryOpts, labels ...string) *SummaryVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.summaryVecs[name]; ok {
+		return v
+	}
+	v := &SummaryVec{newMetricVec(name, labels, r.vecLimit, func() interface{} { return NewSummary(opts) }, r.overflowed)}
+	r.summaryVecs[name] = v
+	r.claim(name, "summaryVec")
+	return v
+}
+
+// SetCardinalityLimit sets the limit given to vectors created from now on.
+func (r *MetricsRegistry) SetCardinalityLimit(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.vecLimit = n
+}
+
+// DeleteMatching removes, from every vector, the series whose labels include
+// all of the given pairs. Call it when an agent or namespace is removed so
+// its series stop being exported.
+func (r *MetricsRegistry) DeleteMatching(labels map[string]string) int {
+	r.mu.RLock()
+	vecs := make([]*metricVec, 0, len(r.counterVecs)+len(r.gaugeVecs)+len(r.histogramVecs)+len(r.summaryVecs))
+	for _, v := range r.counterVecs {
+		vecs = append(vecs, v.metricVec)
+	}
+	for _, v := range r.gaugeVecs {
+		vecs = append(vecs, v.metricVec)
+	}
+	for _, v := range r.histogramVecs {
+		vecs = append(vecs, v.metricVec)
+	}
+	for _, v := range r.summaryVecs {
+		vecs = append(vecs, v.metricVec)
+	}
+	r.mu.RUnlock()
+
+	n := 0
+	for _, v := range vecs {
+		n += v.DeletePartialMatch(labels)
+	}
+	return n
+}
+
+func (r *MetricsRegistry) overflowed() {
+	r.Counter(overflowMetric).Inc()
+}
@@ -0,0 +1,313 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// ValidateJSON checks value (as produced by encoding/json) against a JSON
+// Schema. It supports type, properties, required, additionalProperties,
+// items, enum, const, pattern, length and numeric bounds and
+// allOf/anyOf/oneOf. Field holds a JSONPath-like location such as
+// "$.items[2].name". A schema that does not compile is reported as a
+// single error; use Compile to validate many values against one schema.
+func ValidateJSON(schema map[string]interface{}, value interface{}) []ValidationError {
+	s, err := Compile(schema)
+	if err != nil {
+		return []ValidationError{{Field: "$", Message: err.Error()}}
+	}
+	return s.Validate(value)
+}
+
+// Schema is a JSON Schema prepared by Compile.
+type Schema struct {
+	root     map[string]interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// Compile checks a schema once so it can be reused: every pattern is
+// compiled and keywords the validator cannot honour, such as $ref, are
+// rejected instead of being silently ignored.
+func Compile(schema map[string]interface{}) (*Schema, error) {
+	s := &Schema{root: schema, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.compile(schema, "$"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate checks value against the schema; see ValidateJSON.
+func (s *Schema) Validate(value interface{}) []ValidationError {
+	var errs []ValidationError
+	s.validateNode(s.root, value, "$", &errs)
+	return errs
+}
+
+var unsupportedKeywords = []string{"$ref", "$dynamicRef", "$recursiveRef"}
+
+func (s *Schema) compile(schema map[string]interface{}, path string) error {
+	for _, key := range unsupportedKeywords {
+		if _, ok := schema[key]; ok {
+			return fmt.Errorf("%s: %s is not supported, inline the referenced schema", path, key)
+		}
+	}
+	if p, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern %q: %v", path, p, err)
+		}
+		s.patterns[p] = re
+	}
+
+	if props, ok := schema["properties"].(map[string]interface{}); ok {
+		for name, sub := range props {
+			if m, ok := sub.(map[string]interface{}); ok {
+				if err := s.compile(m, childPath(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, key := range []string{"additionalProperties", "items"} {
+		if m, ok := schema[key].(map[string]interface{}); ok {
+			if err := s.compile(m, path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subs, _ := schema[key].([]interface{})
+		for i, sub := range subs {
+			if m, ok := sub.(map[string]interface{}); ok {
+				if err := s.compile(m, fmt.Sprintf("%s.%s[%d]", path, key, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateNode(schema map[string]interface{}, value interface{}, path string, errs *[]ValidationError) {
+	if schema == nil {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, ValidationError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		fail("expected %s, got %s", typeNames(t), jsonType(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", compact(enum))
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		fail("must equal %s", compact(c))
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subs, ok := schema[key].([]interface{})
+		if !ok {
+			continue
+		}
+		matched := 0
+		for _, sub := range subs {
+			if m, ok := sub.(map[string]interface{}); ok {
+				var subErrs []ValidationError
+				s.validateNode(m, value, path, &subErrs)
+				if len(subErrs) == 0 {
+					matched++
+				} else if key == "allOf" {
+					*errs = append(*errs, subErrs...)
+				}
+			}
+		}
+		if key == "anyOf" && matched == 0 {
+			fail("must match at least one schema in anyOf")
+		}
+		if key == "oneOf" && matched != 1 {
+			fail("must match exactly one schema in oneOf, matched %d", matched)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		s.validateObject(schema, v, path, errs)
+	case []interface{}:
+		s.validateArray(schema, v, path, errs)
+	case string:
+		n := float64(len([]rune(v)))
+		if min, ok := number(schema["minLength"]); ok && n < min {
+			fail("length %d is less than minLength %v", int(n), min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && n > max {
+			fail("length %d exceeds maxLength %v", int(n), max)
+		}
+		if p, ok := schema["pattern"].(string); ok && !s.patterns[p].MatchString(v) {
+			fail("does not match pattern %q", p)
+		}
+	case float64:
+		if min, ok := number(schema["minimum"]); ok && v < min {
+			fail("%v is less than minimum %v", v, min)
+		}
+		if max, ok := number(schema["maximum"]); ok && v > max {
+			fail("%v exceeds maximum %v", v, max)
+		}
+		if min, ok := number(schema["exclusiveMinimum"]); ok && v <= min {
+			fail("%v must be greater than %v", v, min)
+		}
+		if max, ok := number(schema["exclusiveMaximum"]); ok && v >= max {
+			fail("%v must be less than %v", v, max)
+		}
+	}
+}
+
+func (s *Schema) validateObject(schema map[string]interface{}, obj map[string]interface{}, path string, errs *[]ValidationError) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := obj[name]; !ok {
+				*errs = append(*errs, ValidationError{Field: childPath(path, name), Message: "required"})
+			}
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if sub, ok := props[k].(map[string]interface{}); ok {
+			s.validateNode(sub, obj[k], childPath(path, k), errs)
+			continue
+		}
+		switch ap := schema["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				*errs = append(*errs, ValidationError{Field: childPath(path, k), Message: "additional property not allowed"})
+			}
+		case map[string]interface{}:
+			s.validateNode(ap, obj[k], childPath(path, k), errs)
+		}
+	}
+}
+
+func (s *Schema) validateArray(schema map[string]interface{}, arr []interface{}, path string, errs *[]ValidationError) {
+	n := float64(len(arr))
+	if min, ok := number(schema["minItems"]); ok && n < min {
+		*errs = append(*errs, ValidationError{Field: path, Message: fmt.Sprintf("has %d items, fewer than minItems %v", len(arr), min)})
+	}
+	if max, ok := number(schema["maxItems"]); ok && n > max {
+		*errs = append(*errs, ValidationError{Field: path, Message: fmt.Sprintf("has %d items, more than maxItems %v", len(arr), max)})
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range arr {
+			s.validateNode(items, item, path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	}
+}
+
+func matchesType(t interface{}, value interface{}) bool {
+	switch tt := t.(type) {
+	case string:
+		return matchesOneType(tt, value)
+	case []interface{}:
+		for _, name := range tt {
+			if s, ok := name.(string); ok && matchesOneType(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesOneType(name string, value interface{}) bool {
+	actual := jsonType(value)
+	if name == "number" && actual == "integer" {
+		return true
+	}
+	return name == actual
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func typeNames(t interface{}) string {
+	if s, ok := t.(string); ok {
+		return s
+	}
+	return compact(t)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func jsonEqual(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compact(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func childPath(path, key string) string {
+	if identifier.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestCompileRejectsRef(t *testing.T) {
+	_, err := Compile(decode(t, `{"type":"object","properties":{"user":{"$ref":"#/$defs/user"}}}`))
+	if err == nil || !strings.Contains(err.Error(), "$ref") || !strings.Contains(err.Error(), "$.user") {
+		t.Fatalf("Compile err = %v, want $ref rejected at $.user", err)
+	}
+	if errs := ValidateJSON(decode(t, `{"$ref":"#/x"}`), map[string]interface{}{}); len(errs) != 1 {
+		t.Fatalf("ValidateJSON with $ref returned %v, want one error", errs)
+	}
+}
+
+func TestCompileRejectsInvalidPattern(t *testing.T) {
+	if _, err := Compile(decode(t, `{"items":{"pattern":"("}}`)); err == nil {
+		t.Fatal("Compile accepted an invalid pattern")
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s, err := Compile(decode(t, `{
+		"type": "object",
+		"required": ["id", "tags"],
+		"properties": {
+			"id": {"type": "string", "pattern": "^[a-z]+-[0-9]+$"},
+			"tags": {"type": "array", "items": {"type": "string", "pattern": "^#"}}
+		},
+		"additionalProperties": false
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		doc    string
+		fields []string
+	}{
+		{`{"id":"abc-1","tags":["#a"]}`, nil},
+		{`{"id":"ABC","tags":["#a","b"],"x":1}`, []string{"$.id", "$.tags[1]", "$.x"}},
+		{`{"tags":[]}`, []string{"$.id"}},
+	}
+	for _, tt := range tests {
+		var v interface{}
+		json.Unmarshal([]byte(tt.doc), &v)
+		errs := s.Validate(v)
+		var fields []string
+		for _, e := range errs {
+			fields = append(fields, e.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+			t.Errorf("Validate(%s) failed fields %v, want %v", tt.doc, fields, tt.fields)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package schema
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/Promptonauts/pipe/pkg/models"
 )
@@ -77,6 +78,8 @@ func ValidationResource(r *models.GenericResource) ValidationResult {
 		errs = append(errs, validatePipelineSpec(r.Spec)...)
 	case models.KindExecution:
 		errs = append(errs, validateExecutionSpec(r.Spec)...)
+	case models.KindSLO:
+		errs = append(errs, validateSLOSpec(r.Spec)...)
 	}
 
 	return ValidationResult{
@@ -133,6 +136,15 @@ func validateToolSpec(spec map[string]interface{}) []ValidationError {
 			errs = append(errs, *e)
 		}
 	}
+	if schemas, ok := spec["schema"].(map[string]interface{}); ok {
+		for _, key := range []string{"input", "output"} {
+			if s, ok := schemas[key].(map[string]interface{}); ok {
+				if _, err := Compile(s); err != nil {
+					errs = append(errs, ValidationError{Field: "spec.schema." + key, Message: err.Error()})
+				}
+			}
+		}
+	}
 	return errs
 }
 
@@ -144,13 +156,41 @@ func validateGuardrailSpec(spec map[string]interface{}) []ValidationError {
 		}
 	}
 	phase, _ := spec["phase"].(string)
-	if phase != "" && phase != "pre" && phase != "post" && phase != "both" {
-		errs = append(errs, ValidationError{Field: "spec.phase", Message: "must be 'pre' , 'post' , or ,both'"})
+	if phase != "" && phase != "pre" && phase != "post" && phase != "both" && phase != "tool" && phase != "all" {
+		errs = append(errs, ValidationError{Field: "spec.phase", Message: "must be 'pre', 'post', 'both', 'tool' or 'all'"})
 	}
 
 	action, _ := spec["action"].(string)
-	if action != "" && action != "block" && action != "warn" && action != "log" {
-		errs = append(errs, ValidationError{Field: "spec.action", Message: "must be 'block', 'warn', or 'log'"})
+	if action != "" && action != "block" && action != "warn" && action != "log" && action != "escalate" {
+		errs = append(errs, ValidationError{Field: "spec.action", Message: "must be 'block', 'warn', 'log' or 'escalate'"})
+	}
+
+	mode, _ := spec["mode"].(string)
+	if mode != "" && mode != "enforce" && mode != "shadow" {
+		errs = append(errs, ValidationError{Field: "spec.mode", Message: "must be 'enforce' or 'shadow'"})
+	}
+
+	if t, _ := spec["timeout"].(string); t != "" {
+		if _, err := time.ParseDuration(t); err != nil {
+			errs = append(errs, ValidationError{Field: "spec.timeout", Message: "must be a duration such as '500ms'"})
+		}
+	}
+
+	policy, _ := spec["failurePolicy"].(string)
+	if policy != "" && policy != "open" && policy != "closed" {
+		errs = append(errs, ValidationError{Field: "spec.failurePolicy", Message: "must be 'open' or 'closed'"})
+	}
+
+	if esc, ok := spec["escalation"].(map[string]interface{}); ok {
+		if t, _ := esc["timeout"].(string); t != "" {
+			if _, err := time.ParseDuration(t); err != nil {
+				errs = append(errs, ValidationError{Field: "spec.escalation.timeout", Message: "must be a duration such as '30m'"})
+			}
+		}
+		d, _ := esc["defaultDecision"].(string)
+		if d != "" && d != "approve" && d != "reject" {
+			errs = append(errs, ValidationError{Field: "spec.escalation.defaultDecision", Message: "must be 'approve' or 'reject'"})
+		}
 	}
 	return errs
 }
@@ -170,3 +210,85 @@ func validateExecutionSpec(spec map[string]interface{}) []ValidationError {
 	}
 	return errs
 }
+
+// isLatencyBucket reports whether d is a bound of the SLO latency
+// histogram, so the share of executions within it can be read exactly.
+func isLatencyBucket(d time.Duration) bool {
+	for _, b := range models.SLOLatencyBuckets {
+		if time.Duration(b)*time.Millisecond == d {
+			return true
+		}
+	}
+	return false
+}
+
+func latencyBucketList() string {
+	bounds := make([]string, len(models.SLOLatencyBuckets))
+	for i, b := range models.SLOLatencyBuckets {
+		bounds[i] = (time.Duration(b) * time.Millisecond).String()
+	}
+	return strings.Join(bounds, ", ")
+}
+
+func validateSLOSpec(spec map[string]interface{}) []ValidationError {
+	var errs []ValidationError
+	agent, _ := spec["agent"].(string)
+	pipeline, _ := spec["pipeline"].(string)
+	if (agent == "") == (pipeline == "") {
+		errs = append(errs, ValidationError{Field: "spec.agent", Message: "exactly one of agent or pipeline is required"})
+	}
+
+	if w, _ := spec["window"].(string); w != "" {
+		if _, err := models.ParseDuration(w); err != nil {
+			errs = append(errs, ValidationError{Field: "spec.window", Message: "must be a duration such as '30d'"})
+		}
+	}
+
+	obj, ok := spec["objective"].(map[string]interface{})
+	if !ok {
+		return append(errs, ValidationError{Field: "spec.objective", Message: "required"})
+	}
+	fraction := func(field string) {
+		v, ok := obj[field].(float64)
+		if !ok || v <= 0 || v >= 1 {
+			errs = append(errs, ValidationError{Field: "spec.objective." + field, Message: "must be a number between 0 and 1, e.g. 0.99"})
+		}
+	}
+	switch obj["type"] {
+	case models.SLOSuccessRatio:
+		fraction("target")
+	case models.SLOLatency:
+		fraction("percentile")
+		t, _ := obj["threshold"].(string)
+		if d, err := time.ParseDuration(t); err != nil || d <= 0 {
+			errs = append(errs, ValidationError{Field: "spec.objective.threshold", Message: "must be a duration such as '2s'"})
+		} else if !isLatencyBucket(d) {
+			errs = append(errs, ValidationError{Field: "spec.objective.threshold", Message: "must be one of the latency buckets: " + latencyBucketList()})
+		}
+	default:
+		errs = append(errs, ValidationError{Field: "spec.objective.type", Message: "must be 'success-ratio' or 'latency'"})
+	}
+
+	rules, _ := spec["burnRates"].([]interface{})
+	for i, r := range rules {
+		rule, _ := r.(map[string]interface{})
+		field := fmt.Sprintf("spec.burnRates[%d]", i)
+		for _, f := range []string{"long", "short"} {
+			v, _ := rule[f].(string)
+			if _, err := models.ParseDuration(v); err != nil {
+				errs = append(errs, ValidationError{Field: field + "." + f, Message: "must be a duration such as '1h'"})
+			}
+		}
+		sev, _ := rule["severity"].(string)
+		if sev != "" && sev != "page" && sev != "ticket" {
+			errs = append(errs, ValidationError{Field: field + ".severity", Message: "must be 'page' or 'ticket'"})
+		}
+	}
+
+	if alerting, ok := spec["alerting"].(map[string]interface{}); ok {
+		if u, _ := alerting["webhook"].(string); u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			errs = append(errs, ValidationError{Field: "spec.alerting.webhook", Message: "must be an http or https URL"})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,507 @@
+package slo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/events"
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/Promptonauts/pipe/pkg/schema"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+// Store is where the evaluator finds SLO resources.
+type Store interface {
+	List(kind models.ResourceKind, namespace string) ([]*models.GenericResource, error)
+	Watch(kind models.ResourceKind) <-chan store.ResourceEvent
+}
+
+type Config struct {
+	Interval       time.Duration // how often SLIs are sampled, default 30s
+	Webhook        string        // default alert receiver; SLOs can set their own
+	WebhookHeaders map[string]string
+}
+
+// Evaluator samples the metrics behind each SLO and alerts on multi-window
+// burn rates: a rule fires when the error budget is being spent Factor
+// times faster than the window allows over both its long window (enough
+// budget is gone to matter) and its short window (it is still happening).
+type Evaluator struct {
+	store    Store
+	metrics  *observability.MetricsRegistry
+	events   *events.Recorder
+	notifier Notifier
+	logger   *observability.Logger
+	cfg      Config
+	now      func() time.Time
+	stopCh   chan struct{}
+	outbox   chan delivery // alerts waiting for their webhook
+
+	mu   sync.Mutex
+	slos map[string]*sloState
+}
+
+func NewEvaluator(s Store, metrics *observability.MetricsRegistry, recorder *events.Recorder, logger *observability.Logger, cfg Config) *Evaluator {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	e := &Evaluator{
+		store:   s,
+		metrics: metrics,
+		events:  recorder,
+		logger:  logger.With("slo"),
+		cfg:     cfg,
+		now:     time.Now,
+		stopCh:  make(chan struct{}),
+		outbox:  make(chan delivery, 64),
+		slos:    make(map[string]*sloState),
+	}
+	if cfg.Webhook != "" {
+		e.notifier = NewWebhookNotifier(cfg.Webhook, cfg.WebhookHeaders)
+	}
+	go e.notify()
+	return e
+}
+
+type rule struct {
+	long, short time.Duration
+	models.BurnRateRule
+}
+
+type sample struct {
+	t           time.Time
+	good, total int64
+}
+
+type sloState struct {
+	ref         models.ObjectReference
+	target      models.ObjectReference
+	spec        models.SLOSpec
+	objective   float64
+	thresholdMs float64
+	rules       []rule
+	retain      time.Duration
+	notifier    Notifier
+
+	samples []sample
+	firing  map[int]time.Time
+	status  Status
+}
+
+// Status is the latest evaluation of one SLO.
+type Status struct {
+	Namespace string                 `json:"namespace"`
+	Name      string                 `json:"name"`
+	Target    models.ObjectReference `json:"target"`
+	Objective string                 `json:"objective"`
+	SLI       float64                `json:"sli"`     // over the longest rule window
+	HasData   bool                   `json:"hasData"` // false until executions were observed
+	Rules     []RuleStatus           `json:"rules"`
+	Evaluated time.Time              `json:"evaluated"`
+}
+
+type RuleStatus struct {
+	Long          string     `json:"long"`
+	Short         string     `json:"short"`
+	Factor        float64    `json:"factor"`
+	Severity      string     `json:"severity"`
+	LongBurnRate  float64    `json:"longBurnRate"`
+	ShortBurnRate float64    `json:"shortBurnRate"`
+	Firing        bool       `json:"firing"`
+	Since         *time.Time `json:"since,omitempty"`
+}
+
+// defaultBurnRates are the multi-window rules from the SRE workbook: page
+// when 2% of the budget goes in an hour or 5% in six hours, open a ticket
+// when 10% goes in three days.
+var defaultBurnRates = []models.BurnRateRule{
+	{Long: "1h", Short: "5m", BudgetFraction: 0.02, Severity: "page"},
+	{Long: "6h", Short: "30m", BudgetFraction: 0.05, Severity: "page"},
+	{Long: "3d", Short: "6h", BudgetFraction: 0.10, Severity: "ticket"},
+}
+
+// Apply starts evaluating an SLO resource, or updates it. History is kept
+// when the spec did not change, e.g. on status-only updates.
+func (e *Evaluator) Apply(res *models.GenericResource) error {
+	s, err := parseSLO(res)
+	if err != nil {
+		return err
+	}
+	if s.spec.Alerting.Webhook != "" {
+		s.notifier = NewWebhookNotifier(s.spec.Alerting.Webhook, s.spec.Alerting.Headers)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := res.Metadata.Namespace + "/" + res.Metadata.Name
+	if old, ok := e.slos[key]; ok && reflect.DeepEqual(old.spec, s.spec) {
+		return nil
+	}
+	e.slos[key] = s
+	e.logger.Info("slo applied", "slo", key, "target", s.target.String(), "objective", describeObjective(s))
+	return nil
+}
+
+func (e *Evaluator) Remove(namespace, name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.slos, namespace+"/"+name)
+}
+
+func parseSLO(res *models.GenericResource) (*sloState, error) {
+	if res.Kind != models.KindSLO {
+		return nil, fmt.Errorf("resource %s is not an SLO", res.Key())
+	}
+	if v := schema.ValidationResource(res); !v.Valid {
+		msgs := make([]string, len(v.Errors))
+		for i, err := range v.Errors {
+			msgs[i] = err.Error()
+		}
+		return nil, fmt.Errorf("slo %s: %s", res.Metadata.Name, strings.Join(msgs, "; "))
+	}
+	data, err := json.Marshal(res.Spec)
+	if err != nil {
+		return nil, err
+	}
+	var spec models.SLOSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("decode slo spec: %w", err)
+	}
+
+	s := &sloState{
+		ref:    models.ReferenceTo(res),
+		spec:   spec,
+		firing: make(map[int]time.Time),
+	}
+	s.target = models.ObjectReference{Kind: models.KindAgent, Namespace: res.Metadata.Namespace, Name: spec.Agent}
+	if spec.Pipeline != "" {
+		s.target = models.ObjectReference{Kind: models.KindPipeline, Namespace: res.Metadata.Namespace, Name: spec.Pipeline}
+	}
+
+	s.objective = spec.Objective.Target
+	if spec.Objective.Type == models.SLOLatency {
+		s.objective = spec.Objective.Percentile
+		d, _ := time.ParseDuration(spec.Objective.Threshold)
+		s.thresholdMs = float64(d.Milliseconds())
+	}
+
+	window := 30 * 24 * time.Hour
+	if spec.Window != "" {
+		window, _ = models.ParseDuration(spec.Window)
+	}
+	rules := spec.BurnRates
+	if len(rules) == 0 {
+		rules = defaultBurnRates
+	}
+	for _, br := range rules {
+		r := rule{BurnRateRule: br}
+		r.long, _ = models.ParseDuration(br.Long)
+		r.short, _ = models.ParseDuration(br.Short)
+		if r.long > window {
+			continue
+		}
+		if r.Factor <= 0 {
+			fraction := r.BudgetFraction
+			if fraction <= 0 {
+				fraction = 0.02
+			}
+			r.Factor = fraction * float64(window) / float64(r.long)
+		}
+		if r.Severity == "" {
+			r.Severity = "page"
+		}
+		if r.long > s.retain {
+			s.retain = r.long
+		}
+		s.rules = append(s.rules, r)
+	}
+	if len(s.rules) == 0 {
+		return nil, fmt.Errorf("slo %s: every burn-rate window is longer than the %s SLO window", res.Metadata.Name, window)
+	}
+	return s, nil
+}
+
+// Run loads SLO resources, follows changes to them and evaluates every
+// interval until Stop.
+func (e *Evaluator) Run() {
+	var watch <-chan store.ResourceEvent
+	if e.store != nil {
+		watch = e.store.Watch(models.KindSLO)
+		e.sync()
+	}
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.Evaluate()
+		case ev := <-watch:
+			e.handle(ev)
+		case <-e.stopCh:
+			return
+		}
+	}
+}
+
+func (e *Evaluator) Stop() {
+	close(e.stopCh)
+}
+
+func (e *Evaluator) sync() {
+	resources, err := e.store.List(models.KindSLO, "")
+	if err != nil {
+		e.logger.Error("failed to list slos", "error", err)
+		return
+	}
+	for _, res := range resources {
+		if err := e.Apply(res); err != nil {
+			e.logger.Warn("invalid slo", "slo", res.Key(), "error", err)
+		}
+	}
+}
+
+func (e *Evaluator) handle(ev store.ResourceEvent) {
+	if ev.Resource == nil {
+		return
+	}
+	if ev.Type == store.EventDeleted {
+		e.Remove(ev.Resource.Metadata.Namespace, ev.Resource.Metadata.Name)
+		return
+	}
+	if err := e.Apply(ev.Resource); err != nil {
+		e.logger.Warn("invalid slo", "slo", ev.Resource.Key(), "error", err)
+		e.events.Warning(models.ReferenceTo(ev.Resource), events.ReasonInvalidSLO, err.Error())
+	}
+}
+
+type delivery struct {
+	alert    models.SLOAlert
+	notifier Notifier
+}
+
+// Evaluate samples every SLO once and raises alerts for rules that started
+// or stopped firing. Webhooks are sent in the background.
+func (e *Evaluator) Evaluate() {
+	now := e.now().UTC()
+	var pending []delivery
+	e.mu.Lock()
+	for _, s := range e.slos {
+		pending = append(pending, e.evaluate(s, now)...)
+	}
+	e.mu.Unlock()
+
+	for _, d := range pending {
+		e.deliver(d)
+	}
+}
+
+func (e *Evaluator) evaluate(s *sloState, now time.Time) []delivery {
+	good, total := e.read(s)
+	if n := len(s.samples); n > 0 && (total < s.samples[n-1].total || good < s.samples[n-1].good) {
+		s.samples = nil // the counters were reset
+	}
+	s.samples = append(s.samples, sample{t: now, good: good, total: total})
+	cutoff := now.Add(-s.retain)
+	i := sort.Search(len(s.samples), func(i int) bool { return !s.samples[i].t.Before(cutoff) })
+	if i > 1 {
+		// Keep one sample at or before the cutoff as the baseline.
+		s.samples = append(s.samples[:0], s.samples[i-1:]...)
+	}
+
+	status := Status{
+		Namespace: s.ref.Namespace,
+		Name:      s.ref.Name,
+		Target:    s.target,
+		Objective: describeObjective(s),
+		SLI:       1,
+		Evaluated: now,
+	}
+	var out []delivery
+	for idx, r := range s.rules {
+		longRate, longSLI, hasData := s.burnRate(now, r.long)
+		shortRate, _, _ := s.burnRate(now, r.short)
+		if r.long == s.retain {
+			status.SLI, status.HasData = longSLI, hasData
+		}
+		firing := hasData && longRate >= r.Factor && shortRate >= r.Factor
+
+		rs := RuleStatus{
+			Long: r.Long, Short: r.Short, Factor: r.Factor, Severity: r.Severity,
+			LongBurnRate: longRate, ShortBurnRate: shortRate, Firing: firing,
+		}
+		since, was := s.firing[idx]
+		switch {
+		case firing && !was:
+			since = now
+			s.firing[idx] = since
+			out = append(out, s.alert("firing", r, longRate, shortRate, longSLI, since, now))
+		case !firing && was:
+			delete(s.firing, idx)
+			out = append(out, s.alert("resolved", r, longRate, shortRate, longSLI, since, now))
+		}
+		if firing {
+			rs.Since = &since
+		}
+		status.Rules = append(status.Rules, rs)
+	}
+	s.status = status
+	return out
+}
+
+// read returns the cumulative good and total execution counts for the
+// SLO's target.
+func (e *Evaluator) read(s *sloState) (good, total int64) {
+	labels := []string{s.target.Namespace, strings.ToLower(string(s.target.Kind)), s.target.Name}
+	if s.spec.Objective.Type == models.SLOLatency {
+		bounds, cumulative := e.metrics.HistogramVecWithBuckets(latencyMetric, LatencyBuckets, "namespace", "kind", "name").
+			WithLabelValues(labels...).Buckets()
+		for i, b := range bounds {
+			if b <= s.thresholdMs {
+				good = cumulative[i]
+			}
+		}
+		return good, cumulative[len(cumulative)-1]
+	}
+	executions := e.metrics.CounterVec(executionsMetric, "namespace", "kind", "name", "outcome")
+	good = executions.WithLabelValues(append(labels, "success")...).Value()
+	failed := executions.WithLabelValues(append(labels, "failure")...).Value()
+	return good, good + failed
+}
+
+// burnRate compares the error ratio over the last window with the one the
+// objective allows. hasData is false when no executions finished in it.
+func (s *sloState) burnRate(now time.Time, window time.Duration) (rate, sli float64, hasData bool) {
+	if len(s.samples) < 2 {
+		return 0, 1, false
+	}
+	start := now.Add(-window)
+	base := s.samples[0]
+	for _, smp := range s.samples {
+		if smp.t.After(start) {
+			break
+		}
+		base = smp
+	}
+	latest := s.samples[len(s.samples)-1]
+	total := latest.total - base.total
+	if total <= 0 {
+		return 0, 1, false
+	}
+	errRatio := float64(total-(latest.good-base.good)) / float64(total)
+	return errRatio / (1 - s.objective), 1 - errRatio, true
+}
+
+func (s *sloState) alert(state string, r rule, longRate, shortRate, sli float64, since, now time.Time) delivery {
+	var msg string
+	if state == "firing" {
+		msg = fmt.Sprintf("SLO %s: error budget burning %.1fx over %s and %.1fx over %s (alert at %.1fx); SLI %.4f, objective %s",
+			s.ref.Name, longRate, r.Long, shortRate, r.Short, r.Factor, sli, describeObjective(s))
+	} else {
+		msg = fmt.Sprintf("SLO %s: burn rate over %s back below %.1fx after %s",
+			s.ref.Name, r.Long, r.Factor, now.Sub(since).Round(time.Second))
+	}
+	return delivery{
+		notifier: s.notifier,
+		alert: models.SLOAlert{
+			SLO:           s.ref,
+			Target:        s.target,
+			State:         state,
+			Severity:      r.Severity,
+			Objective:     describeObjective(s),
+			LongWindow:    r.Long,
+			ShortWindow:   r.Short,
+			Factor:        r.Factor,
+			LongBurnRate:  longRate,
+			ShortBurnRate: shortRate,
+			SLI:           sli,
+			Message:       msg,
+			StartsAt:      since,
+			Timestamp:     now,
+		},
+	}
+}
+
+func (e *Evaluator) deliver(d delivery) {
+	a := d.alert
+	e.metrics.CounterVec("slo.alerts", "slo", "severity", "state").
+		WithLabelValues(a.SLO.Namespace+"/"+a.SLO.Name, a.Severity, a.State).Inc()
+	if a.State == "firing" {
+		e.logger.Warn("slo burn rate alert", "slo", a.SLO.Name, "target", a.Target.String(), "severity", a.Severity, "window", a.LongWindow, "burnRate", a.LongBurnRate)
+		e.events.Warning(a.Target, events.ReasonSLOBurnRateHigh, a.Message)
+	} else {
+		e.logger.Info("slo burn rate alert resolved", "slo", a.SLO.Name, "target", a.Target.String(), "window", a.LongWindow)
+		e.events.Normal(a.Target, events.ReasonSLOBurnRateResolved, a.Message)
+	}
+
+	if d.notifier == nil {
+		d.notifier = e.notifier
+	}
+	if d.notifier == nil {
+		return
+	}
+	select {
+	case e.outbox <- d:
+	default:
+		e.metrics.Counter("slo.webhook.dropped.total").Inc()
+		e.logger.Error("slo alert queue full, alert not sent", "slo", a.SLO.Name, "state", a.State)
+	}
+}
+
+// notify sends queued alerts to their webhooks one at a time, in the order
+// they were raised, until Stop. A slow receiver delays later alerts but not
+// evaluation.
+func (e *Evaluator) notify() {
+	for {
+		select {
+		case d := <-e.outbox:
+			e.send(d)
+		case <-e.stopCh:
+			return
+		}
+	}
+}
+
+func (e *Evaluator) send(d delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.notifier.Notify(ctx, d.alert); err != nil {
+		e.metrics.Counter("slo.webhook.failures.total").Inc()
+		e.logger.Error("failed to send slo alert", "slo", d.alert.SLO.Name, "error", err)
+	}
+}
+
+// Statuses returns the latest evaluation of every SLO, sorted by namespace
+// and name.
+func (e *Evaluator) Statuses() []Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]Status, 0, len(e.slos))
+	for _, s := range e.slos {
+		st := s.status
+		if st.Name == "" {
+			st = Status{Namespace: s.ref.Namespace, Name: s.ref.Name, Target: s.target, Objective: describeObjective(s), SLI: 1}
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func describeObjective(s *sloState) string {
+	if s.spec.Objective.Type == models.SLOLatency {
+		return fmt.Sprintf("%g%% of executions within %s", s.objective*100, s.spec.Objective.Threshold)
+	}
+	return fmt.Sprintf("%g%% of executions succeed", s.objective*100)
+}
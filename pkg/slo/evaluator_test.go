@@ -0,0 +1,215 @@
+package slo
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/events"
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+type eventLog struct {
+	events []*models.Event
+}
+
+func (l *eventLog) RecordEvent(e *models.Event) error {
+	l.events = append(l.events, e)
+	return nil
+}
+
+func (l *eventLog) DeleteEventsBefore(time.Time) (int64, error) { return 0, nil }
+
+// alertSink is an unbuffered notifier: Notify waits until the test reads
+// the alert.
+type alertSink chan models.SLOAlert
+
+func (s alertSink) Notify(ctx context.Context, a models.SLOAlert) error {
+	select {
+	case s <- a:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s alertSink) next(t *testing.T) models.SLOAlert {
+	t.Helper()
+	select {
+	case a := <-s:
+		return a
+	case <-time.After(time.Second):
+		t.Fatal("no alert sent")
+		return models.SLOAlert{}
+	}
+}
+
+func sloResource(name string, spec map[string]interface{}) *models.GenericResource {
+	return &models.GenericResource{
+		APIVersion: "pipe/v1",
+		Kind:       models.KindSLO,
+		Metadata:   models.Metadata{Name: name, Namespace: "default", Version: "1"},
+		Spec:       spec,
+	}
+}
+
+// testEvaluator returns an evaluator on a fake clock that advance moves.
+func testEvaluator(t *testing.T, log *eventLog) (*Evaluator, *observability.MetricsRegistry, func(time.Duration)) {
+	metrics := observability.NewMetricsRegistry()
+	logger := observability.NewLogger("test")
+	e := NewEvaluator(nil, metrics, events.NewRecorder(log, logger), logger, Config{})
+	t.Cleanup(e.Stop)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+	return e, metrics, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestBurnRateAlerts(t *testing.T) {
+	log := &eventLog{}
+	e, metrics, advance := testEvaluator(t, log)
+	sink := make(alertSink)
+	e.notifier = sink
+	err := e.Apply(sloResource("writer-success", map[string]interface{}{
+		"agent":     "writer",
+		"objective": map[string]interface{}{"type": "success-ratio", "target": 0.99},
+		"burnRates": []interface{}{
+			map[string]interface{}{"long": "1h", "short": "5m", "factor": 10.0},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executions := metrics.CounterVec(executionsMetric, "namespace", "kind", "name", "outcome")
+	// minute adds a minute of executions and evaluates.
+	minute := func(succeeded, failed int64) RuleStatus {
+		advance(time.Minute)
+		executions.WithLabelValues("default", "agent", "writer", "success").Add(succeeded)
+		executions.WithLabelValues("default", "agent", "writer", "failure").Add(failed)
+		e.Evaluate()
+		return e.Statuses()[0].Rules[0]
+	}
+
+	e.Evaluate()
+	if st := e.Statuses()[0]; st.HasData || st.SLI != 1 {
+		t.Fatalf("before any executions: %+v", st)
+	}
+	for i := 0; i < 60; i++ {
+		minute(100, 0)
+	}
+	if st := e.Statuses()[0]; !st.HasData || st.SLI != 1 || st.Rules[0].LongBurnRate != 0 {
+		t.Fatalf("after a healthy hour: %+v", st)
+	}
+
+	// 20% of executions fail: the short window burns at 20x at once, but
+	// the alert waits until the hour has burnt at 10x too.
+	var r RuleStatus
+	for i := 0; i < 5; i++ {
+		r = minute(80, 20)
+	}
+	if math.Abs(r.ShortBurnRate-20) > 1e-6 || r.LongBurnRate >= 10 || r.Firing {
+		t.Fatalf("after 5 failing minutes: %+v", r)
+	}
+	for i := 5; i < 25; i++ {
+		r = minute(80, 20)
+	}
+	if r.Firing {
+		t.Fatalf("fired after 25 failing minutes at %.2fx", r.LongBurnRate)
+	}
+	for i := 25; i < 35 && !r.Firing; i++ {
+		r = minute(80, 20)
+	}
+	if !r.Firing || r.Since == nil {
+		t.Fatalf("not firing after 35 failing minutes: %+v", r)
+	}
+	// Evaluate returned before the alert was read, so sending it did not
+	// hold up evaluation.
+	if a := sink.next(t); a.State != "firing" || a.Severity != "page" || a.SLO.Name != "writer-success" || a.Target.Name != "writer" {
+		t.Fatalf("alert = %+v", a)
+	}
+
+	// Recovery: the short window clears first and resolves the alert.
+	for i := 0; i < 6 && r.Firing; i++ {
+		r = minute(100, 0)
+	}
+	if r.Firing {
+		t.Fatalf("still firing after 6 healthy minutes: %+v", r)
+	}
+	if a := sink.next(t); a.State != "resolved" {
+		t.Fatalf("alert = %+v", a)
+	}
+
+	var reasons []string
+	for _, ev := range log.events {
+		reasons = append(reasons, ev.Reason)
+	}
+	if strings.Join(reasons, ",") != events.ReasonSLOBurnRateHigh+","+events.ReasonSLOBurnRateResolved {
+		t.Errorf("events = %v", reasons)
+	}
+}
+
+func TestLatencySLOFromExecutionEvents(t *testing.T) {
+	e, metrics, advance := testEvaluator(t, &eventLog{})
+	err := e.Apply(sloResource("writer-latency", map[string]interface{}{
+		"agent":     "writer",
+		"objective": map[string]interface{}{"type": "latency", "percentile": 0.9, "threshold": "2s"},
+		"burnRates": []interface{}{
+			map[string]interface{}{"long": "1h", "short": "5m", "factor": 1.0},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Evaluate()
+
+	finished := func(state models.ExecutionState, latencyMs int64) *models.ExecutionRecord {
+		return &models.ExecutionRecord{ID: "e", AgentName: "writer", Namespace: "default", State: state, LatencyMs: latencyMs}
+	}
+	ch := make(chan store.ExecutionEvent, 16)
+	for i := 0; i < 8; i++ {
+		ch <- store.ExecutionEvent{Type: store.EventUpdated, Execution: finished(models.ExecCompleted, 1500), PrevState: models.ExecRunning}
+	}
+	ch <- store.ExecutionEvent{Type: store.EventUpdated, Execution: finished(models.ExecCompleted, 3000), PrevState: models.ExecRunning}
+	ch <- store.ExecutionEvent{Type: store.EventUpdated, Execution: finished(models.ExecFailed, 2500), PrevState: models.ExecRetrying}
+	// Neither a running execution nor a later update of a finished one is
+	// counted.
+	ch <- store.ExecutionEvent{Type: store.EventUpdated, Execution: finished(models.ExecRunning, 0), PrevState: models.ExecPending}
+	ch <- store.ExecutionEvent{Type: store.EventUpdated, Execution: finished(models.ExecFailed, 2500), PrevState: models.ExecFailed}
+	close(ch)
+	ObserveExecutions(metrics, ch)
+
+	advance(time.Minute)
+	e.Evaluate()
+	st := e.Statuses()[0]
+	if !st.HasData || math.Abs(st.SLI-0.8) > 1e-9 {
+		t.Fatalf("SLI = %v (hasData %v), want 0.8", st.SLI, st.HasData)
+	}
+	if r := st.Rules[0]; math.Abs(r.LongBurnRate-2) > 1e-6 || !r.Firing {
+		t.Errorf("rule = %+v, want a 2x burn rate firing", r)
+	}
+}
+
+func TestLatencyThresholdMustBeBucket(t *testing.T) {
+	for _, tc := range []struct {
+		threshold string
+		valid     bool
+	}{
+		{"2s", true},
+		{"2500ms", true},
+		{"5m", true},
+		{"3s", false},
+		{"1.2s", false},
+	} {
+		_, err := parseSLO(sloResource("latency", map[string]interface{}{
+			"agent":     "writer",
+			"objective": map[string]interface{}{"type": "latency", "percentile": 0.95, "threshold": tc.threshold},
+		}))
+		if (err == nil) != tc.valid {
+			t.Errorf("threshold %s: error = %v, want valid=%v", tc.threshold, err, tc.valid)
+		}
+	}
+}
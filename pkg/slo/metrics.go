@@ -0,0 +1,56 @@
+package slo
+
+import (
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+	"github.com/Promptonauts/pipe/pkg/store"
+)
+
+// Metrics the evaluator reads. Both are labelled by namespace, kind (agent
+// or pipeline) and name; executions also by outcome (success or failure).
+const (
+	executionsMetric = "slo.executions"
+	latencyMetric    = "slo.execution.latency.ms"
+)
+
+// LatencyBuckets are the execution latency bucket bounds in milliseconds.
+// SLO validation only accepts latency thresholds that are one of them.
+var LatencyBuckets = models.SLOLatencyBuckets
+
+// ObserveExecutions records each execution reported as finished on events
+// for the SLOs of its agent and pipeline, until events is closed. Pass it
+// the store's WatchExecutions channel.
+func ObserveExecutions(metrics *observability.MetricsRegistry, events <-chan store.ExecutionEvent) {
+	for ev := range events {
+		if ev.PrevState != ev.Execution.State {
+			ObserveExecution(metrics, ev.Execution)
+		}
+	}
+}
+
+// ObserveExecution records a finished execution for the SLOs of its agent
+// and pipeline. Executions that are not in a terminal state are ignored.
+func ObserveExecution(metrics *observability.MetricsRegistry, exec *models.ExecutionRecord) {
+	if !exec.State.IsTerminal() {
+		return
+	}
+	outcome := "success"
+	if exec.State != models.ExecCompleted {
+		outcome = "failure"
+	}
+	latency := float64(exec.LatencyMs)
+	if latency == 0 && exec.StartedAt != nil && exec.CompletedAt != nil {
+		latency = float64(exec.CompletedAt.Sub(*exec.StartedAt).Milliseconds())
+	}
+
+	executions := metrics.CounterVec(executionsMetric, "namespace", "kind", "name", "outcome")
+	latencies := metrics.HistogramVecWithBuckets(latencyMetric, LatencyBuckets, "namespace", "kind", "name")
+	targets := [][2]string{{"agent", exec.AgentName}}
+	if exec.PipelineName != "" {
+		targets = append(targets, [2]string{"pipeline", exec.PipelineName})
+	}
+	for _, t := range targets {
+		executions.WithLabelValues(exec.Namespace, t[0], t[1], outcome).Inc()
+		latencies.WithLabelValues(exec.Namespace, t[0], t[1]).Observe(latency)
+	}
+}
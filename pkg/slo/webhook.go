@@ -0,0 +1,40 @@
+package slo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+)
+
+// Notifier delivers alerts somewhere people will see them.
+type Notifier interface {
+	Notify(ctx context.Context, alert models.SLOAlert) error
+}
+
+// WebhookNotifier posts each alert as JSON to a URL.
+type WebhookNotifier struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewWebhookNotifier(url string, headers map[string]string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, headers: headers, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert models.SLOAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	if err := observability.PostJSON(ctx, n.client, n.url, n.headers, body); err != nil {
+		return fmt.Errorf("slo webhook: %w", err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,11 +17,15 @@ type SQLiteStore struct {
 	db       *sql.DB
 	mu       sync.RWMutex
 	watchers map[models.ResourceKind][]chan ResourceEvent
+	execs    []*execWatcher
 	watchMu  sync.RWMutex
 }
 
 func NewSQLiteStore(path string) (*SQLiteStore, error) {
-	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	// _txlock=immediate makes every transaction take the write lock at
+	// BEGIN, so read-modify-write transactions such as UpdateRateLimit are
+	// serialized across processes sharing the database file.
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite: %w", err)
 	}
@@ -68,15 +73,148 @@ func (s *SQLiteStore) Migrate() error {
 		FOREIGN KEY (execution_id) REFERENCES executions(id)
 	);
 
+	CREATE TABLE IF NOT EXISTS budget_usage (
+		key TEXT PRIMARY KEY,
+		tokens INTEGER NOT NULL DEFAULT 0,
+		cost REAL NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS rate_limits (
+		key TEXT PRIMARY KEY,
+		tat INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS approvals (
+		id TEXT PRIMARY KEY,
+		execution_id TEXT NOT NULL,
+		state TEXT NOT NULL,
+		data TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		FOREIGN KEY (execution_id) REFERENCES executions(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS guardrail_verdicts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		execution_id TEXT NOT NULL,
+		guardrail_id TEXT NOT NULL,
+		agent TEXT DEFAULT '',
+		namespace TEXT DEFAULT '',
+		phase TEXT NOT NULL,
+		step INTEGER DEFAULT 0,
+		passed INTEGER NOT NULL,
+		action TEXT DEFAULT '',
+		message TEXT NOT NULL,
+		shadow INTEGER DEFAULT 0,
+		latency_ms REAL DEFAULT 0,
+		timestamp DATETIME NOT NULL,
+		FOREIGN KEY (execution_id) REFERENCES executions(id)
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_executions_namespace ON executions(namespace);
 	CREATE INDEX IF NOT EXISTS idx_executions_state ON executions(state);
 	CREATE INDEX IF NOT EXISTS idx_execution_logs_exec_id ON execution_logs(execution_id);
+	CREATE TABLE IF NOT EXISTS spans (
+		span_id TEXT PRIMARY KEY,
+		trace_id TEXT NOT NULL,
+		parent_id TEXT DEFAULT '',
+		execution_id TEXT DEFAULT '',
+		operation TEXT NOT NULL,
+		start_time DATETIME NOT NULL,
+		data TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS events (
+		id TEXT PRIMARY KEY,
+		kind TEXT NOT NULL,
+		namespace TEXT DEFAULT '',
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		message TEXT NOT NULL,
+		source TEXT DEFAULT '',
+		count INTEGER NOT NULL DEFAULT 1,
+		first_seen DATETIME NOT NULL,
+		last_seen DATETIME NOT NULL,
+		UNIQUE(kind, namespace, name, type, reason, message)
+	);
+
+	CREATE TABLE IF NOT EXISTS usage_records (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		execution_id TEXT NOT NULL,
+		agent TEXT DEFAULT '',
+		pipeline TEXT DEFAULT '',
+		namespace TEXT DEFAULT '',
+		step INTEGER DEFAULT 0,
+		provider TEXT DEFAULT '',
+		model TEXT DEFAULT '',
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		cost REAL NOT NULL DEFAULT 0,
+		priced INTEGER NOT NULL DEFAULT 0,
+		timestamp DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_guardrail_verdicts_exec_id ON guardrail_verdicts(execution_id);
+	CREATE INDEX IF NOT EXISTS idx_guardrail_verdicts_violations ON guardrail_verdicts(passed, timestamp);
+	CREATE INDEX IF NOT EXISTS idx_spans_trace_id ON spans(trace_id);
+	CREATE INDEX IF NOT EXISTS idx_spans_exec_id ON spans(execution_id);
+	CREATE INDEX IF NOT EXISTS idx_spans_start_time ON spans(start_time);
+	CREATE INDEX IF NOT EXISTS idx_events_last_seen ON events(last_seen);
+	CREATE INDEX IF NOT EXISTS idx_usage_records_exec_id ON usage_records(execution_id);
+	CREATE INDEX IF NOT EXISTS idx_usage_records_timestamp ON usage_records(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_approvals_exec_id ON approvals(execution_id);
+	CREATE INDEX IF NOT EXISTS idx_approvals_state ON approvals(state);
 	`
-	_, err := s.db.Exec(schema)
-	return err
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// CREATE TABLE IF NOT EXISTS leaves tables of older databases alone, so
+	// columns added since are added here.
+	return s.addColumns("guardrail_verdicts", "agent TEXT DEFAULT ''", "namespace TEXT DEFAULT ''")
+}
+
+// addColumns adds each column definition whose column table lacks.
+func (s *SQLiteStore) addColumns(table string, defs ...string) error {
+	rows, err := s.db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		have[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, def := range defs {
+		if have[strings.Fields(def)[0]] {
+			continue
+		}
+		if _, err := s.db.Exec("ALTER TABLE " + table + " ADD COLUMN " + def); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", table, def, err)
+		}
+	}
+	return nil
 }
 
+// Close closes the database and the WatchExecutions channels, once each
+// has delivered the events queued for it.
 func (s *SQLiteStore) Close() error {
+	s.watchMu.Lock()
+	for _, w := range s.execs {
+		w.close()
+	}
+	s.execs = nil
+	s.watchMu.Unlock()
 	return s.db.Close()
 }
 
@@ -237,11 +375,16 @@ func (s *SQLiteStore) CreateExecution(exec *models.ExecutionRecord) error {
 	if exec.ID == "" {
 		exec.ID = uuid.New().String()
 	}
+	if exec.PipelineName != "" && exec.PipelineRunID == "" {
+		// A pipeline execution started on its own is its own run; stages
+		// started by a run carry the run's ID.
+		exec.PipelineRunID = exec.ID
+	}
 	now := time.Now().UTC()
 	exec.CreatedAt = now
 	exec.UpdatedAt = now
 
-	data, err := json.Marshal(exec)
+	data, err := marshalExecution(exec)
 	if err != nil {
 		return err
 	}
@@ -250,7 +393,11 @@ func (s *SQLiteStore) CreateExecution(exec *models.ExecutionRecord) error {
 		INSERT INTO executions (id, namespace, agent_name, pipeline_name, state, data, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`, exec.ID, exec.Namespace, exec.AgentName, exec.PipelineName, string(exec.State), string(data), now, now)
-	return err
+	if err != nil {
+		return err
+	}
+	s.emitExecution(EventCreated, "", data)
+	return nil
 }
 
 func (s *SQLiteStore) GetExecution(id string) (*models.ExecutionRecord, error) {
@@ -270,15 +417,44 @@ func (s *SQLiteStore) GetExecution(id string) (*models.ExecutionRecord, error) {
 	if err := json.Unmarshal([]byte(data), &exec); err != nil {
 		return nil, err
 	}
+	if exec.Verdicts, err = s.guardrailVerdicts(id); err != nil {
+		return nil, err
+	}
 	return &exec, nil
 }
 
+// marshalExecution encodes exec for the data column. Verdicts live in
+// their own table and are filled in by GetExecution, so a record read and
+// written back does not copy them into the row.
+func marshalExecution(exec *models.ExecutionRecord) ([]byte, error) {
+	rec := *exec
+	rec.Verdicts = nil
+	return json.Marshal(&rec)
+}
+
 func (s *SQLiteStore) UpdateExecution(exec *models.ExecutionRecord) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	var prev, prevData string
+	err := s.db.QueryRow("SELECT state, data FROM executions WHERE id = ?", exec.ID).Scan(&prev, &prevData)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("execution %s not found", exec.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	var stored struct {
+		CurrentStep int `json:"currentStep"`
+	}
+	if err := json.Unmarshal([]byte(prevData), &stored); err != nil {
+		return err
+	}
+	prevStep := stored.CurrentStep
+
 	exec.UpdatedAt = time.Now().UTC()
-	data, err := json.Marshal(exec)
+	data, err := marshalExecution(exec)
 	if err != nil {
 		return err
 	}
@@ -286,7 +462,13 @@ func (s *SQLiteStore) UpdateExecution(exec *models.ExecutionRecord) error {
 	_, err = s.db.Exec(`
 		UPDATE executions SET state = ?, data = ?, updated_at = ? WHERE id = ?
 	`, string(exec.State), string(data), exec.UpdatedAt, exec.ID)
-	return err
+	if err != nil {
+		return err
+	}
+	if models.ExecutionState(prev) != exec.State || prevStep != exec.CurrentStep {
+		s.emitExecution(EventUpdated, models.ExecutionState(prev), data)
+	}
+	return nil
 }
 
 func (s *SQLiteStore) ListExecutions(namespace string, limit int) ([]*models.ExecutionRecord, error) {
@@ -361,6 +543,437 @@ func (s *SQLiteStore) GetExecutionLogs(id string) ([]models.ExecutionLog, error)
 	return logs, nil
 }
 
+func (s *SQLiteStore) AppendGuardrailVerdicts(id string, verdicts []models.GuardrailVerdict) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO guardrail_verdicts (execution_id, guardrail_id, agent, namespace, phase, step, passed, action, message, shadow, latency_ms, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, v := range verdicts {
+		if _, err := stmt.Exec(id, v.GuardrailID, v.AgentName, v.Namespace, v.Phase, v.Step, v.Passed, v.Action, v.Message, v.Shadow, v.LatencyMs, v.Timestamp); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetGuardrailVerdicts(id string) ([]models.GuardrailVerdict, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.guardrailVerdicts(id)
+}
+
+func (s *SQLiteStore) guardrailVerdicts(id string) ([]models.GuardrailVerdict, error) {
+	rows, err := s.db.Query(`
+		SELECT guardrail_id, agent, namespace, phase, step, passed, action, message, shadow, latency_ms, timestamp
+		FROM guardrail_verdicts WHERE execution_id = ? ORDER BY id ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var verdicts []models.GuardrailVerdict
+	for rows.Next() {
+		v := models.GuardrailVerdict{ExecutionID: id}
+		if err := rows.Scan(&v.GuardrailID, &v.AgentName, &v.Namespace, &v.Phase, &v.Step, &v.Passed, &v.Action, &v.Message, &v.Shadow, &v.LatencyMs, &v.Timestamp); err != nil {
+			return nil, err
+		}
+		verdicts = append(verdicts, v)
+	}
+	return verdicts, rows.Err()
+}
+
+func (s *SQLiteStore) AppendSpans(spans []models.SpanRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO spans (span_id, trace_id, parent_id, execution_id, operation, start_time, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, sp := range spans {
+		data, err := json.Marshal(sp)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(sp.SpanID, sp.TraceID, sp.ParentID, sp.ExecutionID, sp.Operation, sp.StartTime, string(data)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetExecutionSpans returns the spans tagged with the execution, ordered by
+// start time.
+func (s *SQLiteStore) GetExecutionSpans(executionID string) ([]models.SpanRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT data FROM spans
+		WHERE execution_id = ?
+		ORDER BY start_time ASC
+	`, executionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spans []models.SpanRecord
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var sp models.SpanRecord
+		if err := json.Unmarshal([]byte(data), &sp); err != nil {
+			return nil, err
+		}
+		spans = append(spans, sp)
+	}
+	return spans, rows.Err()
+}
+
+// DeleteSpansBefore removes spans started before t and returns how many
+// were removed.
+func (s *SQLiteStore) DeleteSpansBefore(t time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec("DELETE FROM spans WHERE start_time < ?", t)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ShadowReport summarizes the shadow verdicts recorded since the given time
+// per guardrail, with the latest violations as samples. A violation overlaps
+// with an enforced guardrail when an enforced verdict of the same execution,
+// phase and step failed too.
+func (s *SQLiteStore) ShadowReport(since time.Time) ([]models.ShadowStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT v.guardrail_id,
+			COUNT(*),
+			SUM(v.passed = 0),
+			SUM(v.passed = 0 AND v.action = 'block'),
+			SUM(v.passed = 0 AND v.action = 'escalate'),
+			COUNT(DISTINCT v.execution_id),
+			COUNT(DISTINCT CASE WHEN v.passed = 0 THEN v.execution_id END),
+			SUM(v.passed = 0 AND EXISTS (
+				SELECT 1 FROM guardrail_verdicts e
+				WHERE e.execution_id = v.execution_id AND e.phase = v.phase AND e.step = v.step
+					AND e.shadow = 0 AND e.passed = 0))
+		FROM guardrail_verdicts v
+		WHERE v.shadow = 1 AND v.timestamp >= ?
+		GROUP BY v.guardrail_id ORDER BY v.guardrail_id`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []models.ShadowStats
+	index := make(map[string]int)
+	for rows.Next() {
+		var st models.ShadowStats
+		if err := rows.Scan(&st.GuardrailID, &st.Checks, &st.Violations, &st.WouldBlock, &st.WouldEscalate,
+			&st.Executions, &st.ViolatingExecutions, &st.OverlapWithEnforced); err != nil {
+			return nil, err
+		}
+		if st.Checks > 0 {
+			st.ViolationRate = float64(st.Violations) / float64(st.Checks)
+		}
+		index[st.GuardrailID] = len(stats)
+		stats = append(stats, st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	samples, err := s.db.Query(`
+		SELECT guardrail_id, execution_id, step, phase, action, message, timestamp FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY guardrail_id ORDER BY id DESC) AS n
+			FROM guardrail_verdicts WHERE shadow = 1 AND passed = 0 AND timestamp >= ?
+		) WHERE n <= ? ORDER BY id ASC`, since.UTC(), shadowSamples)
+	if err != nil {
+		return nil, err
+	}
+	defer samples.Close()
+	for samples.Next() {
+		var id string
+		var sample models.ShadowSample
+		if err := samples.Scan(&id, &sample.ExecutionID, &sample.Step, &sample.Phase, &sample.Action, &sample.Message, &sample.Timestamp); err != nil {
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			stats[i].Samples = append(stats[i].Samples, sample)
+		}
+	}
+	return stats, samples.Err()
+}
+
+// shadowSamples is how many recent violations ShadowReport returns per
+// guardrail.
+const shadowSamples = 20
+
+// GuardrailViolations counts failed verdicts per time bucket and group,
+// ordered by bucket and then by count, highest first.
+func (s *SQLiteStore) GuardrailViolations(q models.ViolationQuery) ([]models.ViolationStat, error) {
+	if q.Until.IsZero() {
+		q.Until = time.Now().UTC()
+	}
+	if q.Since.IsZero() {
+		q.Since = q.Until.Add(-24 * time.Hour)
+	}
+	columns := map[string]string{
+		"guardrail": "guardrail_id",
+		"agent":     "agent",
+		"namespace": "namespace",
+		"action":    "action",
+		"phase":     "phase",
+	}
+	group := make(map[string]bool, len(q.GroupBy))
+	for _, g := range q.GroupBy {
+		if _, ok := columns[g]; !ok {
+			return nil, fmt.Errorf("cannot group violations by %q", g)
+		}
+		group[g] = true
+	}
+
+	// Ungrouped columns are selected as '' so every row scans the same way.
+	var selected, grouped []string
+	for _, g := range []string{"guardrail", "agent", "namespace", "action", "phase"} {
+		if group[g] {
+			selected = append(selected, columns[g])
+			grouped = append(grouped, columns[g])
+		} else {
+			selected = append(selected, "''")
+		}
+	}
+	bucket := "0"
+	var args []interface{}
+	if q.Window > 0 {
+		if q.Window < time.Second {
+			return nil, fmt.Errorf("window must be at least 1s")
+		}
+		bucket = "(CAST(strftime('%s', timestamp) AS INTEGER) - ?) / ?"
+		args = append(args, q.Since.Unix(), int64(q.Window/time.Second))
+	}
+
+	query := `SELECT ` + bucket + ` AS bucket, ` + strings.Join(selected, ", ") + `, COUNT(*), COUNT(DISTINCT execution_id)
+		FROM guardrail_verdicts WHERE passed = 0 AND timestamp >= ? AND timestamp < ?`
+	args = append(args, q.Since.UTC(), q.Until.UTC())
+	if !q.Shadow {
+		query += " AND shadow = 0"
+	}
+	if q.Namespace != "" {
+		query += " AND namespace = ?"
+		args = append(args, q.Namespace)
+	}
+	if q.Agent != "" {
+		query += " AND agent = ?"
+		args = append(args, q.Agent)
+	}
+	if q.Guardrail != "" {
+		query += " AND guardrail_id = ?"
+		args = append(args, q.Guardrail)
+	}
+	query += " GROUP BY " + strings.Join(append([]string{"bucket"}, grouped...), ", ")
+	query += " ORDER BY " + strings.Join(append([]string{"bucket", "COUNT(*) DESC"}, grouped...), ", ")
+	if q.Limit > 0 && q.Window == 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []models.ViolationStat{}
+	for rows.Next() {
+		var n int64
+		var v models.ViolationStat
+		if err := rows.Scan(&n, &v.GuardrailID, &v.AgentName, &v.Namespace, &v.Action, &v.Phase, &v.Count, &v.Executions); err != nil {
+			return nil, err
+		}
+		v.BucketStart = q.Since.UTC().Add(time.Duration(n) * q.Window)
+		stats = append(stats, v)
+	}
+	return stats, rows.Err()
+}
+
+func (s *SQLiteStore) RecordUsage(u *models.UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u.Timestamp.IsZero() {
+		u.Timestamp = time.Now().UTC()
+	}
+	res, err := s.db.Exec(`
+		INSERT INTO usage_records (execution_id, agent, pipeline, namespace, step, provider, model, prompt_tokens, completion_tokens, cost, priced, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, u.ExecutionID, u.AgentName, u.PipelineName, u.Namespace, u.Step, u.Provider, u.Model, u.PromptTokens, u.CompletionTokens, u.Cost, u.Priced, u.Timestamp)
+	if err != nil {
+		return err
+	}
+	u.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetExecutionUsage returns the model calls of an execution in order.
+func (s *SQLiteStore) GetExecutionUsage(executionID string) ([]models.UsageRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT id, agent, pipeline, namespace, step, provider, model, prompt_tokens, completion_tokens, cost, priced, timestamp
+		FROM usage_records WHERE execution_id = ? ORDER BY id ASC
+	`, executionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.UsageRecord
+	for rows.Next() {
+		u := models.UsageRecord{ExecutionID: executionID}
+		if err := rows.Scan(&u.ID, &u.AgentName, &u.PipelineName, &u.Namespace, &u.Step, &u.Provider, &u.Model, &u.PromptTokens, &u.CompletionTokens, &u.Cost, &u.Priced, &u.Timestamp); err != nil {
+			return nil, err
+		}
+		records = append(records, u)
+	}
+	return records, rows.Err()
+}
+
+// UsageReport sums tokens and cost per time bucket and group, ordered by
+// bucket and then by cost and tokens, highest first.
+func (s *SQLiteStore) UsageReport(q models.UsageQuery) ([]models.UsageStat, error) {
+	if q.Until.IsZero() {
+		q.Until = time.Now().UTC()
+	}
+	if q.Since.IsZero() {
+		q.Since = q.Until.Add(-24 * time.Hour)
+	}
+	columns := map[string]string{
+		"execution": "execution_id",
+		"agent":     "agent",
+		"pipeline":  "pipeline",
+		"namespace": "namespace",
+		"provider":  "provider",
+		"model":     "model",
+	}
+	group := make(map[string]bool, len(q.GroupBy))
+	for _, g := range q.GroupBy {
+		if _, ok := columns[g]; !ok {
+			return nil, fmt.Errorf("cannot group usage by %q", g)
+		}
+		group[g] = true
+	}
+
+	// Ungrouped columns are selected as '' so every row scans the same way.
+	var selected, grouped []string
+	for _, g := range []string{"execution", "agent", "pipeline", "namespace", "provider", "model"} {
+		if group[g] {
+			selected = append(selected, columns[g])
+			grouped = append(grouped, columns[g])
+		} else {
+			selected = append(selected, "''")
+		}
+	}
+	bucket := "0"
+	var args []interface{}
+	if q.Window > 0 {
+		if q.Window < time.Second {
+			return nil, fmt.Errorf("window must be at least 1s")
+		}
+		bucket = "(CAST(strftime('%s', timestamp) AS INTEGER) - ?) / ?"
+		args = append(args, q.Since.Unix(), int64(q.Window/time.Second))
+	}
+
+	query := `SELECT ` + bucket + ` AS bucket, ` + strings.Join(selected, ", ") + `,
+		COUNT(*), COUNT(DISTINCT execution_id), SUM(prompt_tokens), SUM(completion_tokens), SUM(cost), SUM(priced = 0)
+		FROM usage_records WHERE timestamp >= ? AND timestamp < ?`
+	args = append(args, q.Since.UTC(), q.Until.UTC())
+	if q.Namespace != "" {
+		query += " AND namespace = ?"
+		args = append(args, q.Namespace)
+	}
+	if q.Agent != "" {
+		query += " AND agent = ?"
+		args = append(args, q.Agent)
+	}
+	if q.Pipeline != "" {
+		query += " AND pipeline = ?"
+		args = append(args, q.Pipeline)
+	}
+	if q.ExecutionID != "" {
+		query += " AND execution_id = ?"
+		args = append(args, q.ExecutionID)
+	}
+	query += " GROUP BY " + strings.Join(append([]string{"bucket"}, grouped...), ", ")
+	query += " ORDER BY bucket, SUM(cost) DESC, SUM(prompt_tokens + completion_tokens) DESC"
+	if q.Limit > 0 && q.Window == 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []models.UsageStat{}
+	for rows.Next() {
+		var n int64
+		var u models.UsageStat
+		if err := rows.Scan(&n, &u.ExecutionID, &u.AgentName, &u.PipelineName, &u.Namespace, &u.Provider, &u.Model,
+			&u.Calls, &u.Executions, &u.PromptTokens, &u.CompletionTokens, &u.Cost, &u.UnpricedCalls); err != nil {
+			return nil, err
+		}
+		u.BucketStart = q.Since.UTC().Add(time.Duration(n) * q.Window)
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+		stats = append(stats, u)
+	}
+	return stats, rows.Err()
+}
+
 func (s *SQLiteStore) SaveCheckpoint(executionID string, data []byte) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -382,6 +995,309 @@ func (s *SQLiteStore) LoadCheckpoint(executionID string) ([]byte, error) {
 	return data, err
 }
 
+func (s *SQLiteStore) GetBudgetUsage(key string) (int64, float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tokens int64
+	var cost float64
+	err := s.db.QueryRow("SELECT tokens, cost FROM budget_usage WHERE key = ?", key).Scan(&tokens, &cost)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	return tokens, cost, err
+}
+
+// ChargeBudget applies the charges in one transaction. Each upsert takes
+// the write lock before the limits are checked, so servers sharing the
+// database cannot both pass a limit. When a charge would exceed its limit
+// nothing is applied, exceeded is its index and used[exceeded] is the
+// usage it would have reached; otherwise exceeded is -1 and used holds the
+// usage of every key after the charges.
+func (s *SQLiteStore) ChargeBudget(charges []models.BudgetCharge) ([]models.BudgetUsage, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, -1, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	used := make([]models.BudgetUsage, len(charges))
+	for i, c := range charges {
+		err := tx.QueryRow(`
+			INSERT INTO budget_usage (key, tokens, cost, updated_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(key) DO UPDATE SET
+				tokens = tokens + excluded.tokens,
+				cost = cost + excluded.cost,
+				updated_at = excluded.updated_at
+			RETURNING tokens, cost
+		`, c.Key, c.Tokens, c.Cost, now).Scan(&used[i].Tokens, &used[i].Cost)
+		if err != nil {
+			return nil, -1, err
+		}
+		if c.Exceeds(used[i]) {
+			return used[:i+1], i, nil
+		}
+	}
+	return used, -1, tx.Commit()
+}
+
+// UpdateRateLimit applies update to the theoretical arrival time stored for
+// key inside a single transaction so servers sharing the database agree.
+// The transaction begins IMMEDIATE (see NewSQLiteStore), so no other
+// process can change the row between the read and the write.
+func (s *SQLiteStore) UpdateRateLimit(key string, update func(tat time.Time) (time.Time, bool)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var nanos int64
+	err = tx.QueryRow("SELECT tat FROM rate_limits WHERE key = ?", key).Scan(&nanos)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	var tat time.Time
+	if nanos != 0 {
+		tat = time.Unix(0, nanos)
+	}
+
+	next, allowed := update(tat)
+	if !allowed {
+		return false, nil
+	}
+	_, err = tx.Exec(`
+		INSERT INTO rate_limits (key, tat) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET tat = excluded.tat
+	`, key, next.UnixNano())
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *SQLiteStore) CreateApproval(a *models.ApprovalRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO approvals (id, execution_id, state, data, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, a.ID, a.ExecutionID, string(a.State), string(data), a.ExpiresAt)
+	return err
+}
+
+// UpdateApproval records the decision on a pending approval. Only a pending
+// approval can be decided, so when a reviewer and the timeout race exactly
+// one of them wins and the other gets models.ErrApprovalDecided.
+func (s *SQLiteStore) UpdateApproval(a *models.ApprovalRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec("UPDATE approvals SET state = ?, data = ? WHERE id = ? AND state = ?",
+		string(a.State), string(data), a.ID, string(models.ApprovalPending))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("approval %s: %w", a.ID, models.ErrApprovalDecided)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetApproval(id string) (*models.ApprovalRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data string
+	err := s.db.QueryRow("SELECT data FROM approvals WHERE id = ?", id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("approval %s not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var a models.ApprovalRequest
+	if err := json.Unmarshal([]byte(data), &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListApprovals returns approvals for an execution (all executions when
+// executionID is empty), optionally filtered by state, oldest first.
+func (s *SQLiteStore) ListApprovals(executionID string, state models.ApprovalState) ([]*models.ApprovalRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := "SELECT data FROM approvals WHERE 1 = 1"
+	args := []interface{}{}
+	if executionID != "" {
+		query += " AND execution_id = ?"
+		args = append(args, executionID)
+	}
+	if state != "" {
+		query += " AND state = ?"
+		args = append(args, string(state))
+	}
+	query += " ORDER BY expires_at ASC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.ApprovalRequest
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var a models.ApprovalRequest
+		if err := json.Unmarshal([]byte(data), &a); err != nil {
+			return nil, err
+		}
+		results = append(results, &a)
+	}
+	return results, nil
+}
+
+// RecordEvent stores e, or folds it into an existing event with the same
+// object, type, reason and message. e is updated with the stored ID,
+// count and first/last seen times.
+func (s *SQLiteStore) RecordEvent(e *models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.LastSeen.IsZero() {
+		e.LastSeen = time.Now().UTC()
+	}
+	if e.FirstSeen.IsZero() {
+		e.FirstSeen = e.LastSeen
+	}
+	if e.Count <= 0 {
+		e.Count = 1
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	obj := e.InvolvedObject
+	_, err = tx.Exec(`
+		INSERT INTO events (id, kind, namespace, name, type, reason, message, source, count, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(kind, namespace, name, type, reason, message) DO UPDATE SET
+			count = count + excluded.count,
+			source = excluded.source,
+			last_seen = excluded.last_seen
+	`, uuid.New().String(), string(obj.Kind), obj.Namespace, obj.Name, string(e.Type), e.Reason, e.Message, e.Source, e.Count, e.FirstSeen, e.LastSeen)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow(`
+		SELECT id, count, first_seen, last_seen FROM events
+		WHERE kind = ? AND namespace = ? AND name = ? AND type = ? AND reason = ? AND message = ?
+	`, string(obj.Kind), obj.Namespace, obj.Name, string(e.Type), e.Reason, e.Message).Scan(&e.ID, &e.Count, &e.FirstSeen, &e.LastSeen)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ListEvents(q models.EventQuery) ([]*models.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := `SELECT id, kind, namespace, name, type, reason, message, source, count, first_seen, last_seen FROM events WHERE 1 = 1`
+	var args []interface{}
+	if q.Kind != "" {
+		query += " AND kind = ?"
+		args = append(args, string(q.Kind))
+	}
+	if q.Namespace != "" {
+		query += " AND namespace = ?"
+		args = append(args, q.Namespace)
+	}
+	if q.Name != "" {
+		query += " AND name = ?"
+		args = append(args, q.Name)
+	}
+	if q.Type != "" {
+		query += " AND type = ?"
+		args = append(args, string(q.Type))
+	}
+	if !q.Since.IsZero() {
+		query += " AND last_seen >= ?"
+		args = append(args, q.Since)
+	}
+	query += " ORDER BY last_seen DESC"
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.Event
+	for rows.Next() {
+		var e models.Event
+		var kind, typ string
+		if err := rows.Scan(&e.ID, &kind, &e.InvolvedObject.Namespace, &e.InvolvedObject.Name, &typ, &e.Reason, &e.Message, &e.Source, &e.Count, &e.FirstSeen, &e.LastSeen); err != nil {
+			return nil, err
+		}
+		e.InvolvedObject.Kind = models.ResourceKind(kind)
+		e.Type = models.EventType(typ)
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+// DeleteEventsBefore removes events last seen before t and returns how
+// many were removed.
+func (s *SQLiteStore) DeleteEventsBefore(t time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec("DELETE FROM events WHERE last_seen < ?", t)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 // Watch support
 
 func (s *SQLiteStore) Watch(kind models.ResourceKind) <-chan ResourceEvent {
@@ -393,6 +1309,92 @@ func (s *SQLiteStore) Watch(kind models.ResourceKind) <-chan ResourceEvent {
 	return ch
 }
 
+// WatchExecutions returns a channel receiving an event whenever an
+// execution is created, changes state or moves to another step. Other
+// updates are not reported. Every event is delivered, in order: a slow
+// reader falls behind but loses nothing and does not hold up writers. The
+// channel is closed by Close.
+func (s *SQLiteStore) WatchExecutions() <-chan ExecutionEvent {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	w := newExecWatcher()
+	s.execs = append(s.execs, w)
+	return w.out
+}
+
+// emitExecution sends each watcher its own copy of the stored record, so
+// watchers never share the caller's maps.
+func (s *SQLiteStore) emitExecution(typ EventType, prev models.ExecutionState, data []byte) {
+	s.watchMu.RLock()
+	defer s.watchMu.RUnlock()
+
+	for _, w := range s.execs {
+		var exec models.ExecutionRecord
+		if err := json.Unmarshal(data, &exec); err != nil {
+			return
+		}
+		w.push(ExecutionEvent{Type: typ, Execution: &exec, PrevState: prev})
+	}
+}
+
+// execWatcher queues the events of one WatchExecutions reader without a
+// bound and forwards them from its own goroutine.
+type execWatcher struct {
+	out  chan ExecutionEvent
+	wake chan struct{}
+
+	mu     sync.Mutex
+	queue  []ExecutionEvent
+	closed bool
+}
+
+func newExecWatcher() *execWatcher {
+	w := &execWatcher{out: make(chan ExecutionEvent), wake: make(chan struct{}, 1)}
+	go w.forward()
+	return w
+}
+
+func (w *execWatcher) push(ev ExecutionEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.queue = append(w.queue, ev)
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *execWatcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.wake)
+	}
+}
+
+func (w *execWatcher) forward() {
+	defer close(w.out)
+	for range w.wake {
+		for {
+			w.mu.Lock()
+			if len(w.queue) == 0 {
+				w.mu.Unlock()
+				break
+			}
+			ev := w.queue[0]
+			w.queue[0] = ExecutionEvent{}
+			w.queue = w.queue[1:]
+			w.mu.Unlock()
+			w.out <- ev
+		}
+	}
+}
+
 func (s *SQLiteStore) emit(kind models.ResourceKind, event ResourceEvent) {
 	s.watchMu.RLock()
 	defer s.watchMu.RUnlock()
@@ -0,0 +1,290 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+)
+
+func newTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "pipe.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestChargeBudgetRefusesPastLimit(t *testing.T) {
+	s := newTestStore(t)
+	charge := []models.BudgetCharge{
+		{Key: "namespace/default", Tokens: 60, MaxTokens: 100},
+		{Key: "agent/default/a", Tokens: 60, MaxTokens: 1000},
+	}
+	if _, exceeded, err := s.ChargeBudget(charge); err != nil || exceeded != -1 {
+		t.Fatalf("first charge: exceeded=%d err=%v", exceeded, err)
+	}
+	used, exceeded, err := s.ChargeBudget(charge)
+	if err != nil || exceeded != 0 || used[0].Tokens != 120 {
+		t.Fatalf("second charge: used=%v exceeded=%d err=%v, want scope 0 at 120", used, exceeded, err)
+	}
+	// The refused charge must not have been applied to any key.
+	for _, key := range []string{"namespace/default", "agent/default/a"} {
+		if tokens, _, _ := s.GetBudgetUsage(key); tokens != 60 {
+			t.Errorf("%s = %d tokens after a refused charge, want 60", key, tokens)
+		}
+	}
+}
+
+func TestDeleteSpansBefore(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now().UTC()
+	spans := []models.SpanRecord{
+		{TraceID: "t1", SpanID: "old", ExecutionID: "e1", Operation: "step", StartTime: now.Add(-48 * time.Hour)},
+		{TraceID: "t1", SpanID: "new", ExecutionID: "e1", Operation: "step", StartTime: now},
+	}
+	if err := s.AppendSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.DeleteSpansBefore(now.Add(-24 * time.Hour)); err != nil || n != 1 {
+		t.Fatalf("deleted %d spans (%v), want 1", n, err)
+	}
+	kept, err := s.GetExecutionSpans("e1")
+	if err != nil || len(kept) != 1 || kept[0].SpanID != "new" {
+		t.Fatalf("kept %+v (%v), want the new span", kept, err)
+	}
+}
+
+func TestShadowReportFromVerdicts(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now().UTC()
+	verdicts := []models.GuardrailVerdict{
+		{GuardrailID: "pii-shadow", Phase: "pre", Step: 0, Passed: false, Action: "block", Message: "email", Shadow: true, Timestamp: now},
+		{GuardrailID: "injection", Phase: "pre", Step: 0, Passed: false, Action: "block", Message: "blocked", Timestamp: now},
+		{GuardrailID: "pii-shadow", Phase: "pre", Step: 1, Passed: true, Shadow: true, Timestamp: now},
+	}
+	if err := s.AppendGuardrailVerdicts("e1", verdicts); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendGuardrailVerdicts("e2", verdicts[2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.ShadowReport(now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("got %d guardrails, want only the shadow one: %+v", len(stats), stats)
+	}
+	st := stats[0]
+	if st.Checks != 3 || st.Violations != 1 || st.WouldBlock != 1 || st.Executions != 2 ||
+		st.ViolatingExecutions != 1 || st.OverlapWithEnforced != 1 || len(st.Samples) != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestMigrateAddsVerdictColumns(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "pipe.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// guardrail_verdicts as first released, without agent and namespace.
+	_, err = s.db.Exec(`CREATE TABLE guardrail_verdicts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		execution_id TEXT NOT NULL,
+		guardrail_id TEXT NOT NULL,
+		phase TEXT NOT NULL,
+		step INTEGER DEFAULT 0,
+		passed INTEGER NOT NULL,
+		action TEXT DEFAULT '',
+		message TEXT NOT NULL,
+		shadow INTEGER DEFAULT 0,
+		latency_ms REAL DEFAULT 0,
+		timestamp DATETIME NOT NULL
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Migrate(); err != nil {
+			t.Fatalf("migrate %d: %v", i+1, err)
+		}
+	}
+	v := models.GuardrailVerdict{GuardrailID: "pii", AgentName: "a", Namespace: "ns", Phase: "post", Message: "m", Timestamp: time.Now().UTC()}
+	if err := s.AppendGuardrailVerdicts("e1", []models.GuardrailVerdict{v}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGuardrailViolations(t *testing.T) {
+	s := newTestStore(t)
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return since.Add(time.Duration(m) * time.Minute) }
+	verdicts := []struct {
+		exec string
+		v    models.GuardrailVerdict
+	}{
+		{"e1", models.GuardrailVerdict{GuardrailID: "pii", AgentName: "a", Namespace: "ns", Action: "block", Timestamp: at(10)}},
+		{"e1", models.GuardrailVerdict{GuardrailID: "pii", AgentName: "a", Namespace: "ns", Action: "block", Timestamp: at(20)}},
+		{"e2", models.GuardrailVerdict{GuardrailID: "pii", AgentName: "b", Namespace: "ns", Action: "block", Timestamp: at(70)}},
+		{"e2", models.GuardrailVerdict{GuardrailID: "toxicity", AgentName: "b", Namespace: "ns", Action: "warn", Timestamp: at(75)}},
+		{"e3", models.GuardrailVerdict{GuardrailID: "toxicity", AgentName: "b", Namespace: "ns", Action: "warn", Shadow: true, Timestamp: at(80)}},
+		{"e3", models.GuardrailVerdict{GuardrailID: "toxicity", AgentName: "b", Namespace: "ns", Passed: true, Timestamp: at(80)}},
+		{"e4", models.GuardrailVerdict{GuardrailID: "pii", AgentName: "a", Namespace: "ns", Action: "block", Timestamp: at(130)}},
+	}
+	for _, r := range verdicts {
+		r.v.Phase, r.v.Message = "post", "m"
+		if err := s.AppendGuardrailVerdicts(r.exec, []models.GuardrailVerdict{r.v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := s.GuardrailViolations(models.ViolationQuery{Since: since, Until: at(120), Window: time.Hour, GroupBy: []string{"guardrail"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.ViolationStat{
+		{BucketStart: at(0), GuardrailID: "pii", Count: 2, Executions: 1},
+		{BucketStart: at(60), GuardrailID: "pii", Count: 1, Executions: 1},
+		{BucketStart: at(60), GuardrailID: "toxicity", Count: 1, Executions: 1},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("got %+v, want %+v", stats, want)
+	}
+	for i := range want {
+		if !stats[i].BucketStart.Equal(want[i].BucketStart) || stats[i].GuardrailID != want[i].GuardrailID ||
+			stats[i].Count != want[i].Count || stats[i].Executions != want[i].Executions {
+			t.Errorf("stats[%d] = %+v, want %+v", i, stats[i], want[i])
+		}
+	}
+
+	stats, err = s.GuardrailViolations(models.ViolationQuery{Since: since, Until: at(120), GroupBy: []string{"namespace", "agent"}, Shadow: true, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].AgentName != "b" || stats[0].Count != 3 || stats[0].Executions != 2 || stats[0].GuardrailID != "" {
+		t.Fatalf("top agent = %+v, want b with 3 violations in 2 executions", stats)
+	}
+
+	if _, err := s.GuardrailViolations(models.ViolationQuery{GroupBy: []string{"timestamp"}}); err == nil {
+		t.Fatal("grouping by an unknown field was accepted")
+	}
+}
+
+func TestUsageReport(t *testing.T) {
+	s := newTestStore(t)
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return since.Add(time.Duration(m) * time.Minute) }
+	for _, u := range []models.UsageRecord{
+		{ExecutionID: "e1", AgentName: "a", Model: "small", PromptTokens: 100, CompletionTokens: 50, Cost: 0.01, Priced: true, Timestamp: at(10)},
+		{ExecutionID: "e2", AgentName: "a", Model: "small", PromptTokens: 100, CompletionTokens: 50, Cost: 0.01, Priced: true, Timestamp: at(20)},
+		{ExecutionID: "e2", AgentName: "a", Model: "large", PromptTokens: 10, CompletionTokens: 5, Cost: 0.5, Priced: true, Timestamp: at(30)},
+		{ExecutionID: "e3", AgentName: "b", Model: "local", PromptTokens: 1000, Timestamp: at(70)},
+		{ExecutionID: "e4", AgentName: "b", Model: "local", PromptTokens: 1000, Timestamp: at(130)},
+	} {
+		u := u
+		if err := s.RecordUsage(&u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := s.UsageReport(models.UsageQuery{Since: since, Until: at(120), Window: time.Hour, GroupBy: []string{"model"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.UsageStat{
+		{BucketStart: at(0), Model: "large", Calls: 1, Executions: 1, PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Cost: 0.5},
+		{BucketStart: at(0), Model: "small", Calls: 2, Executions: 2, PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300, Cost: 0.02},
+		{BucketStart: at(60), Model: "local", Calls: 1, Executions: 1, PromptTokens: 1000, TotalTokens: 1000, UnpricedCalls: 1},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("got %+v, want %+v", stats, want)
+	}
+	for i := range want {
+		got := stats[i]
+		if !got.BucketStart.Equal(want[i].BucketStart) || got.Model != want[i].Model || got.Calls != want[i].Calls ||
+			got.Executions != want[i].Executions || got.TotalTokens != want[i].TotalTokens ||
+			math.Abs(got.Cost-want[i].Cost) > 1e-9 || got.UnpricedCalls != want[i].UnpricedCalls {
+			t.Errorf("stat %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	if _, err := s.UsageReport(models.UsageQuery{GroupBy: []string{"color"}}); err == nil {
+		t.Error("grouping by an unknown column succeeded")
+	}
+}
+
+func TestWatchExecutionsReportsSteps(t *testing.T) {
+	s := newTestStore(t)
+	events := s.WatchExecutions()
+	exec := &models.ExecutionRecord{ID: "e1", AgentName: "a", Namespace: "default", State: models.ExecRunning}
+	if err := s.CreateExecution(exec); err != nil {
+		t.Fatal(err)
+	}
+	<-events
+
+	exec.Output = map[string]interface{}{"partial": true}
+	if err := s.UpdateExecution(exec); err != nil {
+		t.Fatal(err)
+	}
+	exec.CurrentStep = 1
+	if err := s.UpdateExecution(exec); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Execution.CurrentStep != 1 || ev.PrevState != models.ExecRunning {
+			t.Fatalf("event = step %d from %s, want step 1 from Running", ev.Execution.CurrentStep, ev.PrevState)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event for the step change")
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchExecutionsDeliversEveryEvent(t *testing.T) {
+	s := newTestStore(t)
+	events := s.WatchExecutions()
+	// Far more events than any channel buffer, with nobody reading yet.
+	const n = 500
+	for i := 0; i < n; i++ {
+		exec := &models.ExecutionRecord{ID: fmt.Sprintf("e%d", i), AgentName: "a", Namespace: "default", State: models.ExecPending}
+		if err := s.CreateExecution(exec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case ev := <-events:
+			if want := fmt.Sprintf("e%d", i); ev.Execution.ID != want {
+				t.Fatalf("event %d is for %s, want %s", i, ev.Execution.ID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("got %d of %d events", i, n)
+		}
+	}
+
+	s.Close()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("event after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed by Close")
+	}
+}
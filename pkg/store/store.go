@@ -1,6 +1,8 @@
 package store
 
 import (
+	"time"
+
 	"github.com/Promptonauts/pipe/pkg/models"
 )
 
@@ -8,7 +10,7 @@ type Store interface {
 	Put(resource *models.GenericResource) error
 	Get(kind models.ResourceKind, namespace, name string) (*models.GenericResource, error)
 	List(kind models.ResourceKind, namespace string) ([]*models.GenericResource, error)
-	Delete(kind models.ResourceKind, namespace, name string, status models.ResourceStatus) error
+	Delete(kind models.ResourceKind, namespace, name string) error
 
 	CreateExecution(exec *models.ExecutionRecord) error
 	GetExecution(id string) (*models.ExecutionRecord, error)
@@ -16,10 +18,34 @@ type Store interface {
 	ListExecutions(namespace string, limit int) ([]*models.ExecutionRecord, error)
 	GetExecutionLogs(id string) ([]models.ExecutionLog, error)
 	AppendExecutionLog(id string, log models.ExecutionLog) error
+	GetGuardrailVerdicts(id string) ([]models.GuardrailVerdict, error)
+	AppendGuardrailVerdicts(id string, verdicts []models.GuardrailVerdict) error
+	GuardrailViolations(q models.ViolationQuery) ([]models.ViolationStat, error)
+	ShadowReport(since time.Time) ([]models.ShadowStats, error)
+	AppendSpans(spans []models.SpanRecord) error
+	GetExecutionSpans(executionID string) ([]models.SpanRecord, error)
+	DeleteSpansBefore(t time.Time) (int64, error)
 	SaveCheckpoint(executionID string, data []byte) error
 	LoadCheckpoint(executionID string) ([]byte, error)
 
+	GetBudgetUsage(key string) (int64, float64, error)
+	ChargeBudget(charges []models.BudgetCharge) ([]models.BudgetUsage, int, error)
+	RecordUsage(u *models.UsageRecord) error
+	GetExecutionUsage(executionID string) ([]models.UsageRecord, error)
+	UsageReport(q models.UsageQuery) ([]models.UsageStat, error)
+	UpdateRateLimit(key string, update func(tat time.Time) (time.Time, bool)) (bool, error)
+
+	CreateApproval(a *models.ApprovalRequest) error
+	UpdateApproval(a *models.ApprovalRequest) error
+	GetApproval(id string) (*models.ApprovalRequest, error)
+	ListApprovals(executionID string, state models.ApprovalState) ([]*models.ApprovalRequest, error)
+
+	RecordEvent(e *models.Event) error
+	ListEvents(q models.EventQuery) ([]*models.Event, error)
+	DeleteEventsBefore(t time.Time) (int64, error)
+
 	Watch(kind models.ResourceKind) <-chan ResourceEvent
+	WatchExecutions() <-chan ExecutionEvent
 
 	Migrate() error
 	Close() error
@@ -37,3 +63,11 @@ type ResourceEvent struct {
 	Type     EventType
 	Resource *models.GenericResource
 }
+
+// ExecutionEvent reports an execution being created, changing state or
+// moving to another step.
+type ExecutionEvent struct {
+	Type      EventType
+	Execution *models.ExecutionRecord // copy taken when the event was emitted
+	PrevState models.ExecutionState   // empty for EventCreated
+}
@@ -0,0 +1,113 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/Promptonauts/pipe/pkg/models"
+	"github.com/Promptonauts/pipe/pkg/observability"
+)
+
+type Store interface {
+	RecordUsage(u *models.UsageRecord) error
+}
+
+// Meter prices model calls and records their usage against the execution,
+// so cost can be rolled up per execution, agent, pipeline and namespace.
+type Meter struct {
+	store   Store
+	metrics *observability.MetricsRegistry
+	logger  *observability.Logger
+
+	mu     sync.RWMutex
+	prices models.PriceTable
+}
+
+func NewMeter(s Store, prices models.PriceTable, metrics *observability.MetricsRegistry, logger *observability.Logger) *Meter {
+	if prices == nil {
+		prices = models.PriceTable{}
+	}
+	return &Meter{store: s, prices: prices, metrics: metrics, logger: logger.With("usage")}
+}
+
+// SetPrices replaces the price table, e.g. after the price file changed.
+// Calls already recorded keep the cost they were priced at.
+func (m *Meter) SetPrices(prices models.PriceTable) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prices = prices
+}
+
+// Price returns the price for model: the agent's own pricing when set,
+// otherwise the price table entry.
+func (m *Meter) Price(model models.ModelConfig) (models.ModelPrice, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.prices.Price(model)
+}
+
+func (m *Meter) cost(model models.ModelConfig, promptTokens, completionTokens int64) (float64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.prices.Cost(model, promptTokens, completionTokens)
+}
+
+// Record prices one model call made at step of exec, stores it and adds it
+// to the execution's totals. The caller persists exec.
+func (m *Meter) Record(exec *models.ExecutionRecord, model models.ModelConfig, step int, promptTokens, completionTokens int64) (*models.UsageRecord, error) {
+	u := &models.UsageRecord{
+		ExecutionID:      exec.ID,
+		AgentName:        exec.AgentName,
+		PipelineName:     exec.PipelineName,
+		Namespace:        exec.Namespace,
+		Step:             step,
+		Provider:         model.Provider,
+		Model:            model.Name,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+	}
+	u.Cost, u.Priced = m.cost(model, promptTokens, completionTokens)
+	if !u.Priced {
+		m.metrics.Counter("usage.unpriced.calls.total").Inc()
+		m.logger.Debug("no price for model", "provider", model.Provider, "model", model.Name)
+	}
+
+	if err := m.store.RecordUsage(u); err != nil {
+		return nil, fmt.Errorf("record usage: %w", err)
+	}
+
+	exec.PromptTokens += promptTokens
+	exec.CompletionTokens += completionTokens
+	exec.TokensUsed += u.TotalTokens()
+	exec.Cost += u.Cost
+
+	tokens := m.metrics.CounterVec("usage.tokens", "namespace", "agent", "model", "type")
+	tokens.WithLabelValues(exec.Namespace, exec.AgentName, model.Name, "prompt").Add(promptTokens)
+	tokens.WithLabelValues(exec.Namespace, exec.AgentName, model.Name, "completion").Add(completionTokens)
+	// Counters are integers, so cost is counted in millionths of a dollar.
+	m.metrics.CounterVec("usage.cost.microdollars", "namespace", "agent", "model").
+		WithLabelValues(exec.Namespace, exec.AgentName, model.Name).Add(int64(math.Round(u.Cost * 1e6)))
+	return u, nil
+}
+
+// LoadPriceTable reads a JSON price table keyed by "provider/model" or bare
+// model name, e.g. {"openai/gpt-4o": {"promptPer1k": 0.0025, "completionPer1k": 0.01}}.
+func LoadPriceTable(path string) (models.PriceTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prices models.PriceTable
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for key, p := range prices {
+		if p.PromptPer1K < 0 || p.CompletionPer1K < 0 {
+			return nil, fmt.Errorf("%s: %s: prices must not be negative", path, key)
+		}
+	}
+	return prices, nil
+}